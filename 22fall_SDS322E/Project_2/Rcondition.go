@@ -0,0 +1,93 @@
+//go:build cgo
+
+package main
+
+// #include <R.h>
+// #include <Rinternals.h>
+import "C"
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// Errors of exported functions are raised in R as conditions, which inherit
+// from project2Error:
+//
+//	project2ArgumentError  an argument has the wrong type or value
+//	project2EvalError      evaluating R code failed, with R's error message
+//	project2Error          anything else, including panics
+//
+// Go must not be unwound by an R error, so exported functions return their
+// value and condition with rCall and the wrappers in Rinterface.c signal it.
+
+// rError is an error raised as an R condition of class class.
+type rError struct {
+	class string
+	err   error
+}
+
+func (e rError) Error() string {
+	return e.err.Error()
+}
+
+func (e rError) Unwrap() error {
+	return e.err
+}
+
+// argumentError reports a bad argument of an exported function.
+func argumentError(arg string, err error) error {
+	return rError{class: "project2ArgumentError", err: fmt.Errorf("%s: %w", arg, err)}
+}
+
+// rCondition returns a condition object of the classes, followed by
+// "condition", with a message, a NULL call and the fields, which must be
+// protected.
+func rCondition(classes []string, msg string, fields ...RNamed) C.SEXP {
+	msgSEXP := C.Rf_protect(RString([]string{msg}))
+	fields = append([]RNamed{{Name: "message", Val: msgSEXP}, {Name: "call", Val: C.R_NilValue}}, fields...)
+	cond := C.Rf_protect(C.allocVector(C.VECSXP, C.R_xlen_t(len(fields))))
+	defer C.Rf_unprotect(2)
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		C.SET_VECTOR_ELT(cond, C.R_xlen_t(i), f.Val)
+		names[i] = f.Name
+	}
+	setAttr(cond, "names", RString(names))
+	setAttr(cond, "class", RString(append(classes, "condition")))
+	return cond
+}
+
+// rErrorCondition returns the condition err is raised as.
+func rErrorCondition(err error) C.SEXP {
+	classes := []string{"project2Error", "error"}
+	var re rError
+	if errors.As(err, &re) {
+		classes = append([]string{re.class}, classes...)
+	}
+	return rCondition(classes, err.Error())
+}
+
+// rCall runs the body of an exported function, which returns its value and a
+// warning condition or R_NilValue, and returns them as a list for the
+// wrappers in Rinterface.c. Errors and panics become error conditions.
+func rCall(fn func() (C.SEXP, C.SEXP, error)) (ret C.SEXP) {
+	defer func() {
+		if r := recover(); r != nil {
+			ret = rResult(C.R_NilValue, rErrorCondition(fmt.Errorf("panic: %v\n%s", r, debug.Stack())))
+		}
+	}()
+	value, cond, err := fn()
+	if err != nil {
+		return rResult(C.R_NilValue, rErrorCondition(err))
+	}
+	return rResult(value, cond)
+}
+
+// rResult returns list(value = value, condition = cond).
+func rResult(value C.SEXP, cond C.SEXP) C.SEXP {
+	C.Rf_protect(value)
+	C.Rf_protect(cond)
+	defer C.Rf_unprotect(2)
+	return RList([]RNamed{{Name: "value", Val: value}, {Name: "condition", Val: cond}})
+}
@@ -0,0 +1,25 @@
+//go:build cgo
+
+package main
+
+// #include <stdlib.h>
+// #include <R.h>
+//
+// static void printR(const char *s) {
+// 	Rprintf("%s", s);
+// 	R_FlushConsole();
+// }
+import "C"
+import "unsafe"
+
+// rConsole writes to R's console, so output shows up in RStudio and knitr
+// logs rather than on the process's stdout. It must only be written from R's
+// thread, i.e. by the goroutine of an exported function.
+type rConsole struct{}
+
+func (rConsole) Write(p []byte) (int, error) {
+	s := C.CString(string(p))
+	defer C.free(unsafe.Pointer(s))
+	C.printR(s)
+	return len(p), nil
+}
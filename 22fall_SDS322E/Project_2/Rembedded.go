@@ -0,0 +1,45 @@
+//go:build cgo
+
+package main
+
+// #define CSTACK_DEFNS
+// #include <stdint.h>
+// #include <stdlib.h>
+// #include <Rembedded.h>
+// #include <Rinterface.h>
+//
+// static int startR(int argc, char **argv) {
+// 	if (Rf_initialize_R(argc, argv) != 0) {
+// 		return -1;
+// 	}
+// 	// goroutines run on stacks R does not know about
+// 	R_CStackLimit = (uintptr_t)-1;
+// 	R_Interactive = FALSE;
+// 	setup_Rmainloop();
+// 	return 0;
+// }
+import "C"
+import (
+	"errors"
+	"os"
+	"unsafe"
+)
+
+// StartEmbeddedR starts an R session in this process, so the R interface can
+// be called from Go, e.g. in tests. R_HOME must be set. R is not safe for
+// concurrent use.
+func StartEmbeddedR() error {
+	if os.Getenv("R_HOME") == "" {
+		return errors.New("R_HOME is not set")
+	}
+	args := []string{"R", "--vanilla", "--silent", "--no-save"}
+	// R keeps the arguments, so they are never freed
+	argv := (**C.char)(C.malloc(C.size_t(len(args)) * C.size_t(unsafe.Sizeof((*C.char)(nil)))))
+	for i, arg := range args {
+		unsafe.Slice(argv, len(args))[i] = C.CString(arg)
+	}
+	if C.startR(C.int(len(args)), argv) != 0 {
+		return errors.New("failed to start R")
+	}
+	return nil
+}
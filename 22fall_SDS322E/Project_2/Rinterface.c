@@ -0,0 +1,83 @@
+//go:build cgo
+
+// The functions called from R with .Call. Each wraps a Go function returning
+// list(value, condition) and signals the condition from C, as an R error must
+// not unwind Go code.
+
+#include <stdint.h>
+#include <R.h>
+#include <Rinternals.h>
+#include "_cgo_export.h"
+
+static SEXP signalResult(SEXP result) {
+	PROTECT(result);
+	SEXP value = VECTOR_ELT(result, 0);
+	SEXP cond = VECTOR_ELT(result, 1);
+	if (cond != R_NilValue) {
+		SEXP signal = Rf_install(Rf_inherits(cond, "error") ? "stop" : "warning");
+		SEXP call = PROTECT(Rf_lang2(signal, cond));
+		Rf_eval(call, R_BaseEnv);
+		UNPROTECT(1);
+	}
+	UNPROTECT(1);
+	return value;
+}
+
+SEXP ExtractPackages(SEXP urlSexp, SEXP outputType, SEXP nProcsSexp) {
+	return signalResult(goExtractPackages(urlSexp, outputType, nProcsSexp));
+}
+
+SEXP ExtractFeatures(SEXP filenameSexp, SEXP nProcsSexp, SEXP extractorsSexp) {
+	return signalResult(goExtractFeatures(filenameSexp, nProcsSexp, extractorsSexp));
+}
+
+SEXP FeatureExtractors(void) {
+	return signalResult(goFeatureExtractors());
+}
+
+SEXP ExtractPackageTables(SEXP filenameSexp) {
+	return signalResult(goExtractPackageTables(filenameSexp));
+}
+
+// Extraction jobs are external pointers to a cgo.Handle, see Rjobs.go.
+
+static void finalizeJob(SEXP ptr) {
+	uintptr_t handle = (uintptr_t)R_ExternalPtrAddr(ptr);
+	if (handle != 0) {
+		R_ClearExternalPtr(ptr);
+		goReleaseJob(handle);
+	}
+}
+
+SEXP makeJobPointer(uintptr_t handle) {
+	SEXP ptr = PROTECT(R_MakeExternalPtr((void *)handle, Rf_install("project2Job"), R_NilValue));
+	R_RegisterCFinalizerEx(ptr, finalizeJob, TRUE);
+	Rf_setAttrib(ptr, R_ClassSymbol, Rf_mkString("project2Job"));
+	UNPROTECT(1);
+	return ptr;
+}
+
+// jobPointerHandle returns the handle of a job, 0 if ptr is not a job or was
+// released, e.g. by saving and restoring the session.
+uintptr_t jobPointerHandle(SEXP ptr) {
+	if (TYPEOF(ptr) != EXTPTRSXP || R_ExternalPtrTag(ptr) != Rf_install("project2Job")) {
+		return 0;
+	}
+	return (uintptr_t)R_ExternalPtrAddr(ptr);
+}
+
+SEXP StartExtractJob(SEXP urlSexp, SEXP outputType, SEXP nProcsSexp) {
+	return signalResult(goStartExtractJob(urlSexp, outputType, nProcsSexp));
+}
+
+SEXP ExtractJobStatus(SEXP jobSexp) {
+	return signalResult(goExtractJobStatus(jobSexp));
+}
+
+SEXP ExtractJobResults(SEXP jobSexp) {
+	return signalResult(goExtractJobResults(jobSexp));
+}
+
+SEXP CancelExtractJob(SEXP jobSexp) {
+	return signalResult(goCancelExtractJob(jobSexp));
+}
@@ -6,11 +6,15 @@ package main
 
 // #include <R.h>
 // #include <Rinternals.h>
+// #include <R_ext/Parse.h>
 import "C"
 import (
 	"Project2/model"
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"runtime"
+	"strings"
 	"unsafe"
 )
 
@@ -27,157 +31,177 @@ func rUnprotect(n int) {
 	C.Rf_unprotect(C.int(n))
 }
 
-func RPrint(sexp C.SEXP) {
-	printStr := C.CString("print")
-	defer C.free(unsafe.Pointer(printStr))
-	print := C.Rf_install(printStr)
-	printCall := C.Rf_lang2(print, sexp)
-	C.Rf_protect(printCall)
-	defer C.Rf_unprotect(1)
+// rSymbol returns the symbol name.
+func rSymbol(name string) C.SEXP {
+	nameStr := C.CString(name)
+	defer C.free(unsafe.Pointer(nameStr))
+	return C.Rf_install(nameStr)
+}
 
+// rTryEval evaluates call in the global environment. Errors in R are returned
+// with R's error message.
+func rTryEval(call C.SEXP) (C.SEXP, error) {
 	errorOccurred := C.int(0)
-	C.R_tryEval(printCall, C.R_GlobalEnv, &errorOccurred)
+	ret := C.R_tryEval(call, C.R_GlobalEnv, &errorOccurred)
 	if errorOccurred != 0 {
-		log.Panicf("Error occurred in R_tryEval")
+		return C.R_NilValue, rError{class: "project2EvalError", err: errors.New(rErrorMessage())}
 	}
+	return ret, nil
 }
 
-func RDataFrame(list C.SEXP) C.SEXP {
-	dataframeStr := C.CString("data.frame")
-	defer C.free(unsafe.Pointer(dataframeStr))
-	dataframe := C.Rf_install(dataframeStr)
-	dfCall := C.Rf_lang2(dataframe, list)
-	C.Rf_protect(dfCall)
+// rErrorMessage returns the message of the last R error.
+func rErrorMessage() string {
+	call := C.Rf_protect(C.Rf_lang1(rSymbol("geterrmessage")))
 	defer C.Rf_unprotect(1)
-
 	errorOccurred := C.int(0)
-	df := C.R_tryEval(dfCall, C.R_GlobalEnv, &errorOccurred)
-	if errorOccurred != 0 {
-		log.Panicf("Failed to create data frame")
+	msg := C.R_tryEval(call, C.R_BaseEnv, &errorOccurred)
+	if errorOccurred != 0 || C.TYPEOF(msg) != C.STRSXP || C.Rf_xlength(msg) < 1 {
+		return "unknown R error"
 	}
-	return df
+	return strings.TrimSpace(strings.TrimPrefix(GoString(msg)[0], "Error"))
 }
 
-func MakeRList(kvs []model.KV) C.SEXP {
-	var vals []RNamed
-	for _, kv := range kvs {
-		//log.Printf("Key[%d]: %s", i, kv.Key)
-		switch v := kv.Value.(type) {
-		case string:
-			vals = append(vals, RNamed{kv.Key, RString([]string{v})})
-		case int, int8, int16, int32, int64:
-			vals = append(vals, RNamed{kv.Key, C.Rf_ScalarInteger(C.int(v.(int)))})
-		case uint, uint8, uint16, uint32, uint64:
-			vals = append(vals, RNamed{kv.Key, C.Rf_ScalarInteger(C.int(v.(int)))})
-		case float32, float64:
-			vals = append(vals, RNamed{kv.Key, C.Rf_ScalarReal(C.double(v.(float64)))})
-		}
-	}
-	return RList(vals)
+func RPrint(sexp C.SEXP) error {
+	printCall := C.Rf_protect(C.Rf_lang2(rSymbol("print"), sexp))
+	defer C.Rf_unprotect(1)
+	_, err := rTryEval(printCall)
+	return err
 }
 
-func RList(vals []RNamed) (ret C.SEXP) {
-	if len(vals) > 5 {
-		cStr := C.CString("c")
-		defer C.free(unsafe.Pointer(cStr))
-		c := C.Rf_install(cStr)
-
-		cCall := C.Rf_lang3(c, RList(vals[:5]), RList(vals[5:]))
-		C.Rf_protect(cCall)
-		defer C.Rf_unprotect(1)
-
-		errorOccurred := C.int(0)
-
-		ret = C.R_tryEval(cCall, C.R_GlobalEnv, &errorOccurred)
-		if errorOccurred != 0 {
-			log.Panicf("Error occurred in R_tryEval")
-		}
-		return ret
-	}
-	listStr := C.CString("list")
-	defer C.free(unsafe.Pointer(listStr))
-	list := C.Rf_install(listStr)
-	var listCall C.SEXP
-	switch len(vals) {
-	case 0:
-		listCall = C.Rf_lang1(list)
-	case 1:
-		listCall = C.Rf_lang2(list, vals[0].Val)
-	case 2:
-		listCall = C.Rf_lang3(list, vals[0].Val, vals[1].Val)
-	case 3:
-		listCall = C.Rf_lang4(list, vals[0].Val, vals[1].Val, vals[2].Val)
-	case 4:
-		listCall = C.Rf_lang5(list, vals[0].Val, vals[1].Val, vals[2].Val, vals[3].Val)
-	case 5:
-		listCall = C.Rf_lang6(list, vals[0].Val, vals[1].Val, vals[2].Val, vals[3].Val, vals[4].Val)
-	}
-	C.Rf_protect(listCall)
+func RDataFrame(list C.SEXP) (C.SEXP, error) {
+	dfCall := C.Rf_protect(C.Rf_lang2(rSymbol("data.frame"), list))
 	defer C.Rf_unprotect(1)
+	return rTryEval(dfCall)
+}
 
-	listCallArgs := C.CDR(listCall)
-	for _, val := range vals {
-		if name := val.Name; name != "" {
-			tmpStr := C.CString(name)
-			defer C.free(unsafe.Pointer(tmpStr))
-			nameSEXP := C.Rf_install(tmpStr)
-			C.SET_TAG(listCallArgs, nameSEXP)
-			listCallArgs = C.CDR(listCallArgs)
+// RDataFrameColumns allocates a data.frame from typed columns, setting its
+// names, row.names and class directly without evaluating R code.
+func RDataFrameColumns(cols *columns) C.SEXP {
+	df := C.Rf_protect(C.allocVector(C.VECSXP, C.long(len(cols.cols))))
+	defer C.Rf_unprotect(1)
+	names := make([]string, len(cols.cols))
+	n := cols.nrow
+	for i, col := range cols.cols {
+		names[i] = col.name
+		var vec C.SEXP
+		switch col.kind {
+		case intColumn:
+			vec = C.allocVector(C.INTSXP, C.long(n))
+			C.SET_VECTOR_ELT(df, C.R_xlen_t(i), vec)
+			ints := unsafe.Slice(C.INTEGER(vec), n)
+			for j, v := range col.ints {
+				if col.na[j] {
+					ints[j] = C.R_NaInt
+				} else {
+					ints[j] = C.int(v)
+				}
+			}
+		case realColumn:
+			vec = C.allocVector(C.REALSXP, C.long(n))
+			C.SET_VECTOR_ELT(df, C.R_xlen_t(i), vec)
+			reals := unsafe.Slice(C.REAL(vec), n)
+			for j, v := range col.reals {
+				if col.na[j] {
+					reals[j] = C.R_NaReal
+				} else {
+					reals[j] = C.double(v)
+				}
+			}
+		case stringColumn:
+			vec = C.allocVector(C.STRSXP, C.long(n))
+			C.SET_VECTOR_ELT(df, C.R_xlen_t(i), vec)
+			for j, v := range col.strs {
+				if col.na[j] {
+					C.SET_STRING_ELT(vec, C.R_xlen_t(j), C.R_NaString)
+					continue
+				}
+				str := C.CString(v)
+				C.SET_STRING_ELT(vec, C.R_xlen_t(j), C.mkChar(str))
+				C.free(unsafe.Pointer(str))
+			}
 		}
 	}
+	setDataFrameAttrs(df, names, n)
+	return df
+}
 
-	errorOccurred := C.int(0)
-
-	ret = C.R_tryEval(listCall, C.R_GlobalEnv, &errorOccurred)
-	if errorOccurred != 0 {
-		log.Panicf("Error occurred in R_tryEval")
+// MakeRList converts key-value pairs to a named list.
+func MakeRList(kvs []model.KV) (C.SEXP, error) {
+	list := C.Rf_protect(C.allocVector(C.VECSXP, C.long(len(kvs))))
+	defer C.Rf_unprotect(1)
+	names := make([]string, len(kvs))
+	for i, kv := range kvs {
+		val, err := RMarshal(kv.Value)
+		if err != nil {
+			return C.R_NilValue, fmt.Errorf("%s: %w", kv.Key, err)
+		}
+		C.SET_VECTOR_ELT(list, C.R_xlen_t(i), val)
+		names[i] = kv.Key
 	}
-
-	return ret
+	setAttr(list, "names", RString(names))
+	return list, nil
 }
 
-func RRbind(left C.SEXP, right C.SEXP) (ret C.SEXP) {
-	rbindCStr := C.CString("rbind")
-	defer C.free(unsafe.Pointer(rbindCStr))
-	rbind := C.Rf_install(rbindCStr)
+// RList allocates a list of vals, named if any of them has a name.
+func RList(vals []RNamed) C.SEXP {
+	list := C.Rf_protect(C.allocVector(C.VECSXP, C.long(len(vals))))
+	named := false
+	for i, val := range vals {
+		C.SET_VECTOR_ELT(list, C.R_xlen_t(i), val.Val)
+		named = named || val.Name != ""
+	}
+	if named {
+		names := make([]string, len(vals))
+		for i, val := range vals {
+			names[i] = val.Name
+		}
+		C.Rf_setAttrib(list, C.R_NamesSymbol, C.Rf_protect(RString(names)))
+		C.Rf_unprotect(1)
+	}
+	C.Rf_unprotect(1)
+	return list
+}
 
-	rbindCall := C.Rf_lang3(rbind, left, right)
-	C.Rf_protect(rbindCall)
+func RRbind(left C.SEXP, right C.SEXP) (C.SEXP, error) {
+	rbindCall := C.Rf_protect(C.Rf_lang3(rSymbol("rbind"), left, right))
 	defer C.Rf_unprotect(1)
-
-	errorOccurred := C.int(0)
-
-	ret = C.R_tryEval(rbindCall, C.R_GlobalEnv, &errorOccurred)
-	if errorOccurred != 0 {
-		log.Panicf("Error occurred in R_tryEval")
-	}
-	return ret
+	return rTryEval(rbindCall)
 }
 
 // RCBind calls cbind(left, name = val)
-func RCBind(left C.SEXP, name string, val C.SEXP) (ret C.SEXP) {
-	cbindCStr := C.CString("cbind")
-	defer C.free(unsafe.Pointer(cbindCStr))
-	cbind := C.Rf_install(cbindCStr)
-
-	cbindCall := C.Rf_lang3(cbind, left, val)
-	C.Rf_protect(cbindCall)
+func RCBind(left C.SEXP, name string, val C.SEXP) (C.SEXP, error) {
+	cbindCall := C.Rf_protect(C.Rf_lang3(rSymbol("cbind"), left, val))
 	defer C.Rf_unprotect(1)
-
 	if name != "" {
-		nameC := C.CString(name)
-		defer C.free(unsafe.Pointer(nameC))
-		nameSEXP := C.Rf_install(nameC)
-		C.SET_TAG(C.CDR(C.CDR(cbindCall)), nameSEXP)
+		C.SET_TAG(C.CDR(C.CDR(cbindCall)), rSymbol(name))
 	}
+	return rTryEval(cbindCall)
+}
 
-	errorOccurred := C.int(0)
-
-	ret = C.R_tryEval(cbindCall, C.R_GlobalEnv, &errorOccurred)
-	if errorOccurred != 0 {
-		log.Panicf("Error occurred in R_tryEval")
+// REval parses and evaluates R code in the global environment, returning the
+// value of the last expression.
+func REval(code string) (C.SEXP, error) {
+	text := C.Rf_protect(RString([]string{code}))
+	var status C.ParseStatus
+	exprs := C.Rf_protect(C.R_ParseVector(text, -1, &status, C.R_NilValue))
+	defer C.Rf_unprotect(2)
+	if status != C.PARSE_OK {
+		return C.R_NilValue, fmt.Errorf("could not parse R code: %s", code)
 	}
-	return ret
+	ret := C.R_NilValue
+	for i := 0; i < int(C.Rf_xlength(exprs)); i++ {
+		var err error
+		if ret, err = rTryEval(C.VECTOR_ELT(exprs, C.R_xlen_t(i))); err != nil {
+			return C.R_NilValue, err
+		}
+	}
+	return ret, nil
+}
+
+// RIdentical reports whether x and y are identical() in R.
+func RIdentical(x C.SEXP, y C.SEXP) bool {
+	// 16 is IGNORE_ENV, the default flags of identical()
+	return C.R_compute_identical(x, y, 16) != 0
 }
 
 // GOString converts a R character vector to a Go string slice.
@@ -204,18 +228,71 @@ func RString(input []string) C.SEXP {
 	return out
 }
 
-//export ExtractPackages
-func ExtractPackages(urlSexp C.SEXP, outputType C.SEXP, nProcsSexp C.SEXP) C.SEXP {
-	nProcs := runtime.NumCPU()
+// packageFailures sets the failures attribute of value to a data.frame of
+// failures and returns a project2PackageWarning with it, R_NilValue if there
+// are no failures.
+func packageFailures(value C.SEXP, failures []packageFailure, total int) (C.SEXP, error) {
+	if len(failures) == 0 {
+		return C.R_NilValue, nil
+	}
+	df, err := RMarshal(failures)
+	if err != nil {
+		return C.R_NilValue, err
+	}
+	C.Rf_protect(df)
+	defer C.Rf_unprotect(1)
+	setAttr(value, "failures", df)
+	msg := fmt.Sprintf("%d of %d packages failed, see attr(, \"failures\")", len(failures), total)
+	return rCondition([]string{"project2PackageWarning", "project2Warning", "warning"}, msg,
+		RNamed{Name: "failures", Val: df}), nil
+}
+
+// extractArgs unmarshals the arguments of ExtractPackages and
+// StartExtractJob. nProcs defaults to the number of CPUs if NULL.
+func extractArgs(urlSexp C.SEXP, outputType C.SEXP, nProcsSexp C.SEXP) (urls []string, output string, nProcs int, err error) {
+	if err := RUnmarshal(urlSexp, &urls); err != nil {
+		return nil, "", 0, argumentError("urls", err)
+	}
+	if err := RUnmarshal(outputType, &output); err != nil {
+		return nil, "", 0, argumentError("output", err)
+	}
+	nProcs = runtime.NumCPU()
 	if nProcsSexp != C.R_NilValue {
-		nProcs = int(C.asInteger(nProcsSexp))
+		if err := RUnmarshal(nProcsSexp, &nProcs); err != nil {
+			return nil, "", 0, argumentError("nProcs", err)
+		}
 	}
-	urls := GoString(urlSexp)
 	if nProcs < 1 {
-		log.Panicf("Aborted: nProcs must be >= 1")
+		return nil, "", 0, argumentError("nProcs", fmt.Errorf("must be >= 1, got %d", nProcs))
 	}
+	return urls, output, nProcs, nil
+}
 
-	ret := extractPackages(urls, GoString(outputType)[0], nProcs)
-
-	return RString(ret)
+//export goExtractPackages
+func goExtractPackages(urlSexp C.SEXP, outputType C.SEXP, nProcsSexp C.SEXP) C.SEXP {
+	return rCall(func() (C.SEXP, C.SEXP, error) {
+		urls, output, nProcs, err := extractArgs(urlSexp, outputType, nProcsSexp)
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, err
+		}
+		reasons := make([]string, len(urls))
+		ret := extractPackages(context.Background(), urls, output, nProcs, extractOptions{
+			// the dispatch loop runs on R's thread
+			Progress:  rConsole{},
+			Completed: func(i int, result string, reason string) { reasons[i] = reason },
+		})
+		if err := extractAborted(ret); err != nil {
+			return C.R_NilValue, C.R_NilValue, err
+		}
+		var failures []packageFailure
+		for i, reason := range reasons {
+			if reason != "" {
+				failures = append(failures, packageFailure{urls[i], packageNameFromURL(urls[i]), reason})
+			}
+		}
+		value := C.Rf_protect(RString(ret))
+		defer C.Rf_unprotect(1)
+		cond, err := packageFailures(value, failures, len(urls))
+		return value, cond, err
+	})
 }
@@ -0,0 +1,74 @@
+//go:build cgo
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportConditions(t *testing.T) {
+	if embeddedRErr != nil {
+		t.Skip(embeddedRErr)
+	}
+	var result struct {
+		Value     any `r:"value"`
+		Condition struct {
+			Message string `r:"message"`
+		} `r:"condition"`
+	}
+	extractFeatures := func(filename string, nProcs string, extractors string) {
+		filenameSEXP, err := REval(filename)
+		require.NoError(t, err)
+		rProtect(filenameSEXP)
+		nProcsSEXP, err := REval(nProcs)
+		require.NoError(t, err)
+		rProtect(nProcsSEXP)
+		extractorsSEXP, err := REval(extractors)
+		require.NoError(t, err)
+		rProtect(extractorsSEXP)
+		ret := goExtractFeatures(filenameSEXP, nProcsSEXP, extractorsSEXP)
+		rProtect(ret)
+		defer rUnprotect(4)
+		require.NoError(t, RUnmarshal(ret, &result))
+	}
+
+	extractFeatures(`"/nonexistent/output.json"`, "0L", "NULL")
+	assert.Nil(t, result.Value)
+	assert.Contains(t, result.Condition.Message, "nProcs: must be >= 1")
+
+	extractFeatures(`"/nonexistent/output.json"`, "1L", "NULL")
+	assert.Contains(t, result.Condition.Message, "no such file")
+
+	extractFeatures(`c("a", "b")`, "1L", "NULL")
+	assert.Contains(t, result.Condition.Message, "filename")
+
+	extractFeatures(`"/nonexistent/output.json"`, "1L", `c("words", "nonexistent")`)
+	assert.Contains(t, result.Condition.Message, "unknown feature extractor nonexistent")
+
+	_, err := REval(`stop("custom failure")`)
+	assert.ErrorContains(t, err, "custom failure")
+}
+
+func TestExtractJobNotJob(t *testing.T) {
+	if embeddedRErr != nil {
+		t.Skip(embeddedRErr)
+	}
+	notJob, err := REval(`"job"`)
+	require.NoError(t, err)
+	rProtect(notJob)
+	ret := goExtractJobStatus(notJob)
+	rProtect(ret)
+	defer rUnprotect(2)
+	var result struct {
+		Value     any `r:"value"`
+		Condition struct {
+			Message string `r:"message"`
+		} `r:"condition"`
+	}
+	require.NoError(t, RUnmarshal(ret, &result))
+	assert.Nil(t, result.Value)
+	assert.Contains(t, result.Condition.Message, "job: not an extraction job")
+}
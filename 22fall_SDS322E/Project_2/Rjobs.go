@@ -0,0 +1,120 @@
+//go:build cgo
+
+package main
+
+// #include <stdint.h>
+// #include <R.h>
+// #include <Rinternals.h>
+//
+// extern SEXP makeJobPointer(uintptr_t handle);
+// extern uintptr_t jobPointerHandle(SEXP ptr);
+import "C"
+import (
+	"errors"
+	"runtime/cgo"
+)
+
+// Extraction jobs are returned to R as external pointers of class
+// project2Job holding a cgo.Handle of the extractJob, see Rinterface.c. The
+// job is canceled and released when the pointer is garbage collected. The
+// progress of a job is printed to R's console whenever it is polled, since
+// its goroutines must not call R.
+
+// jobFromPointer returns the job of an external pointer made by
+// goStartExtractJob.
+func jobFromPointer(ptr C.SEXP) (*extractJob, error) {
+	h := C.jobPointerHandle(ptr)
+	if h == 0 {
+		return nil, argumentError("job", errors.New("not an extraction job, or released"))
+	}
+	return cgo.Handle(h).Value().(*extractJob), nil
+}
+
+// printProgress prints the progress the job wrote since it was last polled.
+func printProgress(job *extractJob) {
+	if progress := job.progress.flush(); progress != "" {
+		rConsole{}.Write([]byte(progress))
+	}
+}
+
+// goStartExtractJob starts extracting packages like goExtractPackages in the
+// background and returns the job.
+//
+//export goStartExtractJob
+func goStartExtractJob(urlSexp C.SEXP, outputType C.SEXP, nProcsSexp C.SEXP) C.SEXP {
+	return rCall(func() (C.SEXP, C.SEXP, error) {
+		urls, output, nProcs, err := extractArgs(urlSexp, outputType, nProcsSexp)
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, err
+		}
+		job := startExtractJob(urls, output, nProcs, extractOptions{})
+		return C.makeJobPointer(C.uintptr_t(cgo.NewHandle(job))), C.R_NilValue, nil
+	})
+}
+
+// goExtractJobStatus returns the status of a job as a named list, see
+// jobStatus.
+//
+//export goExtractJobStatus
+func goExtractJobStatus(jobSexp C.SEXP) C.SEXP {
+	return rCall(func() (C.SEXP, C.SEXP, error) {
+		job, err := jobFromPointer(jobSexp)
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, err
+		}
+		printProgress(job)
+		ret, err := RMarshal(job.status())
+		return ret, C.R_NilValue, err
+	})
+}
+
+// goExtractJobResults returns the results of a job so far like
+// goExtractPackages, NA for packages not written yet.
+//
+//export goExtractJobResults
+func goExtractJobResults(jobSexp C.SEXP) C.SEXP {
+	return rCall(func() (C.SEXP, C.SEXP, error) {
+		job, err := jobFromPointer(jobSexp)
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, err
+		}
+		printProgress(job)
+		results, failures := job.results()
+		value, err := RMarshal(results)
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, err
+		}
+		C.Rf_protect(value)
+		defer C.Rf_unprotect(1)
+		cond, err := packageFailures(value, failures, len(results))
+		return value, cond, err
+	})
+}
+
+// goCancelExtractJob cancels a job, waits for its packages in flight to be
+// abandoned and returns its status.
+//
+//export goCancelExtractJob
+func goCancelExtractJob(jobSexp C.SEXP) C.SEXP {
+	return rCall(func() (C.SEXP, C.SEXP, error) {
+		job, err := jobFromPointer(jobSexp)
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, err
+		}
+		job.stop()
+		job.wait()
+		printProgress(job)
+		ret, err := RMarshal(job.status())
+		return ret, C.R_NilValue, err
+	})
+}
+
+// goReleaseJob cancels a job without waiting for it and releases its handle,
+// when its external pointer is garbage collected.
+//
+//export goReleaseJob
+func goReleaseJob(handle C.uintptr_t) {
+	h := cgo.Handle(handle)
+	h.Value().(*extractJob).stop()
+	h.Delete()
+}
@@ -0,0 +1,782 @@
+//go:build cgo
+
+package main
+
+// #include <R.h>
+// #include <Rinternals.h>
+import "C"
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Go values are marshaled to R objects as:
+//
+//	bool                   logical
+//	intN, uintN            integer; values an R integer cannot hold are an error
+//	floatN                 double; NaN and ±Inf become NA
+//	string                 character
+//	time.Time              POSIXct in UTC; the zero time becomes NA
+//	time.Duration          difftime in seconds
+//	[]byte                 raw
+//	slices and arrays      a vector of the element type, a data.frame with a
+//	                       column per field for structs, otherwise a list
+//	struct                 named list with an element per exported field
+//	map[string]T           named list ordered by key
+//	pointer                the value pointed to; nil becomes NA, or NULL if it
+//	                       points to a list
+//	nil slice, map or any  NULL
+//
+// Fields are named by their r tag, otherwise by their Go name. `r:"-"` skips
+// a field and `r:"name,factor"` makes a string field a factor.
+//
+// RUnmarshal converts the other way. Numbers convert between integer and
+// double as long as they fit, factors convert to strings, and NA can only be
+// stored in floats (as NaN) and pointers (as nil).
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// vectorType returns the type of the R vector holding values of t, NILSXP if
+// t is not a scalar.
+func vectorType(t reflect.Type) C.SEXPTYPE {
+	switch t {
+	case timeType, durationType:
+		return C.REALSXP
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return C.LGLSXP
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return C.INTSXP
+	case reflect.Float32, reflect.Float64:
+		return C.REALSXP
+	case reflect.String:
+		return C.STRSXP
+	case reflect.Pointer:
+		return vectorType(t.Elem())
+	}
+	return C.NILSXP
+}
+
+// derefType returns the type t points to, t if it is not a pointer.
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// isRecord reports whether t is a struct, or a pointer to one, marshaled as a
+// data.frame row.
+func isRecord(t reflect.Type) bool {
+	t = derefType(t)
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+type rField struct {
+	index  []int
+	name   string
+	factor bool
+}
+
+// rFields returns the marshaled fields of a struct type. The fields of
+// untagged embedded structs are promoted, as by encoding/json.
+func rFields(t reflect.Type) []rField {
+	var fields []rField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("r"), ",")
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && name == "" {
+			for _, promoted := range rFields(f.Type) {
+				promoted.index = append([]int{i}, promoted.index...)
+				fields = append(fields, promoted)
+			}
+			continue
+		}
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, rField{index: []int{i}, name: name, factor: opts == "factor"})
+	}
+	return fields
+}
+
+// RMarshal converts a Go value to an R object. The result is not protected.
+func RMarshal(v any) (C.SEXP, error) {
+	return marshalValue(reflect.ValueOf(v), false)
+}
+
+func marshalValue(v reflect.Value, factor bool) (C.SEXP, error) {
+	if !v.IsValid() {
+		return C.R_NilValue, nil
+	}
+	t := v.Type()
+	if vectorType(t) != C.NILSXP {
+		scalar := reflect.New(reflect.ArrayOf(1, t)).Elem()
+		scalar.Index(0).Set(v)
+		return marshalVector(scalar, factor)
+	}
+	switch t.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return C.R_NilValue, nil
+		}
+		return marshalValue(v.Elem(), factor)
+	case reflect.Slice:
+		if v.IsNil() {
+			return C.R_NilValue, nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return marshalRaw(v.Bytes()), nil
+		}
+		fallthrough
+	case reflect.Array:
+		switch {
+		case vectorType(t.Elem()) != C.NILSXP:
+			return marshalVector(v, factor)
+		case isRecord(t.Elem()):
+			return marshalDataFrame(v)
+		}
+		return marshalList(v)
+	case reflect.Struct:
+		return marshalStruct(v)
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			if v.IsNil() {
+				return C.R_NilValue, nil
+			}
+			return marshalMap(v)
+		}
+	}
+	return C.R_NilValue, fmt.Errorf("cannot marshal %s to R", t)
+}
+
+// marshalVector converts a slice or array of scalars to an R vector.
+func marshalVector(v reflect.Value, factor bool) (C.SEXP, error) {
+	elem := v.Type().Elem()
+	typ := vectorType(elem)
+	if factor && typ == C.STRSXP {
+		return marshalFactor(v), nil
+	}
+	n := v.Len()
+	vec := C.Rf_protect(C.allocVector(typ, C.R_xlen_t(n)))
+	defer C.Rf_unprotect(1)
+	switch typ {
+	case C.LGLSXP:
+		out := unsafe.Slice(C.LOGICAL(vec), n)
+		for i := range out {
+			out[i] = C.R_NaInt
+			if e, ok := deref(v.Index(i)); ok {
+				out[i] = 0
+				if e.Bool() {
+					out[i] = 1
+				}
+			}
+		}
+	case C.INTSXP:
+		out := unsafe.Slice(C.INTEGER(vec), n)
+		for i := range out {
+			out[i] = C.R_NaInt
+			if e, ok := deref(v.Index(i)); ok {
+				x, err := rInteger(e)
+				if err != nil {
+					return C.R_NilValue, err
+				}
+				out[i] = x
+			}
+		}
+	case C.REALSXP:
+		out := unsafe.Slice(C.REAL(vec), n)
+		for i := range out {
+			out[i] = C.R_NaReal
+			if e, ok := deref(v.Index(i)); ok {
+				out[i] = rReal(e)
+			}
+		}
+	case C.STRSXP:
+		for i := 0; i < n; i++ {
+			str := C.R_NaString
+			if e, ok := deref(v.Index(i)); ok {
+				str = mkChar(e.String())
+			}
+			C.SET_STRING_ELT(vec, C.R_xlen_t(i), str)
+		}
+	}
+	switch derefType(elem) {
+	case timeType:
+		setAttr(vec, "class", RString([]string{"POSIXct", "POSIXt"}))
+		setAttr(vec, "tzone", RString([]string{"UTC"}))
+	case durationType:
+		setAttr(vec, "class", RString([]string{"difftime"}))
+		setAttr(vec, "units", RString([]string{"secs"}))
+	}
+	return vec, nil
+}
+
+// deref follows the pointers of v, returning false for a nil one.
+func deref(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+func rInteger(v reflect.Value) (C.int, error) {
+	var x int64
+	if v.CanUint() {
+		if v.Uint() > math.MaxInt32 {
+			return C.R_NaInt, fmt.Errorf("%d overflows an R integer", v.Uint())
+		}
+		x = int64(v.Uint())
+	} else {
+		x = v.Int()
+	}
+	// the smallest int32 is NA in R
+	if x > math.MaxInt32 || x <= math.MinInt32 {
+		return C.R_NaInt, fmt.Errorf("%d overflows an R integer", x)
+	}
+	return C.int(x), nil
+}
+
+func rReal(v reflect.Value) C.double {
+	var x float64
+	switch v.Type() {
+	case timeType:
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return C.R_NaReal
+		}
+		x = float64(t.UnixNano()) / 1e9
+	case durationType:
+		x = time.Duration(v.Int()).Seconds()
+	default:
+		x = v.Float()
+	}
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return C.R_NaReal
+	}
+	return C.double(x)
+}
+
+func mkChar(s string) C.SEXP {
+	str := C.CString(s)
+	defer C.free(unsafe.Pointer(str))
+	return C.Rf_mkCharCE(str, C.CE_UTF8)
+}
+
+// getAttr returns the attribute name of x.
+func getAttr(x C.SEXP, name string) C.SEXP {
+	nameStr := C.CString(name)
+	defer C.free(unsafe.Pointer(nameStr))
+	return C.Rf_getAttrib(x, C.Rf_install(nameStr))
+}
+
+// setAttr sets the attribute name of x to val.
+func setAttr(x C.SEXP, name string, val C.SEXP) {
+	C.Rf_protect(val)
+	defer C.Rf_unprotect(1)
+	nameStr := C.CString(name)
+	defer C.free(unsafe.Pointer(nameStr))
+	C.Rf_setAttrib(x, C.Rf_install(nameStr), val)
+}
+
+// marshalFactor converts strings to a factor with sorted levels.
+func marshalFactor(v reflect.Value) C.SEXP {
+	n := v.Len()
+	index := make(map[string]int)
+	var levels []string
+	for i := 0; i < n; i++ {
+		if e, ok := deref(v.Index(i)); ok {
+			if _, ok := index[e.String()]; !ok {
+				index[e.String()] = 0
+				levels = append(levels, e.String())
+			}
+		}
+	}
+	sort.Strings(levels)
+	for i, level := range levels {
+		index[level] = i + 1
+	}
+	codes := C.Rf_protect(C.allocVector(C.INTSXP, C.R_xlen_t(n)))
+	defer C.Rf_unprotect(1)
+	out := unsafe.Slice(C.INTEGER(codes), n)
+	for i := range out {
+		out[i] = C.R_NaInt
+		if e, ok := deref(v.Index(i)); ok {
+			out[i] = C.int(index[e.String()])
+		}
+	}
+	setAttr(codes, "levels", RString(levels))
+	setAttr(codes, "class", RString([]string{"factor"}))
+	return codes
+}
+
+func marshalRaw(b []byte) C.SEXP {
+	vec := C.allocVector(C.RAWSXP, C.R_xlen_t(len(b)))
+	out := unsafe.Slice(C.RAW(vec), len(b))
+	for i, x := range b {
+		out[i] = C.Rbyte(x)
+	}
+	return vec
+}
+
+// marshalList converts the elements of a slice or array to a list.
+func marshalList(v reflect.Value) (C.SEXP, error) {
+	list := C.Rf_protect(C.allocVector(C.VECSXP, C.R_xlen_t(v.Len())))
+	defer C.Rf_unprotect(1)
+	for i := 0; i < v.Len(); i++ {
+		elem, err := marshalValue(v.Index(i), false)
+		if err != nil {
+			return C.R_NilValue, err
+		}
+		C.SET_VECTOR_ELT(list, C.R_xlen_t(i), elem)
+	}
+	return list, nil
+}
+
+func marshalStruct(v reflect.Value) (C.SEXP, error) {
+	fields := rFields(v.Type())
+	list := C.Rf_protect(C.allocVector(C.VECSXP, C.R_xlen_t(len(fields))))
+	defer C.Rf_unprotect(1)
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		elem, err := marshalValue(v.FieldByIndex(f.index), f.factor)
+		if err != nil {
+			return C.R_NilValue, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		C.SET_VECTOR_ELT(list, C.R_xlen_t(i), elem)
+		names[i] = f.name
+	}
+	setAttr(list, "names", RString(names))
+	return list, nil
+}
+
+func marshalMap(v reflect.Value) (C.SEXP, error) {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	list := C.Rf_protect(C.allocVector(C.VECSXP, C.R_xlen_t(len(keys))))
+	defer C.Rf_unprotect(1)
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		elem, err := marshalValue(v.MapIndex(key), false)
+		if err != nil {
+			return C.R_NilValue, fmt.Errorf("key %s: %w", key.String(), err)
+		}
+		C.SET_VECTOR_ELT(list, C.R_xlen_t(i), elem)
+		names[i] = key.String()
+	}
+	setAttr(list, "names", RString(names))
+	return list, nil
+}
+
+// marshalDataFrame converts a slice or array of structs to a data.frame with a
+// column per field. Fields of nil rows are NA.
+func marshalDataFrame(v reflect.Value) (C.SEXP, error) {
+	st := derefType(v.Type().Elem())
+	fields := rFields(st)
+	n := v.Len()
+	df := C.Rf_protect(C.allocVector(C.VECSXP, C.R_xlen_t(len(fields))))
+	defer C.Rf_unprotect(1)
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		ft := st.FieldByIndex(f.index).Type
+		col := reflect.MakeSlice(reflect.SliceOf(reflect.PointerTo(ft)), n, n)
+		for j := 0; j < n; j++ {
+			if row, ok := deref(v.Index(j)); ok {
+				p := reflect.New(ft)
+				p.Elem().Set(row.FieldByIndex(f.index))
+				col.Index(j).Set(p)
+			}
+		}
+		var vec C.SEXP
+		var err error
+		if vectorType(ft) != C.NILSXP {
+			vec, err = marshalVector(col, f.factor)
+		} else {
+			vec, err = marshalList(col)
+		}
+		if err != nil {
+			return C.R_NilValue, fmt.Errorf("column %s: %w", f.name, err)
+		}
+		C.SET_VECTOR_ELT(df, C.R_xlen_t(i), vec)
+		names[i] = f.name
+	}
+	setDataFrameAttrs(df, names, n)
+	return df, nil
+}
+
+// setDataFrameAttrs makes a list of columns a data.frame with n rows.
+func setDataFrameAttrs(df C.SEXP, names []string, n int) {
+	C.Rf_setAttrib(df, C.R_NamesSymbol, C.Rf_protect(RString(names)))
+	// compact row names c(NA, -n), as data.frame() creates them
+	rowNames := C.Rf_protect(C.allocVector(C.INTSXP, 2))
+	compact := unsafe.Slice(C.INTEGER(rowNames), 2)
+	compact[0], compact[1] = C.R_NaInt, C.int(-n)
+	C.Rf_setAttrib(df, C.R_RowNamesSymbol, rowNames)
+	C.Rf_setAttrib(df, C.R_ClassSymbol, C.Rf_protect(RString([]string{"data.frame"})))
+	C.Rf_unprotect(3)
+}
+
+// RUnmarshal stores an R object in the value v points to, as described for
+// RMarshal.
+func RUnmarshal(x C.SEXP, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cannot unmarshal R object into %T", v)
+	}
+	return unmarshalValue(x, rv.Elem())
+}
+
+func unmarshalValue(x C.SEXP, v reflect.Value) error {
+	t := v.Type()
+	if vectorType(t) != C.NILSXP {
+		if t.Kind() == reflect.Pointer && x == C.R_NilValue {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if n := int(C.Rf_xlength(x)); n != 1 {
+			return fmt.Errorf("cannot unmarshal R object of length %d into %s", n, t)
+		}
+		return unmarshalElement(x, 0, v)
+	}
+	if x == C.R_NilValue {
+		v.Set(reflect.Zero(t))
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		p := reflect.New(t.Elem())
+		if err := unmarshalValue(x, p.Elem()); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			break
+		}
+		nt := naturalType(x)
+		if nt.Kind() == reflect.Interface {
+			return fmt.Errorf("cannot unmarshal %s into %s", typeName(x), t)
+		}
+		natural := reflect.New(nt).Elem()
+		if err := unmarshalValue(x, natural); err != nil {
+			return err
+		}
+		v.Set(natural)
+		return nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && C.TYPEOF(x) == C.RAWSXP {
+			b := unsafe.Slice(C.RAW(x), int(C.Rf_xlength(x)))
+			out := make([]byte, len(b))
+			for i, c := range b {
+				out[i] = byte(c)
+			}
+			v.SetBytes(out)
+			return nil
+		}
+		if C.Rf_isFrame(x) != 0 && isRecord(t.Elem()) {
+			return unmarshalDataFrame(x, v)
+		}
+		n := int(C.Rf_xlength(x))
+		s := reflect.MakeSlice(t, n, n)
+		for i := 0; i < n; i++ {
+			if err := unmarshalElement(x, i, s.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %w", i+1, err)
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Array:
+		if n := int(C.Rf_xlength(x)); n != v.Len() {
+			return fmt.Errorf("cannot unmarshal R object of length %d into %s", n, t)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := unmarshalElement(x, i, v.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %w", i+1, err)
+			}
+		}
+		return nil
+	case reflect.Struct:
+		names := rNames(x)
+		for _, f := range rFields(t) {
+			if i, ok := names[f.name]; ok {
+				if err := unmarshalElement(x, i, v.FieldByIndex(f.index)); err != nil {
+					return fmt.Errorf("field %s: %w", f.name, err)
+				}
+			}
+		}
+		return nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			break
+		}
+		m := reflect.MakeMap(t)
+		for name, i := range rNames(x) {
+			elem := reflect.New(t.Elem()).Elem()
+			if err := unmarshalElement(x, i, elem); err != nil {
+				return fmt.Errorf("element %s: %w", name, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(name).Convert(t.Key()), elem)
+		}
+		v.Set(m)
+		return nil
+	}
+	return fmt.Errorf("cannot unmarshal R object into %s", t)
+}
+
+// rNames returns the index of each name of x.
+func rNames(x C.SEXP) map[string]int {
+	names := C.Rf_getAttrib(x, C.R_NamesSymbol)
+	index := make(map[string]int)
+	if names == C.R_NilValue {
+		return index
+	}
+	for i, name := range GoString(names) {
+		if _, ok := index[name]; !ok && name != "" {
+			index[name] = i
+		}
+	}
+	return index
+}
+
+// unmarshalElement stores element i of x in v.
+func unmarshalElement(x C.SEXP, i int, v reflect.Value) error {
+	if C.TYPEOF(x) == C.VECSXP {
+		return unmarshalValue(C.VECTOR_ELT(x, C.R_xlen_t(i)), v)
+	}
+	t := v.Type()
+	if vectorType(t) == C.NILSXP {
+		return fmt.Errorf("cannot unmarshal an element of an atomic vector into %s", t)
+	}
+	if t.Kind() == reflect.Pointer {
+		if isNA(x, i) {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		p := reflect.New(t.Elem())
+		if err := unmarshalElement(x, i, p.Elem()); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	switch t {
+	case timeType:
+		secs, err := realElt(x, i)
+		if err != nil {
+			return err
+		}
+		if math.IsNaN(secs) {
+			v.Set(reflect.Zero(t))
+		} else {
+			v.Set(reflect.ValueOf(time.Unix(0, int64(math.Round(secs*1e9))).UTC()))
+		}
+		return nil
+	case durationType:
+		secs, err := realElt(x, i)
+		if err != nil {
+			return err
+		}
+		if math.IsNaN(secs) {
+			return fmt.Errorf("cannot unmarshal NA into %s", t)
+		}
+		scale := 1.0
+		if units := getAttr(x, "units"); C.TYPEOF(units) == C.STRSXP && C.Rf_xlength(units) == 1 {
+			var ok bool
+			if scale, ok = difftimeUnits[GoString(units)[0]]; !ok {
+				return fmt.Errorf("unknown difftime units %s", GoString(units)[0])
+			}
+		}
+		v.SetInt(int64(math.Round(secs * scale * float64(time.Second))))
+		return nil
+	}
+	if isNA(x, i) && !v.CanFloat() {
+		return fmt.Errorf("cannot unmarshal NA into %s", t)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if C.TYPEOF(x) != C.LGLSXP {
+			return fmt.Errorf("cannot unmarshal %s into %s", typeName(x), t)
+		}
+		v.SetBool(C.LOGICAL_ELT(x, C.R_xlen_t(i)) != 0)
+	case reflect.Float32, reflect.Float64:
+		f, err := realElt(x, i)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		s, err := stringElt(x, i)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	default:
+		f, err := realElt(x, i)
+		if err != nil {
+			return err
+		}
+		if f != math.Trunc(f) {
+			return fmt.Errorf("cannot unmarshal %g into %s", f, t)
+		}
+		if v.CanUint() {
+			if f < 0 || v.OverflowUint(uint64(f)) {
+				return fmt.Errorf("%g overflows %s", f, t)
+			}
+			v.SetUint(uint64(f))
+		} else {
+			if v.OverflowInt(int64(f)) {
+				return fmt.Errorf("%g overflows %s", f, t)
+			}
+			v.SetInt(int64(f))
+		}
+	}
+	return nil
+}
+
+// difftimeUnits are the seconds in each unit of a difftime.
+var difftimeUnits = map[string]float64{"secs": 1, "mins": 60, "hours": 3600, "days": 86400, "weeks": 604800}
+
+func isNA(x C.SEXP, i int) bool {
+	switch C.TYPEOF(x) {
+	case C.LGLSXP:
+		return C.LOGICAL_ELT(x, C.R_xlen_t(i)) == C.R_NaInt
+	case C.INTSXP:
+		return C.INTEGER_ELT(x, C.R_xlen_t(i)) == C.R_NaInt
+	case C.REALSXP:
+		return math.IsNaN(float64(C.REAL_ELT(x, C.R_xlen_t(i))))
+	case C.STRSXP:
+		return C.STRING_ELT(x, C.R_xlen_t(i)) == C.R_NaString
+	}
+	return false
+}
+
+// realElt returns element i of a numeric vector, NaN for NA.
+func realElt(x C.SEXP, i int) (float64, error) {
+	if isNA(x, i) {
+		return math.NaN(), nil
+	}
+	switch C.TYPEOF(x) {
+	case C.REALSXP:
+		return float64(C.REAL_ELT(x, C.R_xlen_t(i))), nil
+	case C.INTSXP:
+		if C.Rf_isFactor(x) == 0 {
+			return float64(C.INTEGER_ELT(x, C.R_xlen_t(i))), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot unmarshal %s into a number", typeName(x))
+}
+
+// stringElt returns element i of a character vector or factor.
+func stringElt(x C.SEXP, i int) (string, error) {
+	switch {
+	case C.TYPEOF(x) == C.STRSXP:
+		return C.GoString(C.R_CHAR(C.STRING_ELT(x, C.R_xlen_t(i)))), nil
+	case C.Rf_isFactor(x) != 0:
+		levels := C.Rf_getAttrib(x, C.R_LevelsSymbol)
+		code := int(C.INTEGER_ELT(x, C.R_xlen_t(i)))
+		return C.GoString(C.R_CHAR(C.STRING_ELT(levels, C.R_xlen_t(code-1)))), nil
+	}
+	return "", fmt.Errorf("cannot unmarshal %s into a string", typeName(x))
+}
+
+func typeName(x C.SEXP) string {
+	return C.GoString(C.Rf_type2char(C.SEXPTYPE(C.TYPEOF(x))))
+}
+
+// unmarshalDataFrame stores the rows of a data.frame in a slice of structs,
+// matching columns to fields by name.
+func unmarshalDataFrame(x C.SEXP, v reflect.Value) error {
+	t := v.Type()
+	st := derefType(t.Elem())
+	n := 0
+	if C.Rf_xlength(x) > 0 {
+		n = int(C.Rf_xlength(C.VECTOR_ELT(x, 0)))
+	}
+	rows := reflect.MakeSlice(t, n, n)
+	for i := 0; i < n; i++ {
+		row := rows.Index(i)
+		for row.Kind() == reflect.Pointer {
+			row.Set(reflect.New(row.Type().Elem()))
+			row = row.Elem()
+		}
+	}
+	names := rNames(x)
+	for _, f := range rFields(st) {
+		col, ok := names[f.name]
+		if !ok {
+			continue
+		}
+		colSEXP := C.VECTOR_ELT(x, C.R_xlen_t(col))
+		for i := 0; i < n; i++ {
+			row, _ := deref(rows.Index(i))
+			if err := unmarshalElement(colSEXP, i, row.FieldByIndex(f.index)); err != nil {
+				return fmt.Errorf("row %d, column %s: %w", i+1, f.name, err)
+			}
+		}
+	}
+	v.Set(rows)
+	return nil
+}
+
+// naturalType returns the Go type an R object is unmarshaled as into an empty
+// interface: a scalar for length-1 atomic vectors, a slice for longer ones,
+// map[string]any for named lists and data.frames and []any for other lists.
+func naturalType(x C.SEXP) reflect.Type {
+	var t reflect.Type
+	switch C.TYPEOF(x) {
+	case C.LGLSXP:
+		t = reflect.TypeOf(false)
+	case C.INTSXP:
+		t = reflect.TypeOf(0)
+		if C.Rf_isFactor(x) != 0 {
+			t = reflect.TypeOf("")
+		}
+	case C.REALSXP:
+		t = reflect.TypeOf(0.0)
+		if inherits(x, "POSIXct") {
+			t = timeType
+		} else if inherits(x, "difftime") {
+			t = durationType
+		}
+	case C.STRSXP:
+		t = reflect.TypeOf("")
+	case C.RAWSXP:
+		return reflect.TypeOf([]byte(nil))
+	case C.VECSXP:
+		if C.Rf_getAttrib(x, C.R_NamesSymbol) != C.R_NilValue {
+			return reflect.TypeOf(map[string]any(nil))
+		}
+		return reflect.TypeOf([]any(nil))
+	default:
+		return reflect.TypeOf((*any)(nil)).Elem()
+	}
+	if C.Rf_xlength(x) == 1 {
+		return t
+	}
+	return reflect.SliceOf(t)
+}
+
+func inherits(x C.SEXP, class string) bool {
+	classStr := C.CString(class)
+	defer C.free(unsafe.Pointer(classStr))
+	return C.Rf_inherits(x, classStr) != 0
+}
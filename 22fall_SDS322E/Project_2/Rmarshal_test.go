@@ -0,0 +1,127 @@
+//go:build cgo
+
+package main
+
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var embeddedRErr error
+
+func TestMain(m *testing.M) {
+	embeddedRErr = StartEmbeddedR()
+	os.Exit(m.Run())
+}
+
+// assertMarshal checks that v marshals to the value of the R code want.
+func assertMarshal(t *testing.T, v any, want string) {
+	t.Helper()
+	got, err := RMarshal(v)
+	require.NoError(t, err)
+	rProtect(got)
+	defer rUnprotect(1)
+	wantSEXP, err := REval(want)
+	require.NoError(t, err)
+	if !RIdentical(got, wantSEXP) {
+		RPrint(got)
+		t.Errorf("marshaled %#v is not identical to %s", v, want)
+	}
+}
+
+// unmarshal unmarshals the value of the R code into v.
+func unmarshal(t *testing.T, code string, v any) error {
+	t.Helper()
+	x, err := REval(code)
+	require.NoError(t, err)
+	rProtect(x)
+	defer rUnprotect(1)
+	return RUnmarshal(x, v)
+}
+
+type marshalRow struct {
+	Name   string `r:"name"`
+	Count  *int   `r:"count"`
+	Kind   string `r:"kind,factor"`
+	Skip   string `r:"-"`
+	hidden int
+}
+
+func TestRMarshal(t *testing.T) {
+	if embeddedRErr != nil {
+		t.Skip(embeddedRErr)
+	}
+	one := 1
+	assertMarshal(t, nil, "NULL")
+	assertMarshal(t, true, "TRUE")
+	assertMarshal(t, uint16(7), "7L")
+	assertMarshal(t, []float32{1.5, float32(math.NaN()), float32(math.Inf(1))}, "c(1.5, NA, NA)")
+	assertMarshal(t, []*int{&one, nil}, "c(1L, NA)")
+	assertMarshal(t, []byte("hi"), "as.raw(c(0x68, 0x69))")
+	assertMarshal(t, time.Unix(86400, 0), `as.POSIXct(86400, origin = "1970-01-01", tz = "UTC")`)
+	assertMarshal(t, 90*time.Second, `as.difftime(90, units = "secs")`)
+	assertMarshal(t, map[string]any{"b": "x", "a": []int{1, 2}}, `list(a = 1:2, b = "x")`)
+	assertMarshal(t, marshalRow{Name: "foo", Kind: "s3"}, `list(name = "foo", count = NA_integer_, kind = factor("s3"))`)
+	assertMarshal(t, []marshalRow{{Name: "foo", Count: &one, Kind: "s4"}, {Name: "bar", Kind: "s3"}},
+		`data.frame(name = c("foo", "bar"), count = c(1L, NA), kind = factor(c("s4", "s3")), stringsAsFactors = FALSE)`)
+	// fields of embedded structs are promoted
+	assertMarshal(t, []dependencyRow{{packageKey{Package: "foo", Version: "1.0"}, "Imports", "bar"}},
+		`data.frame(package = "foo", version = "1.0", kind = factor("Imports"), name = "bar", stringsAsFactors = FALSE)`)
+
+	_, err := RMarshal(int64(math.MaxInt32) + 1)
+	assert.Error(t, err)
+	_, err = RMarshal(make(chan int))
+	assert.Error(t, err)
+}
+
+func TestRUnmarshal(t *testing.T) {
+	if embeddedRErr != nil {
+		t.Skip(embeddedRErr)
+	}
+	var n int
+	assert.NoError(t, unmarshal(t, "3", &n))
+	assert.Equal(t, 3, n)
+	assert.Error(t, unmarshal(t, "3.5", &n))
+	assert.Error(t, unmarshal(t, "NA_integer_", &n))
+
+	var counts []*int
+	assert.NoError(t, unmarshal(t, "c(1L, NA)", &counts))
+	if assert.Len(t, counts, 2) {
+		assert.Equal(t, 1, *counts[0])
+		assert.Nil(t, counts[1])
+	}
+
+	var f float64
+	assert.NoError(t, unmarshal(t, "NA_real_", &f))
+	assert.True(t, math.IsNaN(f))
+
+	var names []string
+	assert.NoError(t, unmarshal(t, `factor(c("b", "a", "b"))`, &names))
+	assert.Equal(t, []string{"b", "a", "b"}, names)
+
+	var when time.Time
+	assert.NoError(t, unmarshal(t, `as.POSIXct("2022-10-01 12:00:00", tz = "UTC")`, &when))
+	assert.Equal(t, time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC), when)
+
+	var d time.Duration
+	assert.NoError(t, unmarshal(t, `as.difftime(2, units = "mins")`, &d))
+	assert.Equal(t, 2*time.Minute, d)
+
+	var rows []marshalRow
+	assert.NoError(t, unmarshal(t, `data.frame(name = c("foo", "bar"), count = c(1, NA), kind = c("s4", "s3"))`, &rows))
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "bar", rows[1].Name)
+		assert.Equal(t, 1, *rows[0].Count)
+		assert.Nil(t, rows[1].Count)
+		assert.Equal(t, "s3", rows[1].Kind)
+	}
+
+	var m map[string]any
+	assert.NoError(t, unmarshal(t, `list(a = 1L, b = c("x", "y"), c = list(TRUE))`, &m))
+	assert.Equal(t, map[string]any{"a": 1, "b": []string{"x", "y"}, "c": []any{true}}, m)
+}
@@ -0,0 +1,92 @@
+// Package analyzer parses R packages and extracts their features. It reports
+// failures as errors and never exits or panics, so it can be embedded in other
+// programs:
+//
+//	p, err := analyzer.Analyze(ctx, "https://cran.r-project.org/src/contrib/Archive/foo/foo_1.0.tar.gz", analyzer.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	f, err := analyzer.Features(p, analyzer.FeatureOptions{})
+//
+// Parsing R code needs Rscript with the dplyr package.
+package analyzer
+
+import (
+	"Project2/feature"
+	"Project2/model"
+	"Project2/rparse"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Options are the settings of a Parser.
+type Options struct {
+	// Matchers are run on every R file, all of matcher.Default if nil
+	Matchers []rparse.MatcherSpec
+	// Limits bound fetching and reading each package, DefaultLimits if nil
+	Limits *Limits
+	// Rscript is the Rscript executable, "Rscript" from the PATH if empty
+	Rscript string
+	// Observer is notified of downloads and parses if not nil
+	Observer Observer
+}
+
+// Observer is notified of the downloads and parses of a Parser, e.g. to
+// export metrics.
+// It must be safe for concurrent use if shared by parsers.
+type Observer interface {
+	// Fetched is called when the response headers arrived after d
+	Fetched(d time.Duration)
+	// Downloaded is called for every n bytes of a response body read
+	Downloaded(n int)
+	// Parsed is called after a package was parsed with the time d spent
+	// parsing its R files and running the matchers, not reading them
+	Parsed(d time.Duration)
+}
+
+type observedReader struct {
+	r        io.Reader
+	observer Observer
+}
+
+func (o *observedReader) Read(b []byte) (int, error) {
+	n, err := o.r.Read(b)
+	o.observer.Downloaded(n)
+	return n, err
+}
+
+// Analyze parses a single package with a new Parser. Use a Parser to analyze
+// many packages with the same R process.
+func Analyze(ctx context.Context, source string, opts Options) (*model.P, error) {
+	p, err := NewParser(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+	return p.Analyze(ctx, source)
+}
+
+// FeatureOptions are the settings of Features.
+type FeatureOptions struct {
+	// Repos classifies package sources, feature.Repos if nil
+	Repos *feature.RepoRegistry
+	// Extractors compute the features, all of feature.Default if nil
+	Extractors []feature.Extractor
+}
+
+// Features extracts the features of a parsed package.
+func Features(p *model.P, opts FeatureOptions) (f *model.F, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, err = nil, fmt.Errorf("extracting features of %s: %v", p.Description.Package, r)
+		}
+	}()
+	f = feature.Extract(p, opts.Extractors)
+	if opts.Repos != nil && !f.Missing["repo"] {
+		source := feature.PackageSource(p, opts.Repos)
+		f.Repo, f.RepoBranch, f.RepoSection, f.RepoOrigin = source.Repo, source.Branch, source.Section, source.Origin
+	}
+	return f, nil
+}
@@ -0,0 +1,47 @@
+package analyzer
+
+import (
+	"Project2/feature"
+	"Project2/model"
+	"archive/tar"
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeWithoutR(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "Rscript")
+	_, err := Analyze(context.Background(), "foo_1.0.tar.gz", Options{Rscript: missing})
+	assert.Error(t, err)
+
+	// a NAMESPACE that cannot be parsed is a parse error, not a panic
+	tarball := makeTarball(t, []tar.Header{{Name: "foo/DESCRIPTION"}, {Name: "foo/NAMESPACE", Size: 10}})
+	parser := &Parser{rscript: missing}
+	assert.NoError(t, parser.parseProjectArchive(context.Background(), bytes.NewReader(tarball)))
+	p := parser.GetParseResult()
+	if assert.Len(t, p.ParseError, 1) {
+		assert.Equal(t, "NAMESPACE", p.ParseError[0].Stage)
+		assert.Equal(t, "foo/NAMESPACE", p.ParseError[0].File)
+		assert.Empty(t, p.ParseError[0].Stack)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	p := model.NewP()
+	p.URL = "https://example.org/src/foo_1.0.tar.gz"
+	p.Description.Package = "foo"
+	p.Description.Version = "1.0"
+	f, err := Features(p, FeatureOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", f.Package)
+	assert.Equal(t, feature.RepoOther, f.Repo)
+
+	repos := new(feature.RepoRegistry)
+	assert.NoError(t, repos.Add("example", `^https://example\.org/`))
+	f, err = Features(p, FeatureOptions{Repos: repos})
+	assert.NoError(t, err)
+	assert.Equal(t, "example", f.Repo)
+}
@@ -0,0 +1,139 @@
+package analyzer
+
+import (
+	"Project2/model"
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// GitPrefix marks package sources in a local git repository, written
+// git:<path>[@<revision>]. The path can be a working tree or a bare repository
+// and the revision a branch, tag or commit, HEAD by default.
+const GitPrefix = "git:"
+
+// SplitGitSource splits a git source into the repository path and revision.
+// The revision is split off at the last '@' after an existing path, so that
+// it can contain slashes, e.g. release/1.0. If there is none, it is split off
+// at an '@' after the last slash.
+func SplitGitSource(source string) (path string, revision string) {
+	path = strings.TrimPrefix(source, GitPrefix)
+	if _, err := os.Stat(path); err == nil {
+		return path, "HEAD"
+	}
+	for i := strings.LastIndexByte(path, '@'); i > 0; i = strings.LastIndexByte(path[:i], '@') {
+		if _, err := os.Stat(path[:i]); err == nil {
+			return path[:i], path[i+1:]
+		}
+	}
+	if i := strings.LastIndexByte(path, '@'); i > strings.LastIndexByte(path, '/') {
+		return path[:i], path[i+1:]
+	}
+	return path, "HEAD"
+}
+
+func openGitRepo(path string) (*git.Repository, error) {
+	return git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+}
+
+// ParseProjectGit parses the package at the root of a git repository at a revision.
+// Uncommitted changes in a working tree are not seen.
+func (p *Parser) ParseProjectGit(ctx context.Context, source string) error {
+	path, revision := SplitGitSource(source)
+	repo, err := openGitRepo(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return fmt.Errorf("%s: %w", revision, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	pkgDir := strings.TrimSuffix(filepath.Base(abs), ".git")
+
+	files := tree.Files()
+	defer files.Close()
+	var current io.ReadCloser
+	err = p.parseProjectFiles(ctx, func() (projectEntry, error) {
+		if current != nil {
+			current.Close()
+			current = nil
+		}
+		var file *object.File
+		for {
+			var err error
+			if file, err = files.Next(); err != nil {
+				return projectEntry{}, err
+			}
+			// skip submodules
+			if file.Mode != filemode.Submodule {
+				break
+			}
+		}
+		entry := projectEntry{Name: pkgDir + "/" + file.Name, Type: tar.TypeReg, Size: file.Size}
+		if file.Mode == filemode.Symlink {
+			entry.Type = tar.TypeSymlink
+			return entry, nil
+		}
+		r, err := file.Reader()
+		if err != nil {
+			return projectEntry{}, err
+		}
+		current = r
+		entry.R = r
+		return entry, nil
+	})
+	if current != nil {
+		current.Close()
+	}
+	if err != nil {
+		return err
+	}
+	p.currentPackage.URL = source
+	p.currentPackage.Commit = &model.Commit{
+		Hash:     commit.Hash.String(),
+		Date:     commit.Committer.When,
+		Revision: revision,
+	}
+	return nil
+}
+
+// GitTags returns git sources for every tag of the repository at path.
+func GitTags(path string) ([]string, error) {
+	repo, err := openGitRepo(path)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	var sources []string
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		sources = append(sources, GitPrefix+path+"@"+ref.Name().Short())
+		return nil
+	})
+	sort.Strings(sources)
+	return sources, err
+}
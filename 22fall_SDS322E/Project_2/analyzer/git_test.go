@@ -0,0 +1,84 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func commitFiles(t *testing.T, repo *git.Repository, dir string, files map[string]string, tag string) {
+	wt, err := repo.Worktree()
+	assert.NoError(t, err)
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+		_, err := wt.Add(name)
+		assert.NoError(t, err)
+	}
+	sig := &object.Signature{Name: "test", Email: "test@example.org", When: time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)}
+	hash, err := wt.Commit("release "+tag, &git.CommitOptions{Author: sig, Committer: sig})
+	assert.NoError(t, err)
+	_, err = repo.CreateTag(tag, hash, nil)
+	assert.NoError(t, err)
+}
+
+func TestParseProjectGit(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "foo")
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	commitFiles(t, repo, dir, map[string]string{
+		"DESCRIPTION": "Package: foo\nVersion: 1.0\n",
+		"NAMESPACE":   "export(a)\n",
+	}, "v1.0")
+	commitFiles(t, repo, dir, map[string]string{
+		"DESCRIPTION": "Package: foo\nVersion: 1.1\nImports: stats,\n    utils\n",
+	}, "v1.1")
+
+	sources, err := GitTags(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{GitPrefix + dir + "@v1.0", GitPrefix + dir + "@v1.1"}, sources)
+
+	parser := new(Parser)
+	assert.NoError(t, parser.ParseProject(context.Background(), sources[0]))
+	p := parser.GetParseResult()
+	assert.Equal(t, "foo", p.Description.Package)
+	assert.Equal(t, "1.0", p.Description.Version)
+	assert.Equal(t, []string{"foo/DESCRIPTION", "foo/NAMESPACE"}, p.Files)
+	assert.Equal(t, "v1.0", p.Commit.Revision)
+	assert.Len(t, p.Commit.Hash, 40)
+
+	assert.NoError(t, parser.ParseProject(context.Background(), GitPrefix+dir))
+	assert.Equal(t, "1.1", parser.GetParseResult().Description.Version)
+	assert.Equal(t, []string{"stats", "utils"}, parser.GetParseResult().Description.Imports)
+	assert.Equal(t, "HEAD", parser.GetParseResult().Commit.Revision)
+}
+
+func TestGitSlashedTag(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "foo")
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	commitFiles(t, repo, dir, map[string]string{"DESCRIPTION": "Package: foo\nVersion: 1.0\n"}, "release/1.0")
+	commitFiles(t, repo, dir, map[string]string{"DESCRIPTION": "Package: foo\nVersion: 1.1\n"}, "release/1.1")
+
+	sources, err := GitTags(dir)
+	assert.NoError(t, err)
+	path, revision := SplitGitSource(sources[0])
+	assert.Equal(t, dir, path)
+	assert.Equal(t, "release/1.0", revision)
+	path, revision = SplitGitSource(GitPrefix + dir)
+	assert.Equal(t, dir, path)
+	assert.Equal(t, "HEAD", revision)
+	path, revision = SplitGitSource(GitPrefix + "/missing/foo@v1.0")
+	assert.Equal(t, "/missing/foo", path)
+	assert.Equal(t, "v1.0", revision)
+
+	parser := new(Parser)
+	assert.NoError(t, parser.ParseProject(context.Background(), sources[0]))
+	assert.Equal(t, "1.0", parser.GetParseResult().Description.Version)
+	assert.Equal(t, "release/1.0", parser.GetParseResult().Commit.Revision)
+}
@@ -0,0 +1,221 @@
+package analyzer
+
+import (
+	"Project2/model"
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Limits bound the time and space spent on a single untrusted package. A zero
+// field disables its limit.
+type Limits struct {
+	// ConnectTimeout bounds connecting to the server, including the TLS handshake
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds waiting for the response headers and each read of the body
+	ReadTimeout time.Duration
+	// TotalTimeout bounds the whole download. Time spent parsing the files
+	// already downloaded does not count.
+	TotalTimeout time.Duration
+	// MaxCompressedBytes and MaxDecompressedBytes bound the size of the
+	// tarball before and after decompression
+	MaxCompressedBytes   int64
+	MaxDecompressedBytes int64
+	MaxEntries           int
+	MaxEntryBytes        int64
+}
+
+// DefaultLimits are generous for CRAN packages, whose tarballs are limited to
+// a few MB.
+var DefaultLimits = Limits{
+	ConnectTimeout:       30 * time.Second,
+	ReadTimeout:          60 * time.Second,
+	TotalTimeout:         10 * time.Minute,
+	MaxCompressedBytes:   256 << 20,
+	MaxDecompressedBytes: 1 << 30,
+	MaxEntries:           50000,
+	MaxEntryBytes:        256 << 20,
+}
+
+// limitError is a violation of Limits, recorded as a model.StageLimit ParseError.
+type limitError struct {
+	Violation string
+	Message   string
+}
+
+func (e *limitError) Error() string {
+	return e.Message
+}
+
+func (e *limitError) parseError(file string) model.ParseError {
+	return model.ParseError{Stage: model.StageLimit, File: file, Message: e.Message, Violation: e.Violation}
+}
+
+// client returns an HTTP client with the connect and read timeouts. The total
+// timeout is left to the request context.
+func (l Limits) client() *http.Client {
+	dialer := &net.Dialer{Timeout: l.ConnectTimeout, KeepAlive: 30 * time.Second}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   l.ConnectTimeout,
+		ResponseHeaderTimeout: l.ReadTimeout,
+		MaxIdleConnsPerHost:   2,
+	}}
+}
+
+// Get fetches a document such as a directory listing within l: the connect,
+// read and total timeouts apply to the request and the body may not exceed
+// MaxCompressedBytes.
+func (l Limits) Get(parent context.Context, url string) ([]byte, error) {
+	ctx := parent
+	if l.TotalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.TotalTimeout)
+		defer cancel()
+	}
+	ctx, cancelRead := context.WithCancel(ctx)
+	defer cancelRead()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := l.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, StatusError{resp.StatusCode}
+	}
+	body := capReader(resp.Body, l.MaxCompressedBytes, model.ViolationCompressedSize, "response")
+	return io.ReadAll(newDeadlineReader(parent, ctx, cancelRead, body, l.ReadTimeout, 0))
+}
+
+// capReader returns r limited to max bytes, or r itself if max is 0.
+func capReader(r io.Reader, max int64, violation string, what string) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return &cappedReader{r: r, n: max, err: &limitError{
+		Violation: violation,
+		Message:   fmt.Sprintf("%s exceeds %d bytes", what, max),
+	}}
+}
+
+// cappedReader fails with err once more than n bytes are read.
+type cappedReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *cappedReader) Read(b []byte) (int, error) {
+	if c.n < 0 {
+		return 0, c.err
+	}
+	if int64(len(b)) > c.n+1 {
+		b = b[:c.n+1]
+	}
+	n, err := c.r.Read(b)
+	c.n -= int64(n)
+	if c.n < 0 {
+		return n - 1, c.err
+	}
+	return n, err
+}
+
+// deadlineReader reads a response body of a request with context ctx, which
+// cancel cancels once a read takes longer than timeout or all reads together
+// longer than total. The timeouts only run during reads, so the time the
+// caller spends between reads does not count. A zero timeout or total
+// disables it. Reads after ctx is done fail with a timeout violation, or
+// parent's error if the caller canceled parent.
+type deadlineReader struct {
+	r          io.Reader
+	parent     context.Context
+	ctx        context.Context
+	cancel     context.CancelFunc
+	timeout    time.Duration
+	total      time.Duration
+	limitTotal bool
+}
+
+func newDeadlineReader(parent context.Context, ctx context.Context, cancel context.CancelFunc, r io.Reader, timeout time.Duration, total time.Duration) *deadlineReader {
+	return &deadlineReader{r: r, parent: parent, ctx: ctx, cancel: cancel, timeout: timeout, total: total, limitTotal: total > 0}
+}
+
+func (d *deadlineReader) Read(b []byte) (int, error) {
+	timeout := d.timeout
+	if d.limitTotal {
+		if d.total <= 0 {
+			d.cancel()
+		} else if timeout <= 0 || d.total < timeout {
+			timeout = d.total
+		}
+	}
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.AfterFunc(timeout, d.cancel)
+	}
+	start := time.Now()
+	n, err := d.r.Read(b)
+	d.total -= time.Since(start)
+	if timer != nil {
+		timer.Stop()
+	}
+	if err != nil && d.parent.Err() != nil {
+		return n, d.parent.Err()
+	} else if err != nil && d.ctx.Err() != nil {
+		return n, &limitError{Violation: model.ViolationTimeout, Message: "download timed out"}
+	}
+	return n, err
+}
+
+// projectEntry is a file of a package source.
+type projectEntry struct {
+	// Name starts with the package directory, as in a source tarball
+	Name string
+	// Type is the tar.Type* of the entry
+	Type byte
+	Size int64
+	R    io.Reader
+}
+
+// checkEntry returns the violation of an entry, or nil if it can be parsed.
+func (l Limits) checkEntry(e projectEntry) *limitError {
+	switch {
+	case path.IsAbs(e.Name) || strings.HasPrefix(e.Name, `\`) || (len(e.Name) > 1 && e.Name[1] == ':'):
+		return &limitError{model.ViolationAbsolutePath, "absolute path"}
+	case containsDotDot(e.Name):
+		return &limitError{model.ViolationPathTraversal, "path outside of the package directory"}
+	case strings.IndexByte(e.Name, '/') <= 0:
+		return &limitError{model.ViolationNoPackageDir, "entry is not in a package directory"}
+	}
+	switch e.Type {
+	case tar.TypeReg, tar.TypeDir:
+	case tar.TypeSymlink, tar.TypeLink:
+		return &limitError{model.ViolationLink, "link entry"}
+	default:
+		return &limitError{model.ViolationSpecialFile, fmt.Sprintf("special file of type %q", e.Type)}
+	}
+	if l.MaxEntryBytes > 0 && e.Size > l.MaxEntryBytes {
+		return &limitError{model.ViolationEntrySize, fmt.Sprintf("entry of %d bytes exceeds %d bytes", e.Size, l.MaxEntryBytes)}
+	}
+	return nil
+}
+
+func containsDotDot(name string) bool {
+	for _, elem := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
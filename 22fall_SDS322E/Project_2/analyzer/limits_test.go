@@ -0,0 +1,164 @@
+package analyzer
+
+import (
+	"Project2/model"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTarball(t *testing.T, headers []tar.Header) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, h := range headers {
+		h := h
+		content := strings.Repeat("x", int(h.Size))
+		if h.Name == "foo/DESCRIPTION" {
+			content = "Package: foo\nVersion: 1.0\n"
+			h.Size = int64(len(content))
+		}
+		if h.Typeflag == 0 {
+			h.Typeflag = tar.TypeReg
+		}
+		assert.NoError(t, tw.WriteHeader(&h))
+		if h.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(content))
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func violations(p *model.P) []string {
+	var v []string
+	for _, e := range p.ParseError {
+		if e.Stage == model.StageLimit {
+			v = append(v, e.Violation)
+		}
+	}
+	return v
+}
+
+func TestParseProjectLimits(t *testing.T) {
+	tarball := makeTarball(t, []tar.Header{
+		{Name: "foo/DESCRIPTION"},
+		{Name: "/etc/passwd", Size: 1},
+		{Name: "foo/../../x", Size: 1},
+		{Name: "README", Size: 1},
+		{Name: "foo/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		{Name: "foo/dev", Typeflag: tar.TypeChar},
+		{Name: "foo/inst/big.txt", Size: 100},
+		{Name: "foo/inst/small.txt", Size: 10},
+	})
+	parser := &Parser{limits: Limits{MaxEntryBytes: 50}}
+	assert.NoError(t, parser.parseProjectArchive(context.Background(), bytes.NewReader(tarball)))
+	p := parser.GetParseResult()
+	assert.Equal(t, "foo", p.Description.Package)
+	assert.Equal(t, []string{"foo/DESCRIPTION", "foo/inst/small.txt"}, p.Files)
+	assert.Equal(t, []string{
+		model.ViolationAbsolutePath,
+		model.ViolationPathTraversal,
+		model.ViolationNoPackageDir,
+		model.ViolationLink,
+		model.ViolationSpecialFile,
+		model.ViolationEntrySize,
+	}, violations(p))
+
+	// reading stops at size and count violations
+	tarball = makeTarball(t, []tar.Header{
+		{Name: "foo/DESCRIPTION"},
+		{Name: "foo/a.txt", Size: 4096},
+		{Name: "foo/b.txt", Size: 4096},
+		{Name: "foo/c.txt", Size: 4096},
+	})
+	for _, test := range []struct {
+		limits    Limits
+		files     int
+		violation string
+	}{
+		{Limits{MaxEntries: 2}, 2, model.ViolationEntryCount},
+		{Limits{MaxDecompressedBytes: 6000}, 2, model.ViolationDecompressedSize},
+		{Limits{MaxCompressedBytes: 16}, 0, model.ViolationCompressedSize},
+		{Limits{}, 4, ""},
+	} {
+		parser := &Parser{limits: test.limits}
+		assert.NoError(t, parser.parseProjectArchive(context.Background(), bytes.NewReader(tarball)))
+		p := parser.GetParseResult()
+		assert.Len(t, p.Files, test.files, test.violation)
+		if test.violation != "" {
+			assert.Equal(t, []string{test.violation}, violations(p))
+		} else {
+			assert.Empty(t, violations(p))
+		}
+	}
+}
+
+func TestParseProjectURLTimeout(t *testing.T) {
+	tarball := makeTarball(t, []tar.Header{{Name: "foo/DESCRIPTION"}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball[:10])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	parser := &Parser{limits: Limits{ReadTimeout: 100 * time.Millisecond}}
+	assert.NoError(t, parser.ParseProjectURL(context.Background(), server.URL+"/foo_1.0.tar.gz"))
+	assert.Equal(t, []string{model.ViolationTimeout}, violations(parser.GetParseResult()))
+
+	// canceling the caller's context is not a violation
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	parser = &Parser{limits: Limits{ReadTimeout: time.Minute}}
+	assert.ErrorIs(t, parser.ParseProjectURL(ctx, server.URL+"/foo_1.0.tar.gz"), context.Canceled)
+}
+
+func TestDeadlineReaderPaused(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := newDeadlineReader(context.Background(), ctx, cancel, strings.NewReader("abc"), 20*time.Millisecond, 20*time.Millisecond)
+	b := make([]byte, 1)
+	for i := 0; i < 3; i++ {
+		_, err := d.Read(b)
+		assert.NoError(t, err)
+		// the time spent parsing between reads does not count
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.NoError(t, ctx.Err())
+}
+
+func TestLimitsGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer server.Close()
+
+	body, err := Limits{MaxCompressedBytes: 100}.Get(context.Background(), server.URL+"/")
+	assert.NoError(t, err)
+	assert.Len(t, body, 100)
+	_, err = Limits{MaxCompressedBytes: 10}.Get(context.Background(), server.URL+"/")
+	var limitErr *limitError
+	if assert.ErrorAs(t, err, &limitErr) {
+		assert.Equal(t, model.ViolationCompressedSize, limitErr.Violation)
+	}
+	_, err = Limits{}.Get(context.Background(), server.URL+"/missing/")
+	assert.ErrorIs(t, err, StatusError{404})
+}
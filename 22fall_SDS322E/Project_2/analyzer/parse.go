@@ -1,19 +1,19 @@
-package main
+package analyzer
 
 import (
 	"Project2/model"
 	"Project2/rparse"
-	"Project2/rparse/matcher"
 	"bufio"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/exec"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 )
 
 var rDescriptionHeader = regexp.MustCompile(`^([\w@\.]+):\s+(.*)$`)
@@ -22,27 +22,34 @@ func (p *Parser) GetParseResult() *model.P {
 	return p.currentPackage
 }
 
-func (p *Parser) ParseRFile(filename string, rFile io.Reader) {
+// ParseRFile parses an R file with the R parser agent and runs the matchers on
+// its tokens. Errors parsing the file are recorded as parse errors; errors of
+// the temp file it is copied to are returned.
+func (p *Parser) ParseRFile(ctx context.Context, filename string, rFile io.Reader) error {
 	if p.tmpRFile == nil {
 		tmpRFile, err := os.CreateTemp("", "rparse_tmp_*")
 		if err != nil {
-			log.Fatalf("Failed to create temporary file: %v", err)
+			return fmt.Errorf("failed to create temporary file: %w", err)
 		}
 		p.tmpRFile = tmpRFile
 	}
 	if err := p.tmpRFile.Truncate(0); err != nil {
-		log.Fatalf("Failed to truncate temporary file: %v", err)
+		return fmt.Errorf("failed to truncate temporary file: %w", err)
 	}
 	if _, err := p.tmpRFile.Seek(0, io.SeekStart); err != nil {
-		log.Fatalf("Failed to seek to start of temporary file: %v", err)
+		return fmt.Errorf("failed to seek to start of temporary file: %w", err)
 	}
 	if _, err := io.Copy(p.tmpRFile, rFile); err != nil {
 		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "R", Message: fmt.Sprintf("Error reading file %s: %v", filename, err)})
 	}
-	tokenList, err := p.rParserAgent.CmdParseFile(filename, p.tmpRFile.Name())
+	start := time.Now()
+	defer func() {
+		p.parseTime += time.Since(start)
+	}()
+	tokenList, err := p.rParserAgent.CmdParseFile(ctx, filename, p.tmpRFile.Name())
 	if err != nil {
 		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "R", Message: fmt.Sprintf("Error parsing file %s: %v", filename, err)})
-		return
+		return nil
 	}
 
 	p.currentPackage.RFiles = append(p.currentPackage.RFiles, model.RFile{
@@ -50,81 +57,75 @@ func (p *Parser) ParseRFile(filename string, rFile io.Reader) {
 		NTokens: len(tokenList),
 	})
 	if len(tokenList) == 0 {
-		return
+		return nil
 	}
-	if err := rparse.RunTokenMatcher(matcher.TrackParenthesis, tokenList, matcher.TrackParenthesisUpdate); err != nil {
-		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "R", Message: fmt.Sprintf("Error matching parenthesis in file %s: %v", filename, err)})
-		return
-	}
-	if err := rparse.RunTokenMatcher(matcher.MatchAssignment, tokenList, matcher.MatchAssignmentUpdate); err != nil {
-		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "R", Message: fmt.Sprintf("Error matching assignments in file %s: %v", filename, err)})
-		return
-	}
-	if err := rparse.RunTokenMatcher(matcher.MatchFunctionDef, tokenList, matcher.MatchFunctionDefUpdate); err != nil {
-		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "R", Message: fmt.Sprintf("Error matching function definitions in file %s: %v", filename, err)})
-		return
-	}
-	if err := rparse.RunTokenMatcher(matcher.MatchLibraryCalls, tokenList, matcher.MatchLibraryCallsUpdate); err != nil {
-		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "R", Message: fmt.Sprintf("Error matching library calls in file %s: %v", filename, err)})
-		return
-	}
-	if err := rparse.RunTokenMatcher(matcher.MatchFunctionCall, tokenList, matcher.MatchFunctionCallUpdate); err != nil {
-		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "R", Message: fmt.Sprintf("Error matching function calls in file %s: %v", filename, err)})
-		return
-	}
-	p.currentPackage.RFiles[len(p.currentPackage.RFiles)-1].Stats = map[string]interface{}{
-		matcher.MatchAssignment:   tokenList.FinalMatcherState(matcher.MatchAssignment),
-		matcher.MatchFunctionDef:  tokenList.FinalMatcherState(matcher.MatchFunctionDef),
-		matcher.TrackParenthesis:  tokenList.FinalMatcherState(matcher.TrackParenthesis),
-		matcher.MatchLibraryCalls: tokenList.FinalMatcherState(matcher.MatchLibraryCalls),
-		matcher.MatchFunctionCall: tokenList.FinalMatcherState(matcher.MatchFunctionCall),
+	results, errs := rparse.RunMatchers(p.matchers, tokenList)
+	for _, spec := range p.matchers {
+		if err := errs[spec.Name]; err != nil {
+			p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "R", Message: fmt.Sprintf("Error running matcher %s in file %s: %v", spec.Name, filename, err)})
+		}
 	}
+	p.currentPackage.RFiles[len(p.currentPackage.RFiles)-1].Stats = model.NewFileStats(results)
+	return nil
 }
-func (p *Parser) ParseDescriptionFile(descFile io.Reader) {
+
+func (p *Parser) ParseDescriptionFile(descFile io.Reader) error {
 	scanner := bufio.NewScanner(descFile)
 	var descFieldName string
 	var descFieldValue string
-	for scanner.Scan() {
-		line := scanner.Text()
-		if subMatch := rDescriptionHeader.FindStringSubmatch(line); subMatch != nil {
-			if descFieldName != "" {
-				descFieldValue = strings.TrimSpace(descFieldValue)
-				targetField := reflect.ValueOf(&p.currentPackage.Description).Elem().
-					FieldByNameFunc(func(name string) bool {
-						return strings.EqualFold(name, descFieldName)
-					})
-				if targetField.IsValid() {
-					switch targetField.Kind() {
-					case reflect.String:
-						targetField.SetString(descFieldValue)
-					case reflect.Slice:
-						switch targetField.Type().Elem().Kind() {
-						case reflect.String:
-							fields := strings.Split(descFieldValue, ",")
-							for i, field := range fields {
-								field = strings.TrimSpace(field)
-								if match := regexp.MustCompile(`^([\w\.]+)\s*\((.+)\)$`).FindStringSubmatch(field); match != nil {
-									field = match[1]
-								}
-								fields[i] = field
-							}
-							targetField.Set(reflect.ValueOf(fields))
+	flush := func() {
+		if descFieldName == "" {
+			return
+		}
+		descFieldValue = strings.TrimSpace(descFieldValue)
+		targetField := reflect.ValueOf(&p.currentPackage.Description).Elem().
+			FieldByNameFunc(func(name string) bool {
+				return strings.EqualFold(name, descFieldName)
+			})
+		if targetField.IsValid() {
+			switch targetField.Kind() {
+			case reflect.String:
+				targetField.SetString(descFieldValue)
+			case reflect.Slice:
+				switch targetField.Type().Elem().Kind() {
+				case reflect.String:
+					fields := strings.Split(descFieldValue, ",")
+					for i, field := range fields {
+						field = strings.TrimSpace(field)
+						if match := regexp.MustCompile(`^([\w\.]+)\s*\((.+)\)$`).FindStringSubmatch(field); match != nil {
+							field = match[1]
 						}
+						fields[i] = field
 					}
+					targetField.Set(reflect.ValueOf(fields))
 				}
-				descFieldName = ""
 			}
+		}
+		descFieldName = ""
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if subMatch := rDescriptionHeader.FindStringSubmatch(line); subMatch != nil {
+			flush()
 			descFieldName = subMatch[1]
 			descFieldValue = subMatch[2]
 		} else {
 			descFieldValue += " " + strings.TrimSpace(line)
 		}
 	}
+	flush()
+	return scanner.Err()
 }
 
-func (p *Parser) ParseNamespaceFile(nameFile io.Reader) {
-	rParseCmd := exec.Command(
-		"Rscript", "--vanilla", "-e",
+// ParseNamespaceFile parses a NAMESPACE file with an Rscript process, which is
+// killed if ctx is canceled.
+func (p *Parser) ParseNamespaceFile(ctx context.Context, nameFile io.Reader) error {
+	rscript := p.rscript
+	if rscript == "" {
+		rscript = "Rscript"
+	}
+	rParseCmd := exec.CommandContext(ctx,
+		rscript, "--vanilla", "-e",
 		strings.Join([]string{
 			`write.csv(`,
 			`getParseData(parse(file="stdin", keep.source=TRUE))[c("token", "text")]`,
@@ -134,21 +135,24 @@ func (p *Parser) ParseNamespaceFile(nameFile io.Reader) {
 	rParseCmd.Stderr = os.Stderr
 	stdout, err := rParseCmd.StdoutPipe()
 	if err != nil {
-		log.Panicf("failed to get stdout pipe: %v", err)
+		return fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
-	defer stdout.Close()
-
 	if err := rParseCmd.Start(); err != nil {
-		log.Panicf("failed to start Rscript: %v", err)
+		return fmt.Errorf("failed to start Rscript: %w", err)
 	}
+	defer func() {
+		// closing stdout first stops Rscript if the output was not read to the end
+		stdout.Close()
+		rParseCmd.Wait()
+	}()
 
 	csvReader := csv.NewReader(stdout)
 	header, err := csvReader.Read()
 	if err != nil {
-		log.Panicf("failed to read header: %v", err)
+		return fmt.Errorf("failed to read header: %w", err)
 	}
 	if len(header) != 2 || header[0] != "token" || header[1] != "text" {
-		log.Panicf("unexpected header: %v", header)
+		return fmt.Errorf("unexpected header: %v", header)
 	}
 
 	tokens := make([][2]string, 0)
@@ -157,7 +161,7 @@ func (p *Parser) ParseNamespaceFile(nameFile io.Reader) {
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			log.Panicf("failed to read csv record: %v", err)
+			return fmt.Errorf("failed to read csv record: %w", err)
 		}
 		token := rec[0]
 		text := rec[1]
@@ -169,7 +173,7 @@ func (p *Parser) ParseNamespaceFile(nameFile io.Reader) {
 		tokens = append(tokens, [2]string{token, text})
 	}
 	ptr := 0
-	args := make([]string, 0, len(tokens)-1)
+	args := make([]string, 0, len(tokens))
 	opts := make(map[string]string)
 	optName := ""
 	parenDepth := 0
@@ -213,11 +217,11 @@ func (p *Parser) ParseNamespaceFile(nameFile io.Reader) {
 			}
 			ptr++
 		case "SYMBOL_SUB":
-			if tokens[ptr+1][0] != "EQ_SUB" {
+			if ptr+1 == len(tokens) || tokens[ptr+1][0] != "EQ_SUB" {
 				p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{
 					Stage:   "NAMESPACE",
 					File:    "/NAMESPACE",
-					Message: fmt.Sprintf("unexpected token after SYMBOL_SUB: EQ_SUB exptected, got %v", tokens[ptr+1]),
+					Message: fmt.Sprintf("unexpected token after SYMBOL_SUB %s: EQ_SUB exptected", text),
 				})
 				ptr++
 			} else {
@@ -239,17 +243,32 @@ func (p *Parser) ParseNamespaceFile(nameFile io.Reader) {
 				Opts: opts,
 			})
 			switch topLevelFunction {
-			case "export", "exportClasses", "exportMethods":
+			case "export":
+				p.currentPackage.Namespace.Exports = append(p.currentPackage.Namespace.Exports, args...)
+			case "exportClasses":
 				p.currentPackage.Namespace.Exports = append(p.currentPackage.Namespace.Exports, args...)
+				p.currentPackage.Namespace.ExportClasses = append(p.currentPackage.Namespace.ExportClasses, args...)
+			case "exportMethods":
+				p.currentPackage.Namespace.Exports = append(p.currentPackage.Namespace.Exports, args...)
+				p.currentPackage.Namespace.ExportMethods = append(p.currentPackage.Namespace.ExportMethods, args...)
 			case "import":
 				p.currentPackage.Namespace.Imports = append(p.currentPackage.Namespace.Imports, args...)
 			case "importFrom", "importClassesFrom", "importMethodsFrom":
+				if len(args) == 0 {
+					p.namespaceError("%s without a package", topLevelFunction)
+					break
+				}
 				pkg := args[0]
 				for _, arg := range args[1:] {
 					p.currentPackage.Namespace.Imports = append(p.currentPackage.Namespace.Imports, pkg+"::"+arg)
 				}
 			case "S3method":
+				if len(args) < 2 {
+					p.namespaceError("S3method without a generic and a class")
+					break
+				}
 				p.currentPackage.Namespace.Exports = append(p.currentPackage.Namespace.Exports, args[0]+"."+args[1])
+				p.currentPackage.Namespace.S3Methods = append(p.currentPackage.Namespace.S3Methods, args[0]+"."+args[1])
 			default:
 				p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{
 					Stage:   "NAMESPACE",
@@ -257,9 +276,17 @@ func (p *Parser) ParseNamespaceFile(nameFile io.Reader) {
 					Message: fmt.Sprintf("dont know what to do with top-level function call: %v", topLevelFunction),
 				})
 			}
-			args = args[:0]
+			args = nil
 			opts = make(map[string]string)
 		}
 	}
-	rParseCmd.Wait()
+	return nil
+}
+
+func (p *Parser) namespaceError(format string, a ...any) {
+	p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{
+		Stage:   "NAMESPACE",
+		File:    "/NAMESPACE",
+		Message: fmt.Sprintf(format, a...),
+	})
 }
@@ -0,0 +1,386 @@
+package analyzer
+
+import (
+	"Project2/model"
+	"Project2/rparse"
+	"Project2/rparse/matcher"
+	"Project2/rparse/query"
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Parser parses packages one at a time with its own R parser agent. A Parser
+// is not safe for concurrent use.
+type Parser struct {
+	tmpRFile     *os.File
+	rParserAgent rparse.Agent
+	rscript      string
+	matchers     []rparse.MatcherSpec
+	limits       Limits
+	client       *http.Client
+	observer     Observer
+	// parseTime is the time spent parsing the R files of the current package
+	parseTime time.Duration
+
+	currentPackage *model.P
+}
+
+// NewParser returns a parser with a running R parser agent.
+func NewParser(opts Options) (*Parser, error) {
+	p := &Parser{matchers: opts.Matchers, rscript: opts.Rscript, observer: opts.Observer, limits: DefaultLimits}
+	if p.rscript == "" {
+		p.rscript = "Rscript"
+	}
+	if opts.Limits != nil {
+		p.limits = *opts.Limits
+	}
+	if p.matchers == nil {
+		var err error
+		if p.matchers, err = matcher.Default.Plan(); err != nil {
+			return nil, fmt.Errorf("could not plan matchers: %w", err)
+		}
+	}
+	if err := p.rParserAgent.Start(p.rscript); err != nil {
+		return nil, fmt.Errorf("could not start R parser agent: %w", err)
+	}
+	return p, nil
+}
+
+// AgentStats returns the statistics of the R parser agent, which are safe to
+// read while p is in use.
+func (p *Parser) AgentStats() rparse.AgentStats {
+	return p.rParserAgent.LoadStats()
+}
+
+// Analyze parses a package from a source of ParseProject. Errors parsing parts
+// of the package are recorded in its ParseError.
+func (p *Parser) Analyze(ctx context.Context, source string) (pkg *model.P, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pkg, err = nil, fmt.Errorf("analyzing %s: %v", source, r)
+		}
+	}()
+	if err := p.ParseProject(ctx, source); err != nil {
+		return nil, err
+	}
+	return p.GetParseResult(), nil
+}
+
+// StatusError is returned by ParseProjectURL for a non-200 response.
+type StatusError struct {
+	Code int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.Code)
+}
+
+// Close stops the R parser agent and removes the temp file of p.
+func (p *Parser) Close() error {
+	err := p.rParserAgent.Stop()
+	if p.tmpRFile != nil {
+		p.tmpRFile.Close()
+		if rmErr := os.Remove(p.tmpRFile.Name()); err == nil {
+			err = rmErr
+		}
+		p.tmpRFile = nil
+	}
+	return err
+}
+
+func (p *Parser) ParseProjectTar(ctx context.Context, tarFile *tar.Reader) error {
+	return p.parseProjectFiles(ctx, func() (projectEntry, error) {
+		return nextTarEntry(tarFile)
+	})
+}
+
+func nextTarEntry(tarFile *tar.Reader) (projectEntry, error) {
+	for {
+		header, err := tarFile.Next()
+		if err != nil {
+			return projectEntry{}, err
+		}
+		// pax global headers hold archive metadata such as the git commit
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		return projectEntry{Name: header.Name, Type: header.Typeflag, Size: header.Size, R: tarFile}, nil
+	}
+}
+
+// parseProjectArchive parses a gzipped source tarball within the size limits.
+func (p *Parser) parseProjectArchive(ctx context.Context, r io.Reader) error {
+	var tarFile *tar.Reader
+	return p.parseProjectFiles(ctx, func() (projectEntry, error) {
+		if tarFile == nil {
+			gzReader, err := gzip.NewReader(capReader(r, p.limits.MaxCompressedBytes, model.ViolationCompressedSize, "archive"))
+			if err != nil {
+				return projectEntry{}, err
+			}
+			tarFile = tar.NewReader(capReader(gzReader, p.limits.MaxDecompressedBytes, model.ViolationDecompressedSize, "decompressed archive"))
+		}
+		return nextTarEntry(tarFile)
+	})
+}
+
+// parseProjectFiles parses the files returned by next until it returns io.EOF.
+// Entries that break the limits are recorded as model.StageLimit parse errors.
+// Parsing stops with ctx's error once ctx is canceled.
+func (p *Parser) parseProjectFiles(ctx context.Context, next func() (projectEntry, error)) error {
+	p.currentPackage = model.NewP()
+	p.parseTime = 0
+	for _, spec := range p.matchers {
+		if strings.HasPrefix(spec.Name, query.Prefix) {
+			p.currentPackage.Queries = append(p.currentPackage.Queries, strings.TrimPrefix(spec.Name, query.Prefix))
+		}
+	}
+
+	hasDescription := false
+	hasNamespace := false
+	for nEntries := 0; ; nEntries++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entry, err := next()
+		var limitErr *limitError
+		if errors.As(err, &limitErr) {
+			p.currentPackage.ParseError = append(p.currentPackage.ParseError, limitErr.parseError(""))
+			break
+		} else if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if p.limits.MaxEntries > 0 && nEntries >= p.limits.MaxEntries {
+			p.currentPackage.ParseError = append(p.currentPackage.ParseError, (&limitError{
+				Violation: model.ViolationEntryCount,
+				Message:   fmt.Sprintf("archive has more than %d entries", p.limits.MaxEntries),
+			}).parseError(entry.Name))
+			break
+		}
+		if limitErr := p.limits.checkEntry(entry); limitErr != nil {
+			p.currentPackage.ParseError = append(p.currentPackage.ParseError, limitErr.parseError(entry.Name))
+			continue
+		}
+
+		fullName := entry.Name
+		file := entry.R
+		p.currentPackage.Files = append(p.currentPackage.Files, fullName)
+		fileName := fullName[strings.IndexByte(fullName, '/'):]
+		if fileName == "/DESCRIPTION" {
+			p.catchParseError("DESCRIPTION", fullName, func() error {
+				hasDescription = true
+				return p.ParseDescriptionFile(file)
+			})
+		} else if fileName == "/NAMESPACE" {
+			p.catchParseError("NAMESPACE", fullName, func() error {
+				hasNamespace = true
+				return p.ParseNamespaceFile(ctx, file)
+			})
+		} else {
+			ext := filepath.Ext(fileName)
+			ext = strings.ToLower(ext)
+			if ext == "" {
+				ext = "NONE"
+			}
+			p.currentPackage.FileExtensions[ext]++
+			if strings.HasPrefix(fileName, "/R/") && ext == ".r" {
+				p.catchParseError("SOURCE_R", fullName, func() error {
+					return p.ParseRFile(ctx, fileName, file)
+				})
+			}
+		}
+	}
+	if !hasDescription {
+		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "DESCRIPTION", Message: "DESCRIPTION file not found"})
+	}
+	if !hasNamespace {
+		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "NAMESPACE", Message: "NAMESPACE file not found"})
+	}
+	if p.observer != nil {
+		p.observer.Parsed(p.parseTime)
+	}
+	return nil
+}
+
+// ParseProject parses a package from an http(s) URL, a git repository (see
+// GitPrefix), a local tarball or an unpacked package directory.
+func (p *Parser) ParseProject(ctx context.Context, source string) error {
+	switch {
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return p.ParseProjectURL(ctx, source)
+	case strings.HasPrefix(source, GitPrefix):
+		return p.ParseProjectGit(ctx, source)
+	}
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		return p.ParseProjectDir(ctx, source)
+	}
+	return p.ParseProjectFile(ctx, source)
+}
+
+// ParseProjectDir parses an unpacked package directory. Version control
+// directories such as .git are skipped.
+func (p *Parser) ParseProjectDir(ctx context.Context, dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	var entries []projectEntry
+	var paths []string
+	err = filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == abs {
+			return err
+		}
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == ".svn" || d.Name() == ".hg") {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(abs, path)
+		if err != nil {
+			return err
+		}
+		entry := projectEntry{Name: filepath.Base(abs) + "/" + filepath.ToSlash(rel), Size: info.Size()}
+		switch mode := info.Mode(); {
+		case mode.IsRegular():
+			entry.Type = tar.TypeReg
+		case mode.IsDir():
+			entry.Type, entry.Name = tar.TypeDir, entry.Name+"/"
+		case mode&fs.ModeSymlink != 0:
+			entry.Type = tar.TypeSymlink
+		default:
+			entry.Type = tar.TypeChar
+		}
+		entries = append(entries, entry)
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var current *os.File
+	defer func() {
+		if current != nil {
+			current.Close()
+		}
+	}()
+	err = p.parseProjectFiles(ctx, func() (projectEntry, error) {
+		if current != nil {
+			current.Close()
+			current = nil
+		}
+		if len(entries) == 0 {
+			return projectEntry{}, io.EOF
+		}
+		entry, path := entries[0], paths[0]
+		entries, paths = entries[1:], paths[1:]
+		if entry.Type == tar.TypeReg {
+			f, err := os.Open(path)
+			if err != nil {
+				return projectEntry{}, err
+			}
+			current = f
+			entry.R = f
+		}
+		return entry, nil
+	})
+	if err != nil {
+		return err
+	}
+	p.currentPackage.URL = dir
+	return nil
+}
+
+func (p *Parser) ParseProjectFile(ctx context.Context, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := p.parseProjectArchive(ctx, f); err != nil {
+		return err
+	}
+	p.currentPackage.URL = filename
+	return nil
+}
+
+// ParseProjectURL downloads and parses a source tarball within p's limits.
+// Failing to connect or to receive the response headers is an error; a timeout
+// while reading the body is recorded as a violation. The files are parsed as
+// they are downloaded, and the time spent parsing does not count towards the
+// timeouts.
+func (p *Parser) ParseProjectURL(parent context.Context, url string) error {
+	if p.client == nil {
+		p.client = p.limits.client()
+	}
+	ctx, cancelRead := context.WithCancel(parent)
+	defer cancelRead()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if p.observer != nil {
+		p.observer.Fetched(time.Since(start))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return StatusError{resp.StatusCode}
+	}
+	var r io.Reader = resp.Body
+	if p.observer != nil {
+		r = &observedReader{r, p.observer}
+	}
+	// the response headers count towards the total timeout, the parsing does not
+	var total time.Duration
+	if p.limits.TotalTimeout > 0 {
+		if total = p.limits.TotalTimeout - time.Since(start); total <= 0 {
+			total = time.Nanosecond
+		}
+	}
+	body := newDeadlineReader(parent, ctx, cancelRead, r, p.limits.ReadTimeout, total)
+	if err := p.parseProjectArchive(parent, body); err != nil {
+		return err
+	}
+	p.currentPackage.URL = url
+	return nil
+}
+
+// catchParseError records the error of parseFunc as a parse error of a stage.
+// A panic in parseFunc is recorded with its stack.
+func (p *Parser) catchParseError(stage string, file string, parseFunc func() error) {
+	defer func() {
+		if err := recover(); err != nil {
+			p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{
+				Stage:   stage,
+				File:    file,
+				Message: fmt.Sprintf("%v", err),
+				Stack:   string(debug.Stack()),
+			})
+		}
+	}()
+	if err := parseFunc(); err != nil {
+		p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{
+			Stage:   stage,
+			File:    file,
+			Message: err.Error(),
+		})
+	}
+}
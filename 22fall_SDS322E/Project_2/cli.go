@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Exit codes of all commands.
+const (
+	exitOK = 0
+	// exitFailure is returned when a command fails
+	exitFailure = 1
+	// exitUsage is returned for bad flags or arguments, as by flag.ExitOnError
+	exitUsage = 2
+	// exitPartial is returned when a command finished but some packages failed
+	exitPartial = 3
+)
+
+// usageError is a bad invocation of a command.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// partialError reports packages that failed in a command that otherwise completed.
+type partialError struct {
+	Failed int
+	Total  int
+}
+
+func (e partialError) Error() string {
+	return fmt.Sprintf("%d of %d packages failed", e.Failed, e.Total)
+}
+
+// exitCode returns the exit code for the error of a command.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp), errors.As(err, &usageError{}):
+		return exitUsage
+	case errors.As(err, &partialError{}):
+		return exitPartial
+	}
+	return exitFailure
+}
+
+type command struct {
+	name string
+	// args is the synopsis of the arguments
+	args  string
+	short string
+	run   func(args []string) error
+}
+
+// commands are the subcommands; fetch runs if none is given.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"fetch", "", "Fetch and parse the packages in -packages into -output", fetch},
+		{"analyze", "<tarball|dir|url|git:repo[@revision]>", "Parse one package and print it as JSON", analyze},
+		{"features", "<in.json|-> <out.csv|.tsv|.parquet|->", "Extract a feature table from an output without R", features},
+		{"inspect", "[-json] <in.json|-> [package[@version]...]", "Summarize the packages in an output", inspect},
+		{"errors", "[-top n] <in.json|->", "Aggregate the fetch and parse errors in an output", errorsCommand},
+		{"merge", "<out> <in.json>...", "Combine output shards, skipping packages already in out", merge},
+		{"convert", "<in.json> <out>", "Copy an output into another, usually a SQLite database", convert},
+		{"history", "[-out prefix] [-format csv] <package> <source>...", "Compare the releases of a package", history},
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-9s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(out, "\nFlags, shared by all commands:\n")
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns the flag set of a command, which reports errors instead
+// of exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		c := findCommand(name)
+		fmt.Fprintf(flags.Output(), "Usage: %s [flags] %s %s\n", os.Args[0], c.name, c.args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseArgs parses the flags of a command and checks that it got between min
+// and max arguments, any number above min if max is negative.
+func parseArgs(flags *flag.FlagSet, args []string, min int, max int) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if n := flags.NArg(); n < min || max >= 0 && n > max {
+		flags.Usage()
+		return usageError{"wrong number of arguments"}
+	}
+	return nil
+}
+
+var configLine = regexp.MustCompile(`^([\w-]+)\s*=\s*(.*)$`)
+
+// loadConfig sets the flags of flagSet from a file of "flag = value" lines.
+// Blank lines and lines starting with # are ignored. Flags set on the command
+// line take precedence.
+func loadConfig(flagSet *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	set := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := configLine.FindStringSubmatch(line)
+		if match == nil {
+			return fmt.Errorf("%s:%d: expected flag = value", path, lineNo)
+		}
+		if set[match[1]] {
+			continue
+		}
+		if err := flagSet.Set(match[1], match[2]); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
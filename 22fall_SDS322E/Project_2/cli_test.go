@@ -0,0 +1,66 @@
+package main
+
+import (
+	"Project2/model"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitOK, exitCode(nil))
+	assert.Equal(t, exitFailure, exitCode(errors.New("oops")))
+	assert.Equal(t, exitUsage, exitCode(flag.ErrHelp))
+	assert.Equal(t, exitUsage, exitCode(usageError{"bad"}))
+	assert.Equal(t, exitPartial, exitCode(fmt.Errorf("fetch: %w", partialError{Failed: 1, Total: 2})))
+}
+
+func TestLoadConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, os.WriteFile(config, []byte("# crawl\nprocs = 4\n\noutput = out.db\n"), 0o644))
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	procs := flags.Int("procs", 8, "")
+	output := flags.String("output", "output.json", "")
+	assert.NoError(t, flags.Parse([]string{"-output", "cli.db"}))
+	assert.NoError(t, loadConfig(flags, config))
+	assert.Equal(t, 4, *procs)
+	assert.Equal(t, "cli.db", *output)
+
+	assert.NoError(t, os.WriteFile(config, []byte("procs\n"), 0o644))
+	assert.ErrorContains(t, loadConfig(flags, config), ":1:")
+}
+
+func TestAggregateErrors(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "output.json")
+	f, err := os.Create(input)
+	assert.NoError(t, err)
+	enc := json.NewEncoder(f)
+	assert.NoError(t, enc.Encode(&model.P{Name: "foo", FetchError: "404"}))
+	assert.NoError(t, enc.Encode(&model.P{Name: "bar", ParseError: []model.ParseError{
+		{Stage: model.StageLimit, Violation: model.ViolationLink, Message: "link"},
+		{Stage: model.StageLimit, Violation: model.ViolationLink, Message: "link"},
+	}}))
+	assert.NoError(t, enc.Encode(&model.P{Name: "baz", ParseError: []model.ParseError{
+		{Stage: model.StageLimit, Violation: model.ViolationLink, Message: "other"},
+	}}))
+	assert.NoError(t, f.Close())
+
+	classes, err := aggregateErrors(input)
+	assert.NoError(t, err)
+	if assert.Len(t, classes, 2) {
+		assert.Equal(t, model.StageLimit, classes[0].Stage)
+		assert.Equal(t, model.ViolationLink, classes[0].Class)
+		assert.Equal(t, 3, classes[0].Count)
+		assert.Equal(t, 2, classes[0].Packages)
+		assert.Equal(t, 2, classes[0].Messages["link"])
+		assert.Equal(t, "fetch", classes[1].Stage)
+	}
+	assert.True(t, matchPackage(&model.P{Name: "foo", Version: "1.0"}, []string{"bar", "foo@1.0"}))
+	assert.False(t, matchPackage(&model.P{Name: "foo", Version: "1.0"}, []string{"foo@2.0"}))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"Project2/model"
+	"fmt"
+)
+
+// columnKind is the R vector type a column is allocated as.
+type columnKind int
+
+const (
+	intColumn columnKind = iota
+	realColumn
+	stringColumn
+)
+
+// column is a typed column of a data.frame. Only the slice of its kind is
+// used; NA marks missing values.
+type column struct {
+	name  string
+	kind  columnKind
+	ints  []int
+	reals []float64
+	strs  []string
+	na    []bool
+}
+
+func (c *column) len() int {
+	return len(c.na)
+}
+
+func (c *column) appendNA() {
+	switch c.kind {
+	case intColumn:
+		c.ints = append(c.ints, 0)
+	case realColumn:
+		c.reals = append(c.reals, 0)
+	case stringColumn:
+		c.strs = append(c.strs, "")
+	}
+	c.na = append(c.na, true)
+}
+
+// toReal converts an integer column to a real one.
+func (c *column) toReal() {
+	c.reals = make([]float64, len(c.ints))
+	for i, v := range c.ints {
+		c.reals[i] = float64(v)
+	}
+	c.ints = nil
+	c.kind = realColumn
+}
+
+func (c *column) append(value any) error {
+	switch v := value.(type) {
+	case int:
+		if c.kind == realColumn {
+			c.reals = append(c.reals, float64(v))
+			break
+		} else if c.kind != intColumn {
+			return fmt.Errorf("column %s: cannot append int to a string column", c.name)
+		}
+		c.ints = append(c.ints, v)
+	case float64:
+		if c.kind == intColumn {
+			c.toReal()
+		} else if c.kind != realColumn {
+			return fmt.Errorf("column %s: cannot append float64 to a string column", c.name)
+		}
+		c.reals = append(c.reals, v)
+	case string:
+		if c.kind != stringColumn {
+			return fmt.Errorf("column %s: cannot append string to a numeric column", c.name)
+		}
+		c.strs = append(c.strs, v)
+	default:
+		return fmt.Errorf("column %s: unsupported type %T", c.name, value)
+	}
+	c.na = append(c.na, false)
+	return nil
+}
+
+// columns collects rows of key-value pairs into typed columns, so a data.frame
+// can be allocated once instead of binding a row per package. Columns are
+// ordered by first appearance; rows without a column and NA values get NA.
+type columns struct {
+	cols  []*column
+	index map[string]*column
+	nrow  int
+}
+
+func newColumns() *columns {
+	return &columns{index: make(map[string]*column)}
+}
+
+// add appends a row.
+func (c *columns) add(kvs []model.KV) error {
+	for _, kv := range kvs {
+		col := c.index[kv.Key]
+		if col == nil {
+			col = &column{name: kv.Key}
+			switch kv.Value.(type) {
+			case float64:
+				col.kind = realColumn
+			case string:
+				col.kind = stringColumn
+			}
+			for i := 0; i < c.nrow; i++ {
+				col.appendNA()
+			}
+			c.index[kv.Key] = col
+			c.cols = append(c.cols, col)
+		} else if col.len() > c.nrow {
+			return fmt.Errorf("duplicate column %s", kv.Key)
+		}
+		if kv.NA {
+			col.appendNA()
+		} else if err := col.append(kv.Value); err != nil {
+			return err
+		}
+	}
+	c.nrow++
+	for _, col := range c.cols {
+		if col.len() < c.nrow {
+			col.appendNA()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"Project2/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumns(t *testing.T) {
+	cols := newColumns()
+	assert.NoError(t, cols.add([]model.KV{{Key: "package", Value: "foo"}, {Key: "n", Value: 1}, {Key: "prop", Value: 0.5}}))
+	assert.NoError(t, cols.add([]model.KV{{Key: "package", Value: "bar"}, {Key: "n", Value: 2.5}, {Key: "query..x", Value: 3}}))
+	assert.NoError(t, cols.add([]model.KV{{Key: "package", Value: "baz"}}))
+	assert.Equal(t, 3, cols.nrow)
+	if assert.Len(t, cols.cols, 4) {
+		pkg, n, prop, query := cols.cols[0], cols.cols[1], cols.cols[2], cols.cols[3]
+		assert.Equal(t, stringColumn, pkg.kind)
+		assert.Equal(t, []string{"foo", "bar", "baz"}, pkg.strs)
+		// an integer column with a real value becomes real
+		assert.Equal(t, realColumn, n.kind)
+		assert.Equal(t, []float64{1, 2.5, 0}, n.reals)
+		assert.Equal(t, []bool{false, false, true}, n.na)
+		assert.Equal(t, []bool{false, true, true}, prop.na)
+		// a column first seen in a later row is NA in earlier ones
+		assert.Equal(t, "query..x", query.name)
+		assert.Equal(t, intColumn, query.kind)
+		assert.Equal(t, []int{0, 3, 0}, query.ints)
+		assert.Equal(t, []bool{true, false, true}, query.na)
+	}
+
+	// NA values keep the column's kind
+	assert.NoError(t, cols.add([]model.KV{{Key: "package", Value: "", NA: true}, {Key: "n", Value: 0, NA: true}}))
+	assert.Equal(t, []bool{false, false, false, true}, cols.cols[0].na)
+	assert.Equal(t, realColumn, cols.cols[1].kind)
+	assert.Equal(t, []bool{false, false, true, true}, cols.cols[1].na)
+
+	assert.Error(t, cols.add([]model.KV{{Key: "package", Value: 1}}))
+}
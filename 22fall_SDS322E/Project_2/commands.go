@@ -0,0 +1,159 @@
+package main
+
+import (
+	"Project2/analyzer"
+	"Project2/feature"
+	"Project2/model"
+	"Project2/store"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+// openInput opens an output file for reading, stdin for "-".
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// analyze parses a single package and prints it as JSON:
+//
+//	Project2 analyze foo_1.0.tar.gz
+//	Project2 analyze git:src/foo@v1.0
+func analyze(args []string) error {
+	flags := newFlagSet("analyze")
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	matchers, err := planMatchers(*flagMatchers, *flagQueries)
+	if err != nil {
+		return fmt.Errorf("failed to plan matchers: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	p, err := analyzer.Analyze(ctx, flags.Arg(0), analyzer.Options{Matchers: matchers, Limits: flagLimits()})
+	if err != nil {
+		return err
+	}
+	p.Name = p.Description.Package
+	p.Version = p.Description.Version
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// convert copies a JSON output stream into another output, usually a SQLite database:
+//
+//	Project2 convert output.json output.db
+func convert(args []string) error {
+	flags := newFlagSet("convert")
+	if err := parseArgs(flags, args, 2, 2); err != nil {
+		return err
+	}
+	return copyOutputs(flags.Arg(1), flags.Args()[:1])
+}
+
+// merge combines output shards into one output, skipping packages it already
+// has:
+//
+//	Project2 merge output.db shard1.json shard2.json
+func merge(args []string) error {
+	flags := newFlagSet("merge")
+	if err := parseArgs(flags, args, 2, -1); err != nil {
+		return err
+	}
+	return copyOutputs(flags.Arg(0), flags.Args()[1:])
+}
+
+// copyOutputs copies the packages of JSON outputs into out, skipping packages
+// it already has.
+func copyOutputs(out string, inputs []string) error {
+	sink, err := store.Open(out)
+	if err != nil {
+		return fmt.Errorf("error opening output: %w", err)
+	}
+	total := 0
+	for _, input := range inputs {
+		in, err := openInput(input)
+		if err != nil {
+			sink.Close()
+			return fmt.Errorf("error opening input: %w", err)
+		}
+		n, err := store.Copy(sink, in)
+		in.Close()
+		total += n
+		if err != nil {
+			sink.Close()
+			return fmt.Errorf("copied %d packages of %s before failing: %w", n, input, err)
+		}
+		log.Printf("Copied %d packages of %s", n, input)
+	}
+	if err := sink.Close(); err != nil {
+		return err
+	}
+	log.Printf("Wrote %d packages to %s", total, out)
+	return nil
+}
+
+// features extracts a feature table from a JSON output stream without R. The
+// format is taken from the output extension (.csv, .tsv or .parquet); "-" reads
+// from stdin or writes CSV to stdout. -extractors selects the feature groups:
+//
+//	Project2 -procs 8 features output.json features.parquet
+//	Project2 -extractors words,version features output.json -
+func features(args []string) error {
+	flags := newFlagSet("features")
+	if err := parseArgs(flags, args, 2, 2); err != nil {
+		return err
+	}
+	in, err := openInput(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("error opening input: %w", err)
+	}
+	defer in.Close()
+	format := feature.FormatCSV
+	if flags.Arg(1) != "-" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(flags.Arg(1))), ".")
+	}
+	if err := feature.CheckFormat(format); err != nil {
+		return usageError{err.Error()}
+	}
+	plan, err := planExtractors(*flagExtractors)
+	if err != nil {
+		return fmt.Errorf("failed to plan feature extractors: %w", err)
+	}
+	out := os.Stdout
+	if flags.Arg(1) != "-" {
+		if out, err = os.Create(flags.Arg(1)); err != nil {
+			return fmt.Errorf("error creating output: %w", err)
+		}
+	}
+	w, err := feature.NewWriter(out, format)
+	if err != nil {
+		return err
+	}
+	count := 0
+	err = feature.ExtractStream(in, *flagNumProcs, plan, func(p *model.P, f *model.F) error {
+		count++
+		return w.Write(f)
+	})
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil && out != os.Stdout {
+		err = out.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed after %d packages: %w", count, err)
+	}
+	log.Printf("Extracted features of %d packages", count)
+	return nil
+}
@@ -6,81 +6,82 @@ import (
 	"C"
 
 	"Project2/model"
-	"encoding/json"
-	"log"
 	"os"
 )
 import (
 	"Project2/feature"
 	"fmt"
-	"io"
-	"sync"
+	"strings"
 )
 
-//export ExtractFeatures
-func ExtractFeatures(filenameSexp C.SEXP, nProcsSexp C.SEXP) C.SEXP {
-	filename := GoString(filenameSexp)[0]
-	nProcs := int(C.asInteger(nProcsSexp))
-	f, err := os.Open(filename)
-	if err != nil {
-		log.Fatalf("Failed to open file %s: %v", filename, err)
-	}
-	wg := new(sync.WaitGroup)
-	inputChan := make(chan *model.P, nProcs)
-	outputChan := make(chan model.F, nProcs)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer close(inputChan)
-		dec := json.NewDecoder(f)
-		for {
-			p := new(model.P)
-			if err := dec.Decode(p); err != nil {
-				if err == io.EOF {
-					break
-				}
-				log.Panicf("Aborted: could not decode output file: %v", err)
-			}
-			inputChan <- p
+// goExtractFeatures extracts the features of the packages in an output file
+// with the named extractors, all if NULL, and returns them as a data.frame.
+// Packages for which an extractor failed are reported as failures; their row
+// has NA in that extractor's columns.
+//
+//export goExtractFeatures
+func goExtractFeatures(filenameSexp C.SEXP, nProcsSexp C.SEXP, extractorsSexp C.SEXP) C.SEXP {
+	return rCall(func() (C.SEXP, C.SEXP, error) {
+		var filename string
+		if err := RUnmarshal(filenameSexp, &filename); err != nil {
+			return C.R_NilValue, C.R_NilValue, argumentError("filename", err)
 		}
-	}()
-	for i := 0; i < nProcs; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for p := range inputChan {
-				f, err := feature.Extract(p)
-				if err != nil {
-					log.Printf("Error extracting feature: [%s] %s", p.Description.Package, err)
-					continue
-				}
-				outputChan <- *f
-			}
-		}()
-	}
-	go func() {
-		wg.Wait()
-		close(outputChan)
-	}()
+		var nProcs int
+		if err := RUnmarshal(nProcsSexp, &nProcs); err != nil {
+			return C.R_NilValue, C.R_NilValue, argumentError("nProcs", err)
+		}
+		if nProcs < 1 {
+			return C.R_NilValue, C.R_NilValue, argumentError("nProcs", fmt.Errorf("must be >= 1, got %d", nProcs))
+		}
+		var names []string
+		if err := RUnmarshal(extractorsSexp, &names); err != nil {
+			return C.R_NilValue, C.R_NilValue, argumentError("extractors", err)
+		}
+		plan, err := feature.Default.Plan(names...)
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, argumentError("extractors", err)
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, err
+		}
+		defer f.Close()
 
-	var df C.SEXP
+		cols := newColumns()
+		var failures []packageFailure
+		err = feature.ExtractStream(f, nProcs, plan, func(p *model.P, f *model.F) error {
+			if f.Errors != "" {
+				failures = append(failures, packageFailure{p.URL, f.Package, f.Errors})
+			}
+			fmt.Fprintf(rConsole{}, "\rProcessed %d packages", cols.nrow+1)
+			return cols.add(f.KVPairs())
+		})
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, fmt.Errorf("could not extract features: %w", err)
+		}
+		df := C.Rf_protect(RDataFrameColumns(cols))
+		defer C.Rf_unprotect(1)
+		cond, err := packageFailures(df, failures, cols.nrow)
+		return df, cond, err
+	})
+}
 
-	count := 0
-	for f := range outputChan {
-		//fmt.Printf("output is %v", f.KVPairs())
-		row := RDataFrame(MakeRList(f.KVPairs()))
-		rProtect(row)
-		if count == 0 {
-			df = row
-		} else {
-			rUnprotect(1)
-			df = RRbind(df, row)
+// goFeatureExtractors returns a data.frame of the feature extractors with
+// their name, description and dependencies separated by commas.
+//
+//export goFeatureExtractors
+func goFeatureExtractors() C.SEXP {
+	return rCall(func() (C.SEXP, C.SEXP, error) {
+		type extractorRow struct {
+			Name        string `r:"name"`
+			Description string `r:"description"`
+			Deps        string `r:"depends"`
+		}
+		var rows []extractorRow
+		for _, e := range feature.Default.Extractors() {
+			rows = append(rows, extractorRow{e.Name, e.Description, strings.Join(e.Deps, ",")})
 		}
-		rUnprotect(1)
-		rProtect(df)
-		count++
-		fmt.Printf("\rProcessed %d packages", count)
-	}
-	rUnprotect(1)
-	return df
+		ret, err := RMarshal(rows)
+		return ret, C.R_NilValue, err
+	})
 }
@@ -1,34 +1,144 @@
 package main
 
 import (
+	"Project2/analyzer"
 	"Project2/model"
 	"Project2/rparse"
+	"Project2/rparse/matcher"
+	"Project2/store"
 	"archive/tar"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"net"
 	"os"
-	"path/filepath"
-	"runtime/debug"
+	"path"
 	"strings"
 	"sync"
 	"time"
 )
 
-type Parser struct {
-	tmpRFile     *os.File
-	rParserAgent rparse.Agent
+// extractOptions are the optional settings of extractPackages.
+type extractOptions struct {
+	// Names and Versions are the package names and versions of the URLs,
+	// derived from the URLs if nil
+	Names    []string
+	Versions []string
+	// Matchers are run on every R file, all built-in matchers if nil
+	Matchers []rparse.MatcherSpec
+	// RetryFailed fetches packages in the failure ledger again, until they
+	// have failed MaxAttempts times
+	RetryFailed bool
+	MaxAttempts int
+	// Update refreshes the crawl status of the packages in the output against
+	// the URLs and fetches only package versions that are not in the output
+	Update bool
+	// Limits bound fetching and reading each package, analyzer.DefaultLimits if nil
+	Limits *analyzer.Limits
+	// MetricsAddr is the address to serve /metrics and /status on while
+	// crawling, none if empty
+	MetricsAddr string
+	// Drain stops starting new packages when closed
+	Drain <-chan struct{}
+	// Progress receives the progress lines, os.Stdout if nil. They are written
+	// by the goroutine calling extractPackages.
+	Progress io.Writer
+	// Metrics record the crawl, new metrics if nil
+	Metrics *crawlMetrics
+	// Completed is called by the workers with the index and result of every
+	// package written, and the reason it failed or ""
+	Completed func(i int, result string, reason string)
+}
 
-	currentPackage *model.P
+// packageFailure is a package that could not be processed, returned to R in
+// the failures attribute and the warning of an exported function.
+type packageFailure struct {
+	URL     string `r:"url"`
+	Package string `r:"package"`
+	Reason  string `r:"reason"`
 }
 
-func extractPackages(urls []string, outputType string, nProcs int) []string {
+// classifyFetchError returns the store.Failure* class of an error of ParseProject.
+func classifyFetchError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &analyzer.StatusError{}):
+		return store.FailureHTTP
+	case errors.As(err, &netErr):
+		return store.FailureNetwork
+	case errors.Is(err, gzip.ErrHeader), errors.Is(err, gzip.ErrChecksum),
+		errors.Is(err, tar.ErrHeader), errors.Is(err, io.ErrUnexpectedEOF):
+		return store.FailureArchive
+	}
+	return store.FailureOther
+}
+
+// packageNameFromURL returns the package name of a source tarball URL such as .../foo_1.0.tar.gz.
+func packageNameFromURL(url string) string {
+	name := path.Base(url)
+	if i := strings.IndexByte(name, '_'); i > 0 {
+		return name[:i]
+	}
+	return strings.TrimSuffix(name, ".tar.gz")
+}
+
+// packageVersionFromURL returns the package version of a source tarball URL such as .../foo_1.0.tar.gz.
+func packageVersionFromURL(url string) string {
+	name := strings.TrimSuffix(path.Base(url), ".tar.gz")
+	if i := strings.IndexByte(name, '_'); i > 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// extractAborted returns the error extractPackages aborted with, nil if it
+// ran.
+func extractAborted(ret []string) error {
+	if len(ret) == 1 && strings.HasPrefix(ret[0], "Aborted: ") {
+		return errors.New(strings.TrimPrefix(ret[0], "Aborted: "))
+	}
+	return nil
+}
+
+// extractPackages fetches and parses packages. With an output file, packages
+// already in the output are skipped and fetch failures are also appended to a
+// ledger next to it, which decides whether they are fetched again. Once opts.Drain is closed no more packages
+// are started; canceling ctx also abandons the packages in flight. Either way
+// the output is closed and the parsers' R processes and temp files removed.
+func extractPackages(ctx context.Context, urls []string, outputType string, nProcs int, opts extractOptions) []string {
 	ret := make([]string, len(urls))
+	progress := opts.Progress
+	if progress == nil {
+		progress = os.Stdout
+	}
+	matchers := opts.Matchers
+	if matchers == nil {
+		var err error
+		if matchers, err = matcher.Default.Plan(); err != nil {
+			return []string{fmt.Sprintf("Aborted: could not plan matchers: %v", err)}
+		}
+	}
+	names := opts.Names
+	if names == nil {
+		names = make([]string, len(urls))
+		for i, url := range urls {
+			names[i] = packageNameFromURL(url)
+		}
+	}
+	versions := opts.Versions
+	if versions == nil {
+		versions = make([]string, len(urls))
+		for i, url := range urls {
+			versions[i] = packageVersionFromURL(url)
+		}
+	}
+	crawlTime := time.Now().UTC()
 	skipURLs := make(map[string]bool)
 	var output func(i int, res model.P) error
+	var ledger *store.Ledger
 	switch outputType {
 	case "":
 		output = func(i int, pkg model.P) error {
@@ -40,175 +150,166 @@ func extractPackages(urls []string, outputType string, nProcs int) []string {
 			return nil
 		}
 	default:
-		var of *os.File
-		if _, err := os.Stat(outputType); err == nil {
-			of, err = os.OpenFile(outputType, os.O_APPEND|os.O_RDWR, 0640)
+		sink, err := store.Open(outputType)
+		if err != nil {
+			return []string{fmt.Sprintf("Aborted: could not open output: %v", err)}
+		}
+		defer sink.Close()
+		if opts.Update {
+			updater, ok := sink.(store.Updater)
+			if !ok {
+				return []string{fmt.Sprintf("Aborted: output %s does not support updates", outputType)}
+			}
+			index := make([]model.PackageVersion, len(urls))
+			for i := range urls {
+				index[i] = model.PackageVersion{Name: names[i], Version: versions[i]}
+			}
+			missing, err := store.Refresh(updater, index, crawlTime)
 			if err != nil {
-				return []string{fmt.Sprintf("Aborted: could not open output file: %v", err)}
+				return []string{fmt.Sprintf("Aborted: could not refresh output: %v", err)}
 			}
-			if _, err := of.Seek(0, io.SeekStart); err != nil {
-				return []string{fmt.Sprintf("Aborted: could not seek to start of output file: %v", err)}
+			fetch := make(map[model.PackageVersion]bool, len(missing))
+			for _, v := range missing {
+				fetch[v] = true
 			}
-			dec := json.NewDecoder(of)
-			for {
-				var res model.P
-				if err := dec.Decode(&res); err != nil {
-					if err == io.EOF {
-						break
-					}
-					return []string{fmt.Sprintf("Aborted: could not decode output file: %v", err)}
+			for i, url := range urls {
+				if !fetch[index[i]] {
+					skipURLs[url] = true
 				}
-				skipURLs[res.URL] = true
 			}
-		} else if !os.IsNotExist(err) {
-			return []string{fmt.Sprintf("Aborted: could not stat() output file: %v", err)}
-		} else {
-			of, err = os.Create(outputType)
-			if err != nil {
-				return []string{fmt.Sprintf("Aborted: error opening output file: %s", err)}
+			fmt.Fprintf(progress, "%d of %d packages are new or changed\n", len(missing), len(urls))
+		} else if skipURLs, err = sink.Done(); err != nil {
+			return []string{fmt.Sprintf("Aborted: could not read output: %v", err)}
+		}
+		if ledger, err = store.OpenLedger(outputType + ".failures"); err != nil {
+			return []string{fmt.Sprintf("Aborted: could not open failure ledger: %v", err)}
+		}
+		defer ledger.Close()
+		for _, url := range urls {
+			if attempts := ledger.Attempts(url); attempts > 0 && (!opts.RetryFailed || attempts >= opts.MaxAttempts) {
+				skipURLs[url] = true
 			}
 		}
-
-		defer of.Close()
-		outMutex := new(sync.Mutex)
-		enc := json.NewEncoder(of)
-		enc.SetIndent("", "  ")
 		output = func(i int, pkg model.P) error {
-			outMutex.Lock()
-			defer outMutex.Unlock()
-			return enc.Encode(pkg)
+			return sink.Write(&pkg)
 		}
 	}
 
-	parsers := make([]Parser, nProcs)
+	parsers := make([]*analyzer.Parser, nProcs)
+	agents := func() []rparse.AgentStats {
+		stats := make([]rparse.AgentStats, len(parsers))
+		for i := range parsers {
+			stats[i] = parsers[i].AgentStats()
+		}
+		return stats
+	}
+	metrics := opts.Metrics
+	if metrics == nil {
+		metrics = newCrawlMetrics(len(urls), nProcs, agents)
+	} else {
+		metrics.setAgents(agents)
+	}
+	defer func() {
+		for _, parser := range parsers {
+			if parser != nil {
+				parser.Close()
+			}
+		}
+	}()
+	for i := range parsers {
+		var err error
+		parsers[i], err = analyzer.NewParser(analyzer.Options{Matchers: matchers, Limits: opts.Limits, Observer: metrics})
+		if err != nil {
+			return []string{fmt.Sprintf("Aborted: %v", err)}
+		}
+	}
+	if opts.MetricsAddr != "" {
+		stop, err := metrics.serve(opts.MetricsAddr)
+		if err != nil {
+			return []string{fmt.Sprintf("Aborted: could not serve metrics: %v", err)}
+		}
+		defer stop()
+	}
 	wg := new(sync.WaitGroup)
 	workerChan := make(chan int)
 	for i := 0; i < int(nProcs); i++ {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			parser := &parsers[i]
-			if err := parser.rParserAgent.Start(""); err != nil {
-				log.Fatalf("could not start R parser agent: %v", err)
-			}
+			parser := parsers[i]
 			for idx := range workerChan {
 				url := urls[idx]
 				if skipURLs[url] {
+					metrics.skip()
+					continue
+				}
+				metrics.start(i, url, names[idx])
+				res, err := parser.Analyze(ctx, url)
+				if ctx.Err() != nil {
+					metrics.abandon(i)
 					continue
+				} else if err != nil {
+					res = &model.P{Schema: model.SchemaVersion, URL: url, FetchError: err.Error()}
 				}
-				var res *model.P
-				if err := parser.ParseProjectURL(url); err != nil {
-					res = &model.P{FetchError: err.Error()}
-				} else {
-					res = parser.GetParseResult()
+				res.Name = names[idx]
+				res.Version = versions[idx]
+				res.FirstSeen = crawlTime
+				res.LastSeen = crawlTime
+				res.Status = model.StatusCurrent
+				metrics.finish(i, res, err)
+				reason := res.FetchError
+				if ledger != nil && err != nil {
+					err = ledger.Record(store.Failure{
+						URL:   url,
+						Name:  names[idx],
+						Class: classifyFetchError(err),
+						Error: err.Error(),
+					})
 				}
-				if err := output(idx, *res); err != nil {
+				if err == nil {
+					err = output(idx, *res)
+				}
+				if err != nil {
 					ret[idx] = fmt.Sprintf("error writing output: %s", err)
+					reason = ret[idx]
+				}
+				if opts.Completed != nil {
+					opts.Completed(idx, ret[idx], reason)
 				}
 			}
 		}(i)
 	}
 
-	fmt.Printf("Starting to fetch %d packages with %d threads...\n", len(urls), nProcs)
+	fmt.Fprintf(progress, "Starting to fetch %d packages with %d threads...\n", len(urls), nProcs)
 	startTime := time.Now()
+	nDispatched := 0
+dispatch:
 	for i := range urls {
-		workerChan <- i
-		fmt.Printf("\rFetched %d/%d (%0.2f%%) ETA: %s", i+1, len(urls),
+		select {
+		case workerChan <- i:
+		case <-opts.Drain:
+			break dispatch
+		case <-ctx.Done():
+			break dispatch
+		}
+		nDispatched++
+		metrics.dispatch()
+		fmt.Fprintf(progress, "\rFetched %d/%d (%0.2f%%) ETA: %s", i+1, len(urls),
 			float64(i+1)/float64(len(urls))*100,
 			formatDuration(time.Since(startTime)/time.Duration(i+1)*time.Duration(len(urls)-i-1)))
 		agentStats := new(rparse.AgentStats)
 		for i := range parsers {
-			agentStats.Add(parsers[i].rParserAgent.Stats)
+			agentStats.Add(parsers[i].AgentStats())
 		}
-		fmt.Printf(" (R slave: %s )", agentStats.String())
+		fmt.Fprintf(progress, " (R slave: %s )", agentStats.String())
 	}
 	close(workerChan)
+	if nDispatched < len(urls) {
+		fmt.Fprintf(progress, "\nInterrupted: waiting for packages in flight, %d packages not started\n", len(urls)-nDispatched)
+	}
 	wg.Wait()
-	return ret
-}
-
-func (p *Parser) ParseProjectTar(tarFile *tar.Reader) error {
-	p.currentPackage = model.NewP()
-
-	hasDescription := false
-	hasNamespace := false
-	for {
-		header, err := tarFile.Next()
-		if err != nil && err == io.EOF {
-			if !hasDescription {
-				p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "DESCRIPTION", Message: "DESCRIPTION file not found"})
-			}
-			if !hasNamespace {
-				p.currentPackage.ParseError = append(p.currentPackage.ParseError, model.ParseError{Stage: "NAMESPACE", Message: "NAMESPACE file not found"})
-			}
-			return nil
-		} else if err != nil {
-			return err
-		}
-
-		fileName := header.Name
-		p.currentPackage.Files = append(p.currentPackage.Files, fileName)
-		fileName = fileName[strings.IndexByte(fileName, '/'):]
-		if fileName == "/DESCRIPTION" {
-			p.catchParseError("DESCRIPTION", header.Name, func() {
-				hasDescription = true
-				p.ParseDescriptionFile(tarFile)
-			})
-		} else if fileName == "/NAMESPACE" {
-			p.catchParseError("NAMESPACE", header.Name, func() {
-				hasNamespace = true
-				p.ParseNamespaceFile(tarFile)
-			})
-		} else {
-			ext := filepath.Ext(fileName)
-			ext = strings.ToLower(ext)
-			if ext == "" {
-				ext = "NONE"
-			}
-			p.currentPackage.FileExtensions[ext]++
-			if strings.HasPrefix(fileName, "/R/") && ext == ".r" {
-				p.catchParseError("SOURCE_R", header.Name, func() {
-					p.ParseRFile(fileName, tarFile)
-				})
-			}
-		}
+	if ctx.Err() != nil {
+		fmt.Fprintln(progress, "Aborted: packages in flight were not written")
 	}
-}
-
-func (p *Parser) ParseProjectURL(url string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-	gzReader, err := gzip.NewReader(resp.Body)
-	if err != nil {
-		return err
-	}
-	defer gzReader.Close()
-	tarReader := tar.NewReader(gzReader)
-	if err := p.ParseProjectTar(tarReader); err != nil {
-		return err
-	}
-	p.currentPackage.URL = url
-	return err
-}
-
-func (p *Parser) catchParseError(stage string, file string, parseFunc func()) {
-	func() {
-		defer func() {
-			if err := recover(); err != nil {
-				perr := model.ParseError{
-					Stage:   stage,
-					Message: fmt.Sprintf("%v", err),
-					Stack:   string(debug.Stack()),
-				}
-				p.currentPackage.ParseError = append(p.currentPackage.ParseError, perr)
-			}
-		}()
-		parseFunc()
-	}()
+	return ret
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	// #include <R.h>
+	// #include <Rinternals.h>
+	"C"
+
+	"Project2/model"
+	"fmt"
+	"io"
+	"os"
+)
+
+// goExtractPackageTables reads an output file and returns a named list of
+// data.frames with the details of its packages, see packageTables.
+//
+//export goExtractPackageTables
+func goExtractPackageTables(filenameSexp C.SEXP) C.SEXP {
+	return rCall(func() (C.SEXP, C.SEXP, error) {
+		var filename string
+		if err := RUnmarshal(filenameSexp, &filename); err != nil {
+			return C.R_NilValue, C.R_NilValue, argumentError("filename", err)
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			return C.R_NilValue, C.R_NilValue, err
+		}
+		defer f.Close()
+
+		tables := newPackageTables()
+		dec := model.NewDecoder(f)
+		for {
+			p := new(model.P)
+			if err := dec.Decode(p); err == io.EOF {
+				break
+			} else if err != nil {
+				return C.R_NilValue, C.R_NilValue, fmt.Errorf("could not decode package %d: %w", len(tables.Packages)+1, err)
+			}
+			tables.add(p)
+			fmt.Fprintf(rConsole{}, "\rRead %d packages", len(tables.Packages))
+		}
+		ret, err := RMarshal(tables)
+		return ret, C.R_NilValue, err
+	})
+}
@@ -0,0 +1,111 @@
+package feature
+
+import (
+	"Project2/model"
+	"strings"
+)
+
+// Top-level biocViews terms.
+const (
+	BiocSoftware       = "Software"
+	BiocAnnotationData = "AnnotationData"
+	BiocExperimentData = "ExperimentData"
+	BiocWorkflow       = "Workflow"
+)
+
+// biocViewsVocabulary is the biocViews term hierarchy as "parent: children" lines.
+const biocViewsVocabulary = `
+Software: AssayDomain BiologicalQuestion Infrastructure ResearchField StatisticalMethod Technology WorkflowStep ShinyApps
+AssayDomain: ArrayCGH CellBasedAssays ChIPchip CopyNumberVariation CpGIsland DNAMethylation ExonArray GeneExpression GeneticVariability SNP Transcription
+BiologicalQuestion: AlternativeSplicing Coverage DemethylateRegionDetection DifferentialDNA3DStructure DifferentialExpression DifferentialMethylation DifferentialPeakCalling DifferentialSplicing DNA3DStructure DriverMutation FunctionalPrediction GeneFusionDetection GenePrediction GeneRegulation GeneSetEnrichment GeneSignaling GeneTarget GenomeAnnotation GenomeAssembly GenomeWideAssociation GenomicVariation HistoneModification LinkageDisequilibrium MotifAnnotation MotifDiscovery NetworkEnrichment NetworkInference NucleosomePositioning PeakDetection QuantitativeTrait Scaffolding SomaticMutation StructuralPrediction TranscriptomeVariant VariantAnnotation VariantDetection
+Infrastructure: DataImport DataRepresentation GUI ThirdPartyClient
+ResearchField: Agroinformatics BiomedicalInformatics CellBiology Cheminformatics ComparativeGenomics Epigenetics FunctionalGenomics Genetics ImmunoOncology Lipidomics Metabolomics Metagenomics Pharmacogenetics Pharmacogenomics Phylogenetics Proteomics StructuralGenomics SystemsBiology Transcriptomics
+StatisticalMethod: Bayesian Classification Clustering DecisionTree DimensionReduction FeatureExtraction GraphAndNetwork HiddenMarkovModel MultipleComparison NeuralNetwork PrincipalComponent Regression SpatialStatistics StructuralEquationModels SupportVectorMachine Survival TimeCourse
+Technology: CRISPR FlowCytometry MassSpectrometry Microarray MicrotitrePlateAssay qPCR SAGE Sequencing SingleCell Spatial
+Microarray: MultiChannel OneChannel TwoChannel MethylationArray GenotypingArray mRNAMicroarray miRNAMicroarray ProprietaryPlatforms TissueMicroarray
+Sequencing: ATACSeq ChIPSeq DNASeq DNaseSeq ExomeSeq HiC MeDIPSeq MethylSeq MNaseSeq RIPSeq RNASeq SangerSeq SmallRNA Targeted WholeGenome LongRead
+WorkflowStep: Alignment Annotation BatchEffect ExperimentalDesign GenomeBrowsers Normalization Pathways Preprocessing QualityControl ReportWriting Visualization
+Pathways: BioCarta GO KEGG NetworkAnalysis Reactome
+AnnotationData: ChipManufacturer ChipName CustomArray CustomCDF CustomDBSchema FunctionalAnnotation Organism PackageType SequenceAnnotation
+ChipManufacturer: AffymetrixChip AgilentChip IlluminaChip NimbleGenChip
+PackageType: BSgenome ChipDb EnsDb FRMAParamData GODb InparanoidDb MeSHDb OrgDb PolyPhen SIFT SNPlocs TxDb XtraSNPlocs cdf db0 probe
+Organism: Anopheles_gambiae Arabidopsis_thaliana Bos_taurus Caenorhabditis_elegans Canis_familiaris Danio_rerio Drosophila_melanogaster Escherichia_coli Gallus_gallus Homo_sapiens Macaca_mulatta Mus_musculus Pan_troglodytes Rattus_norvegicus Saccharomyces_cerevisiae Sus_scrofa Xenopus_laevis
+ExperimentData: AssayDomainData DiseaseModel OrganismData PackageTypeData RepositoryData ReproducibleResearch SpecimenSource TechnologyData
+DiseaseModel: CancerData COPDData HIVData KidneyDiseaseData LeukemiaData
+RepositoryData: ArrayExpress GEO HapMap NCI PathwayInteractionDatabase SNPData
+SpecimenSource: CellCulture Genome Germline SomaticData StemCell Tissue
+TechnologyData: CGHData FlowCytometryData ImagingMassCytometryData MassSpectrometryData MicroarrayData SequencingData SingleCellData SpatialData qPCRData
+OrganismData: Arabidopsis_thaliana_Data Homo_sapiens_Data Mus_musculus_Data Rattus_norvegicus_Data Saccharomyces_cerevisiae_Data
+Workflow: AnnotationWorkflow BasicWorkflow DifferentialSplicingWorkflow EpigeneticsWorkflow GeneExpressionWorkflow GenomicVariantsWorkflow ImmunoOncologyWorkflow ProteomicsWorkflow ResourceQueryingWorkflow SingleCellWorkflow SpatialWorkflow
+`
+
+// biocViewsTop maps lower-cased biocViews terms to their top-level term.
+var biocViewsTop = func() map[string]string {
+	parents := make(map[string]string)
+	for _, line := range strings.Split(biocViewsVocabulary, "\n") {
+		parent, children, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		for _, child := range strings.Fields(children) {
+			parents[child] = parent
+		}
+	}
+	top := make(map[string]string)
+	for _, term := range []string{BiocSoftware, BiocAnnotationData, BiocExperimentData, BiocWorkflow} {
+		top[strings.ToLower(term)] = term
+	}
+	for term := range parents {
+		root := term
+		for parents[root] != "" {
+			root = parents[root]
+		}
+		top[strings.ToLower(term)] = root
+	}
+	return top
+}()
+
+var biocViewsExtractor = Extractor{
+	Name:        "bioc_views",
+	Description: "biocViews terms by top-level term",
+	Columns:     []string{"biocviews", "biocviews.type"},
+	Extract:     extractBiocViews,
+}
+
+func extractBiocViews(p *model.P, f *model.F) error {
+	f.BiocViews = model.BiocViewCounts{}
+	for _, term := range p.Description.BiocViews {
+		if term == "" {
+			continue
+		}
+		switch biocViewsTop[strings.ToLower(term)] {
+		case BiocSoftware:
+			f.BiocViews.Software++
+		case BiocAnnotationData:
+			f.BiocViews.AnnotationData++
+		case BiocExperimentData:
+			f.BiocViews.ExperimentData++
+		case BiocWorkflow:
+			f.BiocViews.Workflow++
+		default:
+			f.BiocViews.Unknown++
+		}
+	}
+	f.BiocViewsType = ""
+	best := 0
+	for _, top := range []struct {
+		name  string
+		count int
+	}{
+		{BiocSoftware, f.BiocViews.Software},
+		{BiocAnnotationData, f.BiocViews.AnnotationData},
+		{BiocExperimentData, f.BiocViews.ExperimentData},
+		{BiocWorkflow, f.BiocViews.Workflow},
+	} {
+		if top.count > best {
+			f.BiocViewsType = top.name
+			best = top.count
+		}
+	}
+	return nil
+}
@@ -2,21 +2,63 @@ package feature
 
 import (
 	"Project2/model"
+	"fmt"
 	"log"
+	"strings"
 )
 
-var extractFunctions = make(map[string]func(*model.P, *model.F) error)
-
-func Extract(p *model.P) (f *model.F, err error) {
-	f = &model.F{
+// Extract extracts the features of a package with the extractors of a plan,
+// all of Default's if nil. An extractor that fails, or whose dependency failed,
+// leaves its columns NA and adds why to f.Errors. The columns of Default's
+// extractors that are not planned are NA as well.
+func Extract(p *model.P, plan []Extractor) *model.F {
+	if plan == nil {
+		plan = Default.extractors
+	}
+	f := &model.F{
 		Package: p.Description.Package,
+		Version: p.Description.Version,
+		Missing: make(map[string]bool),
 	}
-	for name, fn := range extractFunctions {
-		if err := fn(p, f); err != nil {
-			log.Printf("Error extracting feature: [%s::%s] %s", p.Description.Package, name, err)
-			return nil, err
+	for _, e := range Default.extractors {
+		for _, col := range e.Columns {
+			f.Missing[col] = true
+		}
+	}
+	failed := make(map[string]bool)
+	var errs []string
+	for _, e := range plan {
+		err := runExtractor(e, p, f, failed)
+		if err != nil {
+			log.Printf("Error extracting feature: [%s::%s] %s", p.Description.Package, e.Name, err)
+			failed[e.Name] = true
+			errs = append(errs, fmt.Sprintf("%s: %s", e.Name, err))
+		}
+		for _, col := range e.Columns {
+			if err != nil {
+				f.Missing[col] = true
+			} else {
+				delete(f.Missing, col)
+			}
 		}
 	}
+	f.Errors = strings.Join(errs, "; ")
 	f.FloatCheck()
-	return f, nil
+	return f
+}
+
+// runExtractor runs an extractor unless one of its dependencies failed,
+// returning its error or panic.
+func runExtractor(e Extractor, p *model.P, f *model.F, failed map[string]bool) (err error) {
+	for _, dep := range e.Deps {
+		if failed[dep] {
+			return fmt.Errorf("dependency %s failed", dep)
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return e.Extract(p, f)
 }
@@ -2,13 +2,18 @@ package feature
 
 import "Project2/model"
 
-func init() {
-	extractFunctions["dependency"] = func(p *model.P, f *model.F) error {
-		if p.Namespace.Exports != nil {
-			f.RExportNum = len(p.Namespace.Exports)
-		}
-		f.RImportToDepend = float64(len(p.Description.Imports)) / float64(len(p.Description.Depends))
-
-		return nil
+var dependencyExtractor = Extractor{
+	Name:        "dependency",
+	Description: "Number of exports and ratio of Imports to Depends",
+	Columns:     []string{"export.num", "r_import_to_depend"},
+	Extract:     extractDependency,
+}
+
+func extractDependency(p *model.P, f *model.F) error {
+	if p.Namespace.Exports != nil {
+		f.RExportNum = len(p.Namespace.Exports)
 	}
+	f.RImportToDepend = float64(len(p.Description.Imports)) / float64(len(p.Description.Depends))
+
+	return nil
 }
@@ -7,37 +7,40 @@ import (
 	"strings"
 )
 
-func init() {
-	extractFunctions["naming_convention"] = func(p *model.P, f *model.F) error {
-		f.NameVariable = model.NamingConvention{}
-		f.NameExport = model.NamingConvention{}
-		f.NameRFile = model.NamingConvention{}
-		if p.Namespace.Exports != nil {
-			for _, e := range p.Namespace.Exports {
-				countNamingConvention(&f.NameExport, e)
-			}
+var namingExtractor = Extractor{
+	Name:        "naming_convention",
+	Description: "Naming conventions of variables, exports and R files",
+	Columns:     []string{"var.naming", "export.naming", "rfile.naming", "var.naming.prop", "export.naming.prop", "rfile.naming.prop"},
+	Extract:     extractNaming,
+}
+
+func extractNaming(p *model.P, f *model.F) error {
+	f.NameVariable = model.NamingConvention{}
+	f.NameExport = model.NamingConvention{}
+	f.NameRFile = model.NamingConvention{}
+	if p.Namespace.Exports != nil {
+		for _, e := range p.Namespace.Exports {
+			countNamingConvention(&f.NameExport, e)
 		}
-		if p.RFiles != nil {
-			for _, file := range p.RFiles {
-				baseName := path.Base(file.Name)
-				baseName = strings.TrimSuffix(baseName, path.Ext(baseName))
-				countNamingConvention(&f.NameRFile, baseName)
-				if state := file.Stats[matcher.MatchAssignment]; state != nil {
-					var assignmentState matcher.MatchAssignmentState
-					if err := remarshalAs(state, &assignmentState); err != nil {
-						return err
-					}
-					for _, v := range assignmentState.StatsVariables {
+	}
+	if p.RFiles != nil {
+		for _, file := range p.RFiles {
+			baseName := path.Base(file.Name)
+			baseName = strings.TrimSuffix(baseName, path.Ext(baseName))
+			countNamingConvention(&f.NameRFile, baseName)
+			if state := file.Stats.Assignment; state != nil {
+				for _, v := range state.StatsVariables {
+					if v.TargetKind == matcher.TargetSymbol {
 						countNamingConvention(&f.NameVariable, v.Name)
 					}
 				}
 			}
-			f.NameRFileProp = f.NameRFile.Props()
-			f.NameExportProp = f.NameExport.Props()
-			f.NameVariableProp = f.NameVariable.Props()
 		}
-		return nil
+		f.NameRFileProp = f.NameRFile.Props()
+		f.NameExportProp = f.NameExport.Props()
+		f.NameVariableProp = f.NameVariable.Props()
 	}
+	return nil
 }
 func countNamingConvention(counts *model.NamingConvention, ident string) {
 	if ident == "" {
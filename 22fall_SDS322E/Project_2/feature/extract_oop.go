@@ -0,0 +1,152 @@
+package feature
+
+import (
+	"Project2/model"
+	"Project2/rparse/matcher"
+)
+
+// baseS3Generics are common S3 generics from base R packages that packages define methods for.
+var baseS3Generics = map[string]bool{
+	"print": true, "format": true, "summary": true, "plot": true, "toString": true,
+	"as.character": true, "as.data.frame": true, "as.list": true, "as.vector": true,
+	"as.numeric": true, "as.double": true, "as.integer": true, "as.logical": true, "as.matrix": true,
+	"c": true, "length": true, "names": true, "dim": true, "head": true, "tail": true,
+	"mean": true, "median": true, "merge": true, "predict": true, "residuals": true,
+	"fitted": true, "coef": true, "update": true, "anova": true, "logLik": true,
+	"unique": true, "duplicated": true, "rev": true, "sort": true, "subset": true,
+	"transform": true, "with": true, "split": true, "levels": true, "t": true, "str": true,
+	"seq": true, "rep": true, "all.equal": true, "simulate": true, "vcov": true, "nobs": true,
+	"$": true, "[": true, "[[": true, "Ops": true, "Math": true, "Summary": true,
+}
+
+// s3Generic returns the generic a function named generic.class is a method of, if any.
+func s3Generic(name string, generics map[string]bool) string {
+	for i := 1; i < len(name)-1; i++ {
+		if name[i] == '.' && (generics[name[:i]] || baseS3Generics[name[:i]]) {
+			return name[:i]
+		}
+	}
+	return ""
+}
+
+var objectSystemExtractor = Extractor{
+	Name:        "object_system",
+	Description: "Classes, generics and methods of the S3, S4, RC and R6 object systems",
+	Columns:     []string{"oop.system", "oop"},
+	Extract:     extractObjectSystem,
+}
+
+func extractObjectSystem(p *model.P, f *model.F) error {
+	f.ObjectSystems = model.ObjectSystemCounts{}
+	classes := make(map[string]*matcher.ObjectClass)
+	s4Generics := make(map[string]bool)
+	s4Defined := make(map[string]bool)
+	s3Generics := make(map[string]bool)
+	var candidates []string
+	for _, file := range p.RFiles {
+		state := file.Stats.ObjectSystem
+		if state == nil {
+			continue
+		}
+		for _, class := range state.Classes {
+			merged := classes[class.Name]
+			if merged == nil {
+				merged = new(matcher.ObjectClass)
+				classes[class.Name] = merged
+			}
+			if class.Defined {
+				merged.System = class.System
+				merged.Defined = true
+			}
+			merged.Fields = append(merged.Fields, class.Fields...)
+			merged.Methods = append(merged.Methods, class.Methods...)
+			merged.Validity = merged.Validity || class.Validity
+		}
+		for _, generic := range state.Generics {
+			switch generic.System {
+			case matcher.SystemS4:
+				s4Generics[generic.Name] = true
+				if generic.Defined {
+					s4Defined[generic.Name] = true
+				}
+				f.ObjectSystems.S4Methods += len(generic.Methods)
+			case matcher.SystemS3:
+				s3Generics[generic.Name] = true
+			}
+		}
+		candidates = append(candidates, state.S3MethodCandidates...)
+	}
+	for _, class := range classes {
+		if !class.Defined {
+			continue
+		}
+		switch class.System {
+		case matcher.SystemS4:
+			f.ObjectSystems.S4Classes++
+		case matcher.SystemRC:
+			f.ObjectSystems.RCClasses++
+		case matcher.SystemR6:
+			f.ObjectSystems.R6Classes++
+		}
+		f.ObjectSystems.Fields += len(class.Fields)
+		f.ObjectSystems.ClassMethods += len(class.Methods)
+		if class.Validity {
+			f.ObjectSystems.ClassesWithValidity++
+		}
+	}
+	f.ObjectSystems.S4Generics = len(s4Defined)
+	f.ObjectSystems.S3Generics = len(s3Generics)
+
+	registered := make(map[string]bool)
+	for _, method := range p.Namespace.S3Methods {
+		registered[method] = true
+	}
+	defined := make(map[string]bool)
+	for _, name := range candidates {
+		defined[name] = true
+		if registered[name] || s3Generic(name, s3Generics) != "" {
+			f.ObjectSystems.S3Methods++
+			if registered[name] {
+				f.ObjectSystems.S3MethodsRegistered++
+			}
+		}
+	}
+	for method := range registered {
+		if !defined[method] {
+			f.ObjectSystems.S3MethodsUndefined++
+		}
+	}
+
+	for _, class := range p.Namespace.ExportClasses {
+		if classes[class] != nil && classes[class].Defined {
+			f.ObjectSystems.ClassesExported++
+		} else {
+			f.ObjectSystems.ClassesUndefined++
+		}
+	}
+	for _, generic := range p.Namespace.ExportMethods {
+		if s4Generics[generic] {
+			f.ObjectSystems.GenericsExported++
+		} else {
+			f.ObjectSystems.GenericsUndefined++
+		}
+	}
+
+	f.ObjectSystem = "none"
+	best := 0
+	for _, system := range []struct {
+		name  string
+		count int
+	}{
+		{matcher.SystemS4, f.ObjectSystems.S4Classes + f.ObjectSystems.S4Generics},
+		{matcher.SystemRC, f.ObjectSystems.RCClasses},
+		{matcher.SystemR6, f.ObjectSystems.R6Classes},
+		{matcher.SystemS3, f.ObjectSystems.S3Generics + f.ObjectSystems.S3Methods},
+	} {
+		if system.count > best {
+			f.ObjectSystem = system.name
+			best = system.count
+		}
+	}
+	return nil
+}
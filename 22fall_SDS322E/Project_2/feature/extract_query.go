@@ -0,0 +1,23 @@
+package feature
+
+import "Project2/model"
+
+var queryExtractor = Extractor{
+	Name:        "query",
+	Description: "Match counts of token pattern queries",
+	Columns:     []string{"query"},
+	Extract:     extractQueries,
+}
+
+func extractQueries(p *model.P, f *model.F) error {
+	f.Queries = make(map[string]int, len(p.Queries))
+	for _, name := range p.Queries {
+		f.Queries[name] = 0
+	}
+	for _, file := range p.RFiles {
+		for name, state := range file.Stats.Queries {
+			f.Queries[name] += len(state.Matches)
+		}
+	}
+	return nil
+}
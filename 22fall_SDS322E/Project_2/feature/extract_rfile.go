@@ -1,30 +1,28 @@
 package feature
 
-import (
-	"Project2/model"
-	"Project2/rparse/matcher"
-)
+import "Project2/model"
 
-func init() {
-	extractFunctions["r_file"] = func(p *model.P, f *model.F) error {
-		countEqAssign := 0
-		countLeftAssign := 0
-		sumTokens := 0
-		if p.RFiles != nil {
-			for _, file := range p.RFiles {
-				sumTokens += file.NTokens
-				if stats := file.Stats[matcher.MatchAssignment]; stats != nil {
-					var state matcher.MatchAssignmentState
-					if err := remarshalAs(stats, &state); err != nil {
-						return err
-					}
-					countEqAssign += state.StatsEqAssignCount
-					countLeftAssign += state.StatsLeftAssignCount
-				}
+var rFileExtractor = Extractor{
+	Name:        "r_file",
+	Description: "Proportion of = assignments and average tokens per R file",
+	Columns:     []string{"eq_assign.prop", "avg_r_tokens"},
+	Extract:     extractRFile,
+}
+
+func extractRFile(p *model.P, f *model.F) error {
+	countEqAssign := 0
+	countLeftAssign := 0
+	sumTokens := 0
+	if p.RFiles != nil {
+		for _, file := range p.RFiles {
+			sumTokens += file.NTokens
+			if state := file.Stats.Assignment; state != nil {
+				countEqAssign += state.StatsEqAssignCount
+				countLeftAssign += state.StatsLeftAssignCount
 			}
-			f.AvgRTokens = float64(sumTokens) / float64(len(p.RFiles))
 		}
-		f.PropEqAssign = float64(countEqAssign) / float64(countEqAssign+countLeftAssign)
-		return nil
+		f.AvgRTokens = float64(sumTokens) / float64(len(p.RFiles))
 	}
+	f.PropEqAssign = float64(countEqAssign) / float64(countEqAssign+countLeftAssign)
+	return nil
 }
@@ -3,24 +3,46 @@ package feature
 import (
 	"Project2/model"
 	"log"
-	"net/url"
 	"strings"
 )
 
-func init() {
-	extractFunctions["package_source"] = func(p *model.P, f *model.F) error {
-		url, err := url.Parse(p.URL)
-		if err != nil {
-			return err
-		}
-		if strings.HasSuffix(url.Host, "r-project.org") {
-			f.Repo = "CRAN"
-		} else if strings.HasSuffix(url.Host, "bioconductor.org") {
-			f.Repo = "Bioconductor"
-		} else {
-			log.Printf("Unknown repo: %s", url.Host)
-			f.Repo = "Other"
+// PackageSource classifies where a package came from with repos.
+func PackageSource(p *model.P, repos *RepoRegistry) Source {
+	source := repos.Classify(p.URL)
+	// packages with biocViews fetched from elsewhere, e.g. development versions
+	// on GitHub, are Bioconductor packages with where they came from as the origin
+	if hasBiocViews(p) && (source.Repo == RepoOther || source.Repo == RepoLocal || source.Repo == RepoGitHub) {
+		source.Origin = source.Repo
+		source.Repo = RepoBioconductor
+	}
+	return source
+}
+
+// hasBiocViews reports whether the DESCRIPTION of p has a non-empty biocViews term.
+func hasBiocViews(p *model.P) bool {
+	for _, term := range p.Description.BiocViews {
+		if strings.TrimSpace(term) != "" {
+			return true
 		}
-		return nil
 	}
+	return false
+}
+
+var packageSourceExtractor = Extractor{
+	Name:        "package_source",
+	Description: "Repository, branch and section the package was fetched from",
+	Columns:     []string{"repo", "repo.branch", "repo.section", "repo.origin"},
+	Extract:     extractPackageSource,
+}
+
+func extractPackageSource(p *model.P, f *model.F) error {
+	source := PackageSource(p, Repos)
+	if source.Repo == RepoOther {
+		log.Printf("Unknown repo: %s", p.URL)
+	}
+	f.Repo = source.Repo
+	f.RepoBranch = source.Branch
+	f.RepoSection = source.Section
+	f.RepoOrigin = source.Origin
+	return nil
 }
@@ -6,13 +6,18 @@ import (
 	"strconv"
 )
 
-func init() {
-	extractFunctions["version"] = func(p *model.P, f *model.F) error {
-		if submatch := regexp.MustCompile("^(\\d+)").FindStringSubmatch(p.Description.Version); submatch != nil {
-			f.MajorVersion, _ = strconv.Atoi(submatch[1])
-		} else {
-			f.MajorVersion = -1
-		}
-		return nil
+var versionExtractor = Extractor{
+	Name:        "version",
+	Description: "Major version number",
+	Columns:     []string{"version.major"},
+	Extract:     extractVersion,
+}
+
+func extractVersion(p *model.P, f *model.F) error {
+	if submatch := regexp.MustCompile("^(\\d+)").FindStringSubmatch(p.Description.Version); submatch != nil {
+		f.MajorVersion, _ = strconv.Atoi(submatch[1])
+	} else {
+		f.MajorVersion = -1
 	}
+	return nil
 }
@@ -5,10 +5,15 @@ import (
 	"strings"
 )
 
-func init() {
-	extractFunctions["extract_words"] = func(p *model.P, f *model.F) error {
-		f.TitleWords = len(strings.Fields(p.Description.Title))
-		f.DescriptionWords = len(strings.Fields(p.Description.Description))
-		return nil
-	}
+var wordsExtractor = Extractor{
+	Name:        "words",
+	Description: "Number of words in the Title and Description",
+	Columns:     []string{"title.words", "description.words"},
+	Extract:     extractWords,
+}
+
+func extractWords(p *model.P, f *model.F) error {
+	f.TitleWords = len(strings.Fields(p.Description.Title))
+	f.DescriptionWords = len(strings.Fields(p.Description.Description))
+	return nil
 }
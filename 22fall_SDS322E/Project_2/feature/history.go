@@ -0,0 +1,89 @@
+package feature
+
+import (
+	"Project2/model"
+	"sort"
+	"strings"
+)
+
+// SortReleases sorts releases of a package by their DESCRIPTION version.
+func SortReleases(releases []*model.P) {
+	sort.SliceStable(releases, func(i, j int) bool {
+		return model.CompareVersions(releases[i].Description.Version, releases[j].Description.Version) < 0
+	})
+}
+
+// Deltas returns the changes between consecutive releases, which must be sorted.
+func Deltas(releases []*model.P) []model.Delta {
+	var deltas []model.Delta
+	for i := 1; i < len(releases); i++ {
+		from, to := releases[i-1], releases[i]
+		d := model.Delta{
+			Package: to.Description.Package,
+			From:    from.Description.Version,
+			To:      to.Description.Version,
+		}
+		added, removed := diffNames(from.Namespace.Exports, to.Namespace.Exports)
+		d.ExportsAdded, d.ExportsRemoved = len(added), len(removed)
+		d.ExportsAddedNames, d.ExportsRemovedNames = strings.Join(added, " "), strings.Join(removed, " ")
+		added, removed = diffNames(dependencies(from), dependencies(to))
+		d.DepsAdded, d.DepsRemoved = len(added), len(removed)
+		d.DepsAddedNames, d.DepsRemovedNames = strings.Join(added, " "), strings.Join(removed, " ")
+		d.RFilesDelta = len(to.RFiles) - len(from.RFiles)
+		d.TokensDelta = countTokens(to) - countTokens(from)
+		d.FunctionsDelta = countFunctionDefs(to) - countFunctionDefs(from)
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+func dependencies(p *model.P) []string {
+	var deps []string
+	for _, dep := range append(append([]string{}, p.Description.Depends...), p.Description.Imports...) {
+		if dep != "" && dep != "R" {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// diffNames returns the sorted names in to but not in from, and in from but not in to.
+func diffNames(from, to []string) (added, removed []string) {
+	inFrom := make(map[string]bool, len(from))
+	for _, name := range from {
+		inFrom[name] = true
+	}
+	inTo := make(map[string]bool, len(to))
+	for _, name := range to {
+		if !inFrom[name] && !inTo[name] {
+			added = append(added, name)
+		}
+		inTo[name] = true
+	}
+	for name := range inFrom {
+		if !inTo[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func countTokens(p *model.P) int {
+	n := 0
+	for _, file := range p.RFiles {
+		n += file.NTokens
+	}
+	return n
+}
+
+func countFunctionDefs(p *model.P) int {
+	n := 0
+	for _, file := range p.RFiles {
+		if state := file.Stats.FunctionDef; state != nil {
+			n += len(state.StatFunctionDefs)
+		}
+	}
+	return n
+}
@@ -0,0 +1,39 @@
+package feature
+
+import (
+	"Project2/model"
+	"Project2/rparse/matcher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func release(version string, exports []string, imports []string, tokens int, functions int) *model.P {
+	p := model.NewP()
+	p.Description.Package = "foo"
+	p.Description.Version = version
+	p.Description.Depends = []string{"R"}
+	p.Description.Imports = imports
+	p.Namespace.Exports = exports
+	p.RFiles = []model.RFile{{NTokens: tokens, Stats: model.FileStats{
+		FunctionDef: &matcher.MatchFunctionDefState{StatFunctionDefs: make([]matcher.Function, functions)},
+	}}}
+	return p
+}
+
+func TestDeltas(t *testing.T) {
+	releases := []*model.P{
+		release("1.10", []string{"a", "c"}, []string{"stats"}, 300, 5),
+		release("1.2-1", []string{"a", "b"}, []string{"stats", "utils"}, 200, 4),
+		release("1.2", []string{"a", "b"}, []string{"stats"}, 100, 2),
+	}
+	SortReleases(releases)
+	deltas := Deltas(releases)
+	assert.Equal(t, []model.Delta{
+		{Package: "foo", From: "1.2", To: "1.2-1", DepsAdded: 1, DepsAddedNames: "utils", TokensDelta: 100, FunctionsDelta: 2},
+		{Package: "foo", From: "1.2-1", To: "1.10",
+			ExportsAdded: 1, ExportsRemoved: 1, ExportsAddedNames: "c", ExportsRemovedNames: "b",
+			DepsRemoved: 1, DepsRemovedNames: "utils", TokensDelta: 100, FunctionsDelta: 1},
+	}, deltas)
+	assert.Equal(t, "from", deltas[0].Header()[1])
+}
@@ -0,0 +1,121 @@
+package feature
+
+import (
+	"Project2/model"
+	"fmt"
+)
+
+// Extractor computes a group of features of a package.
+type Extractor struct {
+	Name        string
+	Description string
+	// Deps are the extractors whose features Extract reads
+	Deps []string
+	// Columns are the csv tags of the model.F fields Extract sets, which are
+	// NA if it fails or is not run
+	Columns []string
+	Extract func(p *model.P, f *model.F) error
+}
+
+// Registry holds extractors in the order they run. An extractor must be
+// registered after its dependencies.
+type Registry struct {
+	extractors []Extractor
+	index      map[string]int
+}
+
+func (r *Registry) Register(e Extractor) error {
+	if r.index == nil {
+		r.index = make(map[string]int)
+	}
+	if _, ok := r.index[e.Name]; ok {
+		return fmt.Errorf("feature extractor %s already registered", e.Name)
+	}
+	for _, dep := range e.Deps {
+		if _, ok := r.index[dep]; !ok {
+			return fmt.Errorf("feature extractor %s depends on unregistered extractor %s", e.Name, dep)
+		}
+	}
+	r.index[e.Name] = len(r.extractors)
+	r.extractors = append(r.extractors, e)
+	return nil
+}
+
+func (r *Registry) MustRegister(e Extractor) {
+	if err := r.Register(e); err != nil {
+		panic(err)
+	}
+}
+
+// Extractors returns all registered extractors in registration order.
+func (r *Registry) Extractors() []Extractor {
+	return append([]Extractor(nil), r.extractors...)
+}
+
+// Names returns the names of all registered extractors in registration order.
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.extractors))
+	for i, e := range r.extractors {
+		names[i] = e.Name
+	}
+	return names
+}
+
+// Plan returns the named extractors and their dependencies in registration
+// order. All extractors are planned if names is empty.
+func (r *Registry) Plan(names ...string) ([]Extractor, error) {
+	if len(names) == 0 {
+		return r.Extractors(), nil
+	}
+	selected := make([]bool, len(r.extractors))
+	var visit func(name string) error
+	visit = func(name string) error {
+		idx, ok := r.index[name]
+		if !ok {
+			return fmt.Errorf("unknown feature extractor %s", name)
+		}
+		if selected[idx] {
+			return nil
+		}
+		selected[idx] = true
+		for _, dep := range r.extractors[idx].Deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	var plan []Extractor
+	for i, e := range r.extractors {
+		if selected[i] {
+			plan = append(plan, e)
+		}
+	}
+	return plan, nil
+}
+
+// Default holds the built-in extractors, in the order of their columns.
+var Default = func() *Registry {
+	r := new(Registry)
+	for _, e := range []Extractor{
+		packageSourceExtractor,
+		wordsExtractor,
+		rFileExtractor,
+		namingExtractor,
+		functionCallsExtractor,
+		dependencyExtractor,
+		versionExtractor,
+		fileExtensionExtractor,
+		objectSystemExtractor,
+		biocViewsExtractor,
+		queryExtractor,
+	} {
+		r.MustRegister(e)
+	}
+	return r
+}()
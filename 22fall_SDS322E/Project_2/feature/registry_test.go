@@ -0,0 +1,99 @@
+package feature
+
+import (
+	"Project2/model"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryPlan(t *testing.T) {
+	noop := func(p *model.P, f *model.F) error { return nil }
+	r := new(Registry)
+	assert.NoError(t, r.Register(Extractor{Name: "a", Extract: noop}))
+	assert.NoError(t, r.Register(Extractor{Name: "b", Deps: []string{"a"}, Extract: noop}))
+	assert.NoError(t, r.Register(Extractor{Name: "c", Extract: noop}))
+	assert.Error(t, r.Register(Extractor{Name: "c", Extract: noop}))
+	assert.Error(t, r.Register(Extractor{Name: "d", Deps: []string{"e"}, Extract: noop}))
+
+	plan, err := r.Plan("c", "b")
+	assert.NoError(t, err)
+	var names []string
+	for _, e := range plan {
+		names = append(names, e.Name)
+	}
+	// dependencies are added and the registration order kept
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	_, err = r.Plan("missing")
+	assert.Error(t, err)
+}
+
+func TestDefaultColumns(t *testing.T) {
+	// every feature column but the package's is set by exactly one extractor
+	owners := make(map[string]string)
+	for _, e := range Default.Extractors() {
+		for _, col := range e.Columns {
+			assert.Empty(t, owners[col], "column %s of %s", col, e.Name)
+			owners[col] = e.Name
+		}
+	}
+	typ := reflect.TypeOf(model.F{})
+	for i := 0; i < typ.NumField(); i++ {
+		switch tag := typ.Field(i).Tag.Get("csv"); tag {
+		case "package", "version", "errors", "-":
+		default:
+			assert.NotEmpty(t, owners[tag], "column %s", tag)
+		}
+	}
+}
+
+func TestExtractFailure(t *testing.T) {
+	failing := Extractor{
+		Name:    "failing",
+		Columns: []string{"title.words"},
+		Extract: func(p *model.P, f *model.F) error {
+			f.TitleWords = 3
+			return errors.New("boom")
+		},
+	}
+	dependent := Extractor{
+		Name:    "dependent",
+		Deps:    []string{"failing"},
+		Columns: []string{"call.rpart"},
+		Extract: func(p *model.P, f *model.F) error { return nil },
+	}
+	panicking := Extractor{
+		Name:    "panicking",
+		Columns: []string{"export.num"},
+		Extract: func(p *model.P, f *model.F) error { panic("oops") },
+	}
+	p := model.NewP()
+	p.Description.Package = "foo"
+	p.Description.Version = "2.1"
+	f := Extract(p, []Extractor{failing, versionExtractor, dependent, panicking})
+	assert.Equal(t, "failing: boom; dependent: dependency failing failed; panicking: panic: oops", f.Errors)
+	assert.Equal(t, 2, f.MajorVersion)
+
+	kvs := make(map[string]model.KV)
+	for _, kv := range f.KVPairs() {
+		kvs[kv.Key] = kv
+	}
+	assert.True(t, kvs["title.words"].NA)
+	assert.True(t, kvs["call.rpart"].NA)
+	assert.True(t, kvs["export.num"].NA)
+	assert.False(t, kvs["version.major"].NA)
+	// columns of extractors not run are NA too
+	assert.True(t, kvs["repo"].NA)
+	assert.True(t, kvs["oop..s4.classes"].NA)
+	assert.False(t, kvs["package"].NA)
+	assert.Contains(t, f.FieldValues(), "NA")
+}
+
+func TestExtractStreamWorkers(t *testing.T) {
+	err := ExtractStream(strings.NewReader(""), 0, nil, func(p *model.P, f *model.F) error { return nil })
+	assert.Error(t, err)
+}
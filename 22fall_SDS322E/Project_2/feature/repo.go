@@ -0,0 +1,125 @@
+package feature
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Repositories packages are classified into.
+const (
+	RepoCRAN         = "CRAN"
+	RepoBioconductor = "Bioconductor"
+	RepoRUniverse    = "R-universe"
+	RepoGitHub       = "GitHub"
+	RepoLocal        = "Local"
+	RepoOther        = "Other"
+)
+
+// RepoRule assigns source URLs matching Pattern to Repo. The named groups
+// "branch" and "section" of Pattern, if present, give the branch and section
+// of the repository, e.g. "3.16" and "bioc" for Bioconductor.
+type RepoRule struct {
+	Repo    string
+	Pattern *regexp.Regexp
+}
+
+// Source is the repository a package was fetched from.
+type Source struct {
+	Repo    string
+	Branch  string
+	Section string
+	// Origin is the repository the URL was classified as when Repo is inferred
+	// from the package, e.g. GitHub for a Bioconductor package fetched from there
+	Origin string
+}
+
+// RepoRegistry classifies package URLs by the first matching rule.
+type RepoRegistry struct {
+	rules []RepoRule
+}
+
+// defaultRepoRules are tried after any rules added to Repos.
+var defaultRepoRules = []RepoRule{
+	{RepoBioconductor, regexp.MustCompile(`^https?://([^/]+\.)?bioconductor\.org/packages/(?P<branch>[^/]+)/(?P<section>bioc|data/annotation|data/experiment|workflows)/`)},
+	{RepoBioconductor, regexp.MustCompile(`^https?://([^/]+\.)?bioconductor\.org/`)},
+	{RepoRUniverse, regexp.MustCompile(`^https?://(?P<branch>[^./]+)\.r-universe\.dev/`)},
+	{RepoGitHub, regexp.MustCompile(`^https?://github\.com/(?P<branch>[^/]+/[^/]+)/(archive|tarball)/`)},
+	{RepoGitHub, regexp.MustCompile(`^https?://codeload\.github\.com/(?P<branch>[^/]+/[^/]+)/`)},
+	{RepoCRAN, regexp.MustCompile(`^https?://([^/]+\.)?r-project\.org(/.*)?/src/contrib/(?P<section>Archive/)?`)},
+	{RepoCRAN, regexp.MustCompile(`^https?://([^/]+\.)?r-project\.org/`)},
+	// CRAN mirrors, e.g. https://cran.rstudio.com/src/contrib/
+	{RepoCRAN, regexp.MustCompile(`^https?://[^/]*cran[^/]*(/.*)?/src/contrib/(?P<section>Archive/)?`)},
+	{RepoLocal, regexp.MustCompile(`^(git:|file://|/|\.{1,2}/|[A-Za-z]:[\\/])`)},
+}
+
+// Repos is the registry used by the package_source feature.
+var Repos = new(RepoRegistry)
+
+// Add adds a rule that is tried before the rules added earlier and the defaults.
+func (r *RepoRegistry) Add(repo string, pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	r.rules = append([]RepoRule{{repo, re}}, r.rules...)
+	return nil
+}
+
+// Classify returns the repository of a package URL or path, RepoOther if no rule matches.
+func (r *RepoRegistry) Classify(url string) Source {
+	for _, rules := range [][]RepoRule{r.rules, defaultRepoRules} {
+		for _, rule := range rules {
+			match := rule.Pattern.FindStringSubmatch(url)
+			if match == nil {
+				continue
+			}
+			source := Source{Repo: rule.Repo}
+			if i := rule.Pattern.SubexpIndex("branch"); i > 0 {
+				source.Branch = match[i]
+			}
+			if i := rule.Pattern.SubexpIndex("section"); i > 0 {
+				source.Section = strings.TrimSuffix(match[i], "/")
+			}
+			return source
+		}
+	}
+	return Source{Repo: RepoOther}
+}
+
+var repoLine = regexp.MustCompile(`^(\S+)\s*=\s*(.+)$`)
+
+// LoadRepos adds rules from lines of the form "repo = pattern" to r. Blank lines
+// and lines starting with # are ignored. Later lines take precedence.
+func (r *RepoRegistry) LoadRepos(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		subMatch := repoLine.FindStringSubmatch(line)
+		if subMatch == nil {
+			return fmt.Errorf("line %d: expected repo = pattern", lineNo)
+		}
+		if err := r.Add(subMatch[1], subMatch[2]); err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadReposFile adds rules from a file, see LoadRepos.
+func (r *RepoRegistry) LoadReposFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return r.LoadRepos(f)
+}
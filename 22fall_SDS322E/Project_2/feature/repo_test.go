@@ -0,0 +1,48 @@
+package feature
+
+import (
+	"Project2/model"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoClassify(t *testing.T) {
+	repos := new(RepoRegistry)
+	for url, source := range map[string]Source{
+		"https://cran.r-project.org/src/contrib/dplyr_1.0.10.tar.gz":                              {Repo: RepoCRAN},
+		"https://cloud.r-project.org/src/contrib/Archive/dplyr/dplyr_1.0.0.tar.gz":                {Repo: RepoCRAN, Section: "Archive"},
+		"https://cran.rstudio.com/src/contrib/dplyr_1.0.10.tar.gz":                                {Repo: RepoCRAN},
+		"https://bioconductor.org/packages/3.16/bioc/src/contrib/limma_3.54.0.tar.gz":             {Repo: RepoBioconductor, Branch: "3.16", Section: "bioc"},
+		"https://bioconductor.org/packages/devel/data/annotation/src/contrib/org.Hs.eg.db.tar.gz": {Repo: RepoBioconductor, Branch: "devel", Section: "data/annotation"},
+		"https://ropensci.r-universe.dev/src/contrib/rtweet_1.0.tar.gz":                           {Repo: RepoRUniverse, Branch: "ropensci"},
+		"https://github.com/tidyverse/dplyr/archive/refs/heads/main.tar.gz":                       {Repo: RepoGitHub, Branch: "tidyverse/dplyr"},
+		"/data/Archive/dplyr/dplyr_1.0.0.tar.gz":                                                  {Repo: RepoLocal},
+		"https://example.org/foo_1.0.tar.gz":                                                      {Repo: RepoOther},
+	} {
+		assert.Equal(t, source, repos.Classify(url), url)
+	}
+
+	assert.NoError(t, repos.LoadRepos(strings.NewReader("# internal mirror\nCRAN = ^https://mirror\\.example\\.org/\n")))
+	assert.Equal(t, Source{Repo: RepoCRAN}, repos.Classify("https://mirror.example.org/foo_1.0.tar.gz"))
+	assert.Error(t, repos.LoadRepos(strings.NewReader("CRAN")))
+}
+
+func TestBiocViews(t *testing.T) {
+	p := model.NewP()
+	p.URL = "https://github.com/foo/bar/archive/main.tar.gz"
+	p.Description.BiocViews = []string{"Software", "RNASeq", "DifferentialExpression", "GeneExpressionWorkflow", "NotATerm"}
+	f := Extract(p, nil)
+	assert.Empty(t, f.Errors)
+	assert.Equal(t, model.BiocViewCounts{Software: 3, Workflow: 1, Unknown: 1}, f.BiocViews)
+	assert.Equal(t, BiocSoftware, f.BiocViewsType)
+	assert.Equal(t, RepoBioconductor, f.Repo)
+	assert.Equal(t, "foo/bar", f.RepoBranch)
+	assert.Empty(t, f.RepoSection)
+	assert.Equal(t, RepoGitHub, f.RepoOrigin)
+
+	// an empty biocViews field is not a Bioconductor package
+	p.Description.BiocViews = []string{""}
+	assert.Equal(t, Source{Repo: RepoGitHub, Branch: "foo/bar"}, PackageSource(p, new(RepoRegistry)))
+}
@@ -0,0 +1,78 @@
+package feature
+
+import (
+	"Project2/model"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// extractResult is the features of a package.
+type extractResult struct {
+	p *model.P
+	f *model.F
+}
+
+// ExtractStream extracts the features of every package in a stream read by
+// model.Decoder with the extractors of plan, all if nil, using nProcs workers.
+// emit is called from the calling goroutine in completion order.
+func ExtractStream(r io.Reader, nProcs int, plan []Extractor, emit func(p *model.P, f *model.F) error) error {
+	if nProcs < 1 {
+		return fmt.Errorf("invalid number of workers %d", nProcs)
+	}
+	inputChan := make(chan *model.P, nProcs)
+	outputChan := make(chan extractResult, nProcs)
+	stop := make(chan struct{})
+	var decodeErr error
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(inputChan)
+		dec := model.NewDecoder(r)
+		for {
+			p := new(model.P)
+			if err := dec.Decode(p); err != nil {
+				if err != io.EOF {
+					decodeErr = err
+				}
+				return
+			}
+			select {
+			case inputChan <- p:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for i := 0; i < nProcs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range inputChan {
+				select {
+				case outputChan <- extractResult{p, Extract(p, plan)}:
+				case <-stop:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(outputChan)
+	}()
+
+	var emitErr error
+	for res := range outputChan {
+		if emitErr != nil {
+			continue
+		}
+		if emitErr = emit(res.p, res.f); emitErr != nil {
+			close(stop)
+		}
+	}
+	if emitErr != nil {
+		return emitErr
+	}
+	return decodeErr
+}
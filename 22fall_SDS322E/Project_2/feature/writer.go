@@ -0,0 +1,145 @@
+package feature
+
+import (
+	"Project2/model"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Output formats of NewWriter.
+const (
+	FormatCSV     = "csv"
+	FormatTSV     = "tsv"
+	FormatParquet = "parquet"
+)
+
+// Writer writes rows such as model.F to a table. The columns are fixed by the
+// first row written.
+type Writer interface {
+	Write(row model.Row) error
+	// Close flushes buffered rows. It does not close the underlying io.Writer.
+	Close() error
+}
+
+// CheckFormat returns an error if format is not an output format of NewWriter.
+func CheckFormat(format string) error {
+	switch format {
+	case FormatCSV, FormatTSV, FormatParquet:
+		return nil
+	}
+	return fmt.Errorf("unknown feature table format %q", format)
+}
+
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	if err := CheckFormat(format); err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatCSV:
+		return &delimitedWriter{w: csv.NewWriter(w)}, nil
+	case FormatTSV:
+		cw := csv.NewWriter(w)
+		cw.Comma = '\t'
+		return &delimitedWriter{w: cw}, nil
+	default:
+		return &parquetWriter{out: w}, nil
+	}
+}
+
+// checkHeader returns the header of row, or an error if it differs from header.
+func checkHeader(header []string, row model.Row) ([]string, error) {
+	h := row.Header()
+	if header != nil && !reflect.DeepEqual(header, h) {
+		return nil, fmt.Errorf("row has different columns than the first row: %v", row.FieldValues())
+	}
+	return h, nil
+}
+
+type delimitedWriter struct {
+	w      *csv.Writer
+	header []string
+}
+
+func (w *delimitedWriter) Write(row model.Row) error {
+	header, err := checkHeader(w.header, row)
+	if err != nil {
+		return err
+	}
+	if w.header == nil {
+		w.header = header
+		if err := w.w.Write(header); err != nil {
+			return err
+		}
+	}
+	return w.w.Write(row.FieldValues())
+}
+
+func (w *delimitedWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type parquetWriter struct {
+	out    io.Writer
+	w      *writer.CSVWriter
+	header []string
+}
+
+// parquetSchema returns the schema of rows with the columns kvs. Columns are
+// optional, as NA values are written as nulls.
+func parquetSchema(kvs []model.KV) ([]string, error) {
+	md := make([]string, len(kvs))
+	for i, kv := range kvs {
+		switch kv.Value.(type) {
+		case int:
+			md[i] = fmt.Sprintf("name=%s, type=INT64, repetitiontype=OPTIONAL", kv.Key)
+		case float64:
+			md[i] = fmt.Sprintf("name=%s, type=DOUBLE, repetitiontype=OPTIONAL", kv.Key)
+		case string:
+			md[i] = fmt.Sprintf("name=%s, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL", kv.Key)
+		default:
+			return nil, fmt.Errorf("unsupported type %T of feature %s", kv.Value, kv.Key)
+		}
+	}
+	return md, nil
+}
+
+func (w *parquetWriter) Write(row model.Row) error {
+	header, err := checkHeader(w.header, row)
+	if err != nil {
+		return err
+	}
+	kvs := row.KVPairs()
+	if w.w == nil {
+		md, err := parquetSchema(kvs)
+		if err != nil {
+			return err
+		}
+		if w.w, err = writer.NewCSVWriterFromWriter(md, w.out, 1); err != nil {
+			return err
+		}
+		w.header = header
+	}
+	values := make([]interface{}, len(kvs))
+	for i, kv := range kvs {
+		if kv.NA {
+			continue
+		} else if v, ok := kv.Value.(int); ok {
+			values[i] = int64(v)
+		} else {
+			values[i] = kv.Value
+		}
+	}
+	return w.w.Write(values)
+}
+
+func (w *parquetWriter) Close() error {
+	if w.w == nil {
+		return nil
+	}
+	return w.w.WriteStop()
+}
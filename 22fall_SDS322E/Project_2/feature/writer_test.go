@@ -0,0 +1,54 @@
+package feature
+
+import (
+	"Project2/model"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestWriter(t *testing.T) {
+	rows := []*model.F{
+		{Package: "foo", TitleWords: 3, Queries: map[string]int{"lm": 1}},
+		{Package: "bar", AvgRTokens: 1.5, Queries: map[string]int{"lm": 0}},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatTSV)
+	assert.NoError(t, err)
+	for _, f := range rows {
+		assert.NoError(t, w.Write(f))
+	}
+	assert.NoError(t, w.Close())
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "package\tversion\trepo\trepo.branch\trepo.section\trepo.origin\ttitle.words\t"))
+	assert.True(t, strings.HasSuffix(lines[0], "\tquery..lm"))
+	assert.True(t, strings.HasPrefix(lines[1], "foo\t\t\t\t\t\t3\t"))
+
+	assert.Error(t, w.Write(&model.F{Package: "baz"}), "columns differ from the first row")
+
+	buf.Reset()
+	w, err = NewWriter(&buf, FormatParquet)
+	assert.NoError(t, err)
+	for _, f := range rows {
+		assert.NoError(t, w.Write(f))
+	}
+	assert.NoError(t, w.Close())
+	pr, err := reader.NewParquetReader(buffer.NewBufferFileFromBytes(buf.Bytes()), nil, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), pr.GetNumRows())
+	assert.Len(t, pr.Footer.Schema, len(rows[0].Header())+1)
+	pr.ReadStop()
+	// the reader renames columns to Go identifiers, the file keeps the csv tags
+	assert.True(t, bytes.Contains(buf.Bytes(), []byte("title.words")))
+
+	_, err = NewWriter(&buf, "xlsx")
+	assert.Error(t, err)
+	assert.Error(t, CheckFormat("xlsx"))
+	assert.NoError(t, CheckFormat(FormatParquet))
+}
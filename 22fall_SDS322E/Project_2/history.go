@@ -0,0 +1,230 @@
+package main
+
+import (
+	"Project2/analyzer"
+	"Project2/feature"
+	"Project2/model"
+	"Project2/rparse"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// history analyzes the releases of a package and writes a feature row per
+// version to <out>.versions.<format> and release-to-release changes to
+// <out>.deltas.<format>. Sources are tarball URLs or files, directories and
+// URLs of directories in the CRAN src/contrib/Archive/<package>/ layout, or git
+// repositories, of which every tag is analyzed unless a revision is given:
+//
+//	Project2 history -out foo -format parquet foo https://cran.r-project.org/src/contrib/Archive/foo/ foo_1.2.tar.gz
+//	Project2 history foo git:src/foo
+func history(args []string) error {
+	flags := newFlagSet("history")
+	out := flags.String("out", "", "Prefix of the output files (default the package name)")
+	format := flags.String("format", feature.FormatCSV, "Output format (csv, tsv or parquet)")
+	if err := parseArgs(flags, args, 2, -1); err != nil {
+		return err
+	}
+	matchers, err := planMatchers(*flagMatchers, *flagQueries)
+	if err != nil {
+		return fmt.Errorf("failed to plan matchers: %w", err)
+	}
+	extractors, err := planExtractors(*flagExtractors)
+	if err != nil {
+		return fmt.Errorf("failed to plan feature extractors: %w", err)
+	}
+	pkg := flags.Arg(0)
+	if *out == "" {
+		*out = pkg
+	}
+	var sources []string
+	for _, source := range flags.Args()[1:] {
+		expanded, err := expandReleaseSource(pkg, source, flagLimits())
+		if err != nil {
+			return fmt.Errorf("error listing releases in %s: %w", source, err)
+		}
+		sources = append(sources, expanded...)
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no releases of %s found", pkg)
+	}
+
+	log.Printf("Analyzing %d releases of %s", len(sources), pkg)
+	// the tables of the releases analyzed are written even if some failed
+	releases, analyzeErr := analyzeReleases(sources, *flagNumProcs, matchers, flagLimits())
+	if analyzeErr != nil && (!errors.As(analyzeErr, &partialError{}) || len(releases) == 0) {
+		return analyzeErr
+	}
+	feature.SortReleases(releases)
+
+	err = writeTable(*out+".versions."+*format, *format, func(w feature.Writer) error {
+		for _, p := range releases {
+			if err := w.Write(feature.Extract(p, extractors)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = writeTable(*out+".deltas."+*format, *format, func(w feature.Writer) error {
+		for _, d := range feature.Deltas(releases) {
+			if err := w.Write(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return analyzeErr
+}
+
+func writeTable(filename string, format string, write func(w feature.Writer) error) error {
+	if err := feature.CheckFormat(format); err != nil {
+		return usageError{err.Error()}
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating output: %w", err)
+	}
+	w, err := feature.NewWriter(f, format)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err = write(w); err == nil {
+		err = w.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", filename, err)
+	}
+	log.Printf("Wrote %s", filename)
+	return nil
+}
+
+// analyzeReleases parses the releases with nProcs parsers. Releases that cannot
+// be fetched are logged and left out, and reported in a partialError returned
+// with the others.
+func analyzeReleases(sources []string, nProcs int, matchers []rparse.MatcherSpec, limits *analyzer.Limits) ([]*model.P, error) {
+	parsers := make([]*analyzer.Parser, 0, nProcs)
+	defer func() {
+		for _, parser := range parsers {
+			parser.Close()
+		}
+	}()
+	for i := 0; i < nProcs; i++ {
+		parser, err := analyzer.NewParser(analyzer.Options{Matchers: matchers, Limits: limits})
+		if err != nil {
+			return nil, err
+		}
+		parsers = append(parsers, parser)
+	}
+	results := make([]*model.P, len(sources))
+	wg := new(sync.WaitGroup)
+	workerChan := make(chan int)
+	for _, parser := range parsers {
+		wg.Add(1)
+		go func(parser *analyzer.Parser) {
+			defer wg.Done()
+			for idx := range workerChan {
+				p, err := parser.Analyze(context.Background(), sources[idx])
+				if err != nil {
+					log.Printf("Failed to analyze %s: %s", sources[idx], err)
+					continue
+				}
+				results[idx] = p
+			}
+		}(parser)
+	}
+	for i := range sources {
+		workerChan <- i
+	}
+	close(workerChan)
+	wg.Wait()
+
+	var releases []*model.P
+	for _, p := range results {
+		if p != nil {
+			releases = append(releases, p)
+		}
+	}
+	if failed := len(sources) - len(releases); failed > 0 {
+		return releases, partialError{Failed: failed, Total: len(sources)}
+	}
+	return releases, nil
+}
+
+// expandReleaseSource returns the tarballs of pkg in a source, which is a
+// tarball, a directory containing the tarballs directly or in a <pkg>
+// subdirectory, or the URL of a directory listing. A git repository without a
+// revision expands to its tags. Directory listings are fetched within limits.
+func expandReleaseSource(pkg string, source string, limits *analyzer.Limits) ([]string, error) {
+	if strings.HasPrefix(source, analyzer.GitPrefix) {
+		if _, revision := analyzer.SplitGitSource(source); revision != "HEAD" || strings.HasSuffix(source, "@HEAD") {
+			return []string{source}, nil
+		}
+		return analyzer.GitTags(strings.TrimPrefix(source, analyzer.GitPrefix))
+	}
+	isURL := strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+	if strings.HasSuffix(source, ".tar.gz") {
+		return []string{source}, nil
+	}
+	if isURL {
+		return listArchiveURL(pkg, source, limits)
+	}
+	var files []string
+	for _, pattern := range []string{
+		filepath.Join(source, pkg+"_*.tar.gz"),
+		filepath.Join(source, pkg, pkg+"_*.tar.gz"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func listArchiveURL(pkg string, dirURL string, limits *analyzer.Limits) ([]string, error) {
+	base, err := neturl.Parse(dirURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	body, err := limits.Get(context.Background(), base.String())
+	if err != nil {
+		return nil, err
+	}
+	tarball := regexp.MustCompile(`href="(` + regexp.QuoteMeta(pkg) + `_[^"/]+\.tar\.gz)"`)
+	seen := make(map[string]bool)
+	var urls []string
+	for _, match := range tarball.FindAllStringSubmatch(string(body), -1) {
+		ref, err := neturl.Parse(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("bad link %s: %w", match[1], err)
+		}
+		if u := base.ResolveReference(ref).String(); !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
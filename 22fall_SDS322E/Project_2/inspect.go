@@ -0,0 +1,239 @@
+package main
+
+import (
+	"Project2/model"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// readPackages calls fn for each package of a JSON output stream.
+func readPackages(path string, fn func(p *model.P) error) error {
+	in, err := openInput(path)
+	if err != nil {
+		return fmt.Errorf("error opening input: %w", err)
+	}
+	defer in.Close()
+	dec := model.NewDecoder(in)
+	for n := 1; ; n++ {
+		var p model.P
+		if err := dec.Decode(&p); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not decode package %d: %w", n, err)
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+}
+
+// matchPackage reports whether p is one of the packages given as name or
+// name@version, or any package if there are none.
+func matchPackage(p *model.P, packages []string) bool {
+	if len(packages) == 0 {
+		return true
+	}
+	name, version := p.Name, p.Version
+	if name == "" {
+		name, version = p.Description.Package, p.Description.Version
+	}
+	for _, pkg := range packages {
+		if n, v, ok := strings.Cut(pkg, "@"); n == name && (!ok || v == version) {
+			return true
+		}
+	}
+	return false
+}
+
+// inspect summarizes the packages of an output, or prints them as JSON with -json:
+//
+//	Project2 inspect output.json ggplot2@3.4.0
+func inspect(args []string) error {
+	flags := newFlagSet("inspect")
+	asJSON := flags.Bool("json", false, "Print the packages as JSON")
+	if err := parseArgs(flags, args, 1, -1); err != nil {
+		return err
+	}
+	packages := flags.Args()[1:]
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	found := 0
+	err := readPackages(flags.Arg(0), func(p *model.P) error {
+		if !matchPackage(p, packages) {
+			return nil
+		}
+		found++
+		if *asJSON {
+			return enc.Encode(p)
+		}
+		return writeSummary(os.Stdout, p)
+	})
+	if err != nil {
+		return err
+	}
+	if found == 0 && len(packages) > 0 {
+		return fmt.Errorf("no package matching %s", strings.Join(packages, ", "))
+	}
+	return nil
+}
+
+// writeSummary writes a human-readable summary of p.
+func writeSummary(w io.Writer, p *model.P) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	name, version := p.Name, p.Version
+	if name == "" {
+		name, version = p.Description.Package, p.Description.Version
+	}
+	fmt.Fprintf(tw, "%s %s\n", name, version)
+	line := func(key string, value string) {
+		if value != "" {
+			fmt.Fprintf(tw, "  %s:\t%s\n", key, value)
+		}
+	}
+	line("Status", p.Status)
+	line("URL", p.URL)
+	line("Title", p.Description.Title)
+	line("License", p.Description.License)
+	line("Depends", strings.Join(p.Description.Depends, ", "))
+	line("Imports", strings.Join(p.Description.Imports, ", "))
+	if p.Commit != nil {
+		line("Commit", fmt.Sprintf("%s (%s)", p.Commit.Hash, p.Commit.Revision))
+	}
+	line("Fetch error", p.FetchError)
+	if len(p.FileExtensions) > 0 {
+		exts := make([]string, 0, len(p.FileExtensions))
+		for ext := range p.FileExtensions {
+			exts = append(exts, ext)
+		}
+		sort.Strings(exts)
+		for i, ext := range exts {
+			exts[i] = fmt.Sprintf("%s %d", ext, p.FileExtensions[ext])
+		}
+		line("Files", strings.Join(exts, ", "))
+	}
+	if len(p.RFiles) > 0 {
+		tokens := 0
+		for _, f := range p.RFiles {
+			tokens += f.NTokens
+		}
+		line("R files", fmt.Sprintf("%d, %d tokens", len(p.RFiles), tokens))
+	}
+	line("Exports", fmt.Sprintf("%d, %d S3 methods, %d classes",
+		len(p.Namespace.Exports), len(p.Namespace.S3Methods), len(p.Namespace.ExportClasses)))
+	if len(p.ParseError) > 0 {
+		stages := make(map[string]int)
+		for _, e := range p.ParseError {
+			stages[e.Stage]++
+		}
+		counts := make([]string, 0, len(stages))
+		for stage, n := range stages {
+			counts = append(counts, fmt.Sprintf("%s %d", stage, n))
+		}
+		sort.Strings(counts)
+		line("Parse errors", strings.Join(counts, ", "))
+	}
+	return tw.Flush()
+}
+
+// errorClass counts the errors of a stage and class.
+type errorClass struct {
+	Stage string
+	// Class is the Violation of limit errors, "error" for others
+	Class    string
+	Count    int
+	Packages int
+	// Messages counts the occurrences of each message
+	Messages map[string]int
+}
+
+// aggregateErrors groups the fetch and parse errors of packages by stage and
+// class, fetch errors with the stage "fetch", most common first.
+func aggregateErrors(path string) ([]*errorClass, error) {
+	classes := make(map[[2]string]*errorClass)
+	add := func(stage string, class string, message string, seen map[[2]string]bool) {
+		key := [2]string{stage, class}
+		c := classes[key]
+		if c == nil {
+			c = &errorClass{Stage: stage, Class: class, Messages: make(map[string]int)}
+			classes[key] = c
+		}
+		c.Count++
+		c.Messages[message]++
+		if !seen[key] {
+			seen[key] = true
+			c.Packages++
+		}
+	}
+	err := readPackages(path, func(p *model.P) error {
+		seen := make(map[[2]string]bool)
+		if p.FetchError != "" {
+			add("fetch", "error", p.FetchError, seen)
+		}
+		for _, e := range p.ParseError {
+			class := e.Violation
+			if class == "" {
+				class = "error"
+			}
+			add(e.Stage, class, e.Message, seen)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*errorClass, 0, len(classes))
+	for _, c := range classes {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		if result[i].Stage != result[j].Stage {
+			return result[i].Stage < result[j].Stage
+		}
+		return result[i].Class < result[j].Class
+	})
+	return result, nil
+}
+
+// errorsCommand prints the errors of an output by stage and class, with the
+// most common messages of each with -top:
+//
+//	Project2 errors -top 3 output.json
+func errorsCommand(args []string) error {
+	flags := newFlagSet("errors")
+	top := flags.Int("top", 0, "Number of most common messages to list per class")
+	if err := parseArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	classes, err := aggregateErrors(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tCLASS\tERRORS\tPACKAGES")
+	for _, c := range classes {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", c.Stage, c.Class, c.Count, c.Packages)
+		messages := make([]string, 0, len(c.Messages))
+		for message := range c.Messages {
+			messages = append(messages, message)
+		}
+		sort.Slice(messages, func(i, j int) bool {
+			if c.Messages[messages[i]] != c.Messages[messages[j]] {
+				return c.Messages[messages[i]] > c.Messages[messages[j]]
+			}
+			return messages[i] < messages[j]
+		})
+		for i := 0; i < *top && i < len(messages); i++ {
+			message, _, _ := strings.Cut(messages[i], "\n")
+			fmt.Fprintf(tw, "\t\t%d\t%s\n", c.Messages[messages[i]], message)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// extractJob is an extractPackages crawl running in the background, started
+// by startExtractJob.
+type extractJob struct {
+	urls     []string
+	metrics  *crawlMetrics
+	progress *progressBuffer
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu       sync.Mutex
+	canceled bool
+	written  []*string
+	failures []packageFailure
+	err      error
+}
+
+// jobStatus is the state of an extractJob, one of "running", "canceled",
+// "failed" and "done", and its counts of packages. ETA is nil unless the job
+// is running and has finished a package.
+type jobStatus struct {
+	State      string         `r:"state,factor"`
+	Total      int            `r:"total"`
+	Dispatched int            `r:"dispatched"`
+	Completed  int            `r:"completed"`
+	Skipped    int            `r:"skipped"`
+	Failed     int            `r:"failed"`
+	InFlight   int            `r:"in_flight"`
+	Elapsed    time.Duration  `r:"elapsed"`
+	ETA        *time.Duration `r:"eta"`
+	Error      string         `r:"error"`
+}
+
+// startExtractJob starts extractPackages in a goroutine. opts.Progress,
+// opts.Metrics and opts.Completed are set by the job.
+func startExtractJob(urls []string, output string, nProcs int, opts extractOptions) *extractJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &extractJob{
+		urls:     urls,
+		metrics:  newCrawlMetrics(len(urls), nProcs, nil),
+		progress: new(progressBuffer),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		written:  make([]*string, len(urls)),
+	}
+	opts.Progress = job.progress
+	opts.Metrics = job.metrics
+	opts.Completed = job.complete
+	go func() {
+		defer close(job.done)
+		defer cancel()
+		err := extractAborted(extractPackages(ctx, urls, output, nProcs, opts))
+		job.mu.Lock()
+		job.err = err
+		job.mu.Unlock()
+	}()
+	return job
+}
+
+func (job *extractJob) complete(i int, result string, reason string) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.written[i] = &result
+	if reason != "" {
+		url := job.urls[i]
+		job.failures = append(job.failures, packageFailure{url, packageNameFromURL(url), reason})
+	}
+}
+
+// status returns the current status of the job.
+func (job *extractJob) status() jobStatus {
+	crawl := job.metrics.status()
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	st := jobStatus{
+		State:      "running",
+		Total:      crawl.Total,
+		Dispatched: int(crawl.Dispatched),
+		Completed:  int(crawl.Completed),
+		Skipped:    int(crawl.Skipped),
+		Failed:     len(job.failures),
+		Elapsed:    time.Since(crawl.Started),
+	}
+	for _, w := range crawl.Workers {
+		if w.URL != "" {
+			st.InFlight++
+		}
+	}
+	select {
+	case <-job.done:
+		st.State = "done"
+		if job.err != nil {
+			st.State = "failed"
+			st.Error = job.err.Error()
+		} else if job.canceled {
+			st.State = "canceled"
+		}
+		return st
+	default:
+	}
+	if finished := st.Completed + st.Skipped; finished > 0 {
+		eta := st.Elapsed / time.Duration(finished) * time.Duration(st.Total-finished)
+		st.ETA = &eta
+	}
+	return st
+}
+
+// results returns the results of extractPackages so far, nil for packages
+// not written yet, and the packages that failed.
+func (job *extractJob) results() ([]*string, []packageFailure) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return append([]*string(nil), job.written...), append([]packageFailure(nil), job.failures...)
+}
+
+// stop cancels the job, abandoning the packages in flight.
+func (job *extractJob) stop() {
+	job.mu.Lock()
+	select {
+	case <-job.done:
+	default:
+		job.canceled = true
+	}
+	job.mu.Unlock()
+	job.cancel()
+}
+
+// wait waits for the job to exit.
+func (job *extractJob) wait() {
+	<-job.done
+}
+
+// progressBuffer collects the progress lines of a job until they are printed.
+type progressBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *progressBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// flush returns and clears the collected progress. Lines overwritten with a
+// carriage return are dropped, so polling rarely does not print every update.
+func (b *progressBuffer) flush() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := bytes.SplitAfter(b.buf.Bytes(), []byte("\n"))
+	var out bytes.Buffer
+	for _, line := range lines {
+		if i := bytes.LastIndexByte(bytes.TrimSuffix(line, []byte("\n")), '\r'); i > 0 {
+			line = line[i:]
+		}
+		out.Write(line)
+	}
+	b.buf.Reset()
+	return out.String()
+}
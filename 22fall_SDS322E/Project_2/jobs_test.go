@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractJobFailed(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "missing", "output.json")
+	job := startExtractJob([]string{"https://example.org/foo_1.0.tar.gz"}, output, 1, extractOptions{})
+	job.wait()
+	status := job.status()
+	assert.Equal(t, "failed", status.State)
+	assert.Contains(t, status.Error, "could not open output")
+	assert.Equal(t, 1, status.Total)
+	assert.Nil(t, status.ETA)
+
+	// canceling a finished job keeps its state
+	job.stop()
+	assert.Equal(t, "failed", job.status().State)
+	results, failures := job.results()
+	assert.Equal(t, []*string{nil}, results)
+	assert.Empty(t, failures)
+}
+
+func TestProgressBuffer(t *testing.T) {
+	b := new(progressBuffer)
+	fmt.Fprint(b, "Starting\n")
+	for i := 1; i <= 3; i++ {
+		fmt.Fprintf(b, "\rFetched %d/3", i)
+	}
+	assert.Equal(t, "Starting\n\rFetched 3/3", b.flush())
+	assert.Empty(t, b.flush())
+	fmt.Fprint(b, "\rFetched 3/3\nInterrupted\n")
+	assert.Equal(t, "\rFetched 3/3\nInterrupted\n", b.flush())
+}
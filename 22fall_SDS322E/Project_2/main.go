@@ -1,61 +1,235 @@
 package main
 
 import (
+	"Project2/analyzer"
+	"Project2/feature"
+	"Project2/rparse"
+	"Project2/rparse/matcher"
+	"Project2/rparse/query"
+	"context"
 	"encoding/csv"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
-var flagPackagesCsv = flag.String("packages", "package.csv", "CSV file with package URLs")
-var flagOutput = flag.String("output", "output.json", "Output type (vector or file)")
+var flagPackagesCsv = flag.String("packages", "package.csv", "CSV file with the Package, SourceURL and optionally Version of the packages to fetch")
+var flagConfig = flag.String("config", "", "File of flag = value lines setting flags not given on the command line")
+var flagOutput = flag.String("output", "output.json", "Output of fetch: a .db, .sqlite or .sqlite3 file for SQLite, otherwise a JSON file")
 var flagNumProcs = flag.Int("procs", 8, "Number of parallel processes")
+var flagQueries = flag.String("queries", "", "File with token pattern queries to match in R files")
+var flagMatchers = flag.String("matchers", "", "Comma-separated matchers to run on R files (default all)")
+var flagExtractors = flag.String("extractors", "", "Comma-separated feature extractors to run in the features and history commands (default all): "+strings.Join(feature.Default.Names(), ", "))
+var flagRetryFailed = flag.Bool("retry-failed", false, "Fetch packages in the failure ledger (<output>.failures) again")
+var flagMaxAttempts = flag.Int("max-attempts", 3, "Number of failed fetches after which -retry-failed gives up on a package")
+var flagRepos = flag.String("repos", "", "File with additional repository rules (repo = URL regexp) for the features and history commands")
+var flagUpdate = flag.Bool("update", false, "Fetch only package versions not in the output and mark archived and removed ones")
+var flagConnectTimeout = flag.Duration("connect-timeout", analyzer.DefaultLimits.ConnectTimeout, "Timeout for connecting to a server (0 for none)")
+var flagReadTimeout = flag.Duration("read-timeout", analyzer.DefaultLimits.ReadTimeout, "Timeout for response headers and each read of a download (0 for none)")
+var flagFetchTimeout = flag.Duration("fetch-timeout", analyzer.DefaultLimits.TotalTimeout, "Timeout for a whole download (0 for none)")
+var flagMaxCompressed = flag.Int64("max-compressed", analyzer.DefaultLimits.MaxCompressedBytes, "Maximum bytes of a package tarball (0 for no limit)")
+var flagMaxDecompressed = flag.Int64("max-decompressed", analyzer.DefaultLimits.MaxDecompressedBytes, "Maximum bytes of a decompressed package tarball (0 for no limit)")
+var flagMaxEntries = flag.Int("max-entries", analyzer.DefaultLimits.MaxEntries, "Maximum number of files in a package (0 for no limit)")
+var flagMaxEntrySize = flag.Int64("max-entry-size", analyzer.DefaultLimits.MaxEntryBytes, "Maximum bytes of a file in a package (0 for no limit)")
+var flagMetricsAddr = flag.String("metrics-addr", "", "Address to serve Prometheus /metrics and a /status page on while crawling, e.g. :9090")
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
+	os.Exit(run(flag.Args()))
+}
+
+// run runs the command in args, fetch if there is none, and returns the exit code.
+func run(args []string) int {
+	if *flagConfig != "" {
+		if err := loadConfig(flag.CommandLine, *flagConfig); err != nil {
+			log.Printf("Failed to load config: %s", err)
+			return exitUsage
+		}
+	}
+	if *flagRepos != "" {
+		if err := feature.Repos.LoadReposFile(*flagRepos); err != nil {
+			log.Printf("Failed to load repository rules: %s", err)
+			return exitUsage
+		}
+	}
+	cmd := findCommand("fetch")
+	if len(args) > 0 {
+		if cmd = findCommand(args[0]); cmd == nil {
+			log.Printf("Unknown command %q", args[0])
+			flag.Usage()
+			return exitUsage
+		}
+		args = args[1:]
+	}
+	err := cmd.run(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Printf("%s: %s", cmd.name, err)
+	}
+	return exitCode(err)
+}
 
+// fetch fetches and parses the packages listed in the -packages CSV file,
+// which has Package and SourceURL and optionally Version columns.
+func fetch(args []string) error {
+	flags := newFlagSet("fetch")
+	if err := parseArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
 	csvFileIO, err := os.Open(*flagPackagesCsv)
 	if err != nil {
-		log.Fatalf("Error opening CSV file: %s", err)
+		return fmt.Errorf("error opening CSV file: %w", err)
 	}
 	defer csvFileIO.Close()
 	packageCsv := csv.NewReader(csvFileIO)
 	csvHeader, err := packageCsv.Read()
 	if err != nil {
-		log.Fatalf("Failed to read CSV header: %s", err)
+		return fmt.Errorf("failed to read CSV header: %w", err)
 	}
 	packageIdx := -1
 	urlColIdx := -1
+	versionIdx := -1
 	for i, col := range csvHeader {
 		if col == "SourceURL" {
 			urlColIdx = i
 		} else if col == "Package" {
 			packageIdx = i
+		} else if col == "Version" {
+			versionIdx = i
 		}
 	}
 	if urlColIdx == -1 {
-		log.Fatal("CSV file does not have a SourceURL column")
+		return errors.New("CSV file does not have a SourceURL column")
 	}
 	if packageIdx == -1 {
-		log.Fatal("CSV file does not have a Package column")
+		return errors.New("CSV file does not have a Package column")
 	}
 	names := make([]string, 0, 2<<8)
 	urls := make([]string, 0, 2<<8)
+	versions := make([]string, 0, 2<<8)
 	for {
 		row, err := packageCsv.Read()
 		if err != nil && err != io.EOF {
-			log.Fatalf("Failed to read CSV row: %s", err)
+			return fmt.Errorf("failed to read CSV row: %w", err)
 		} else if err == io.EOF {
 			break
 		}
 		names = append(names, row[packageIdx])
 		urls = append(urls, row[urlColIdx])
+		if versionIdx != -1 {
+			versions = append(versions, row[versionIdx])
+		} else {
+			versions = append(versions, packageVersionFromURL(row[urlColIdx]))
+		}
+	}
+	matchers, err := planMatchers(*flagMatchers, *flagQueries)
+	if err != nil {
+		return fmt.Errorf("failed to plan matchers: %w", err)
 	}
 	log.Printf("Extracting info from %d packages with %d parallel processes", len(names), *flagNumProcs)
-	for i, err := range extractPackages(urls, *flagOutput, *flagNumProcs) {
-		if err != "" {
-			log.Printf("Failed to extract package %s: %s", names[i], err)
+	opts := extractOptions{
+		Names:       names,
+		Versions:    versions,
+		Matchers:    matchers,
+		RetryFailed: *flagRetryFailed,
+		MaxAttempts: *flagMaxAttempts,
+		Update:      *flagUpdate,
+		Limits:      flagLimits(),
+		MetricsAddr: *flagMetricsAddr,
+	}
+	drain, ctx := handleSignals()
+	opts.Drain = drain
+	// fetch failures are only in the reasons, the results of an output file
+	// are its write errors
+	reasons := make([]string, len(urls))
+	opts.Completed = func(i int, result string, reason string) { reasons[i] = reason }
+	ret := extractPackages(ctx, urls, *flagOutput, *flagNumProcs, opts)
+	if err := extractAborted(ret); err != nil {
+		return err
+	}
+	failed := 0
+	for i, reason := range reasons {
+		if reason != "" {
+			log.Printf("Failed to extract package %s: %s", names[i], reason)
+			failed++
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if failed > 0 {
+		return partialError{Failed: failed, Total: len(urls)}
+	}
+	return nil
+}
+
+// handleSignals returns a channel closed on the first SIGINT or SIGTERM and a
+// context canceled on the second. Later signals get the default behavior.
+func handleSignals() (drain <-chan struct{}, ctx context.Context) {
+	drainChan := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Print("Interrupted: finishing packages in flight, interrupt again to abort")
+		close(drainChan)
+		<-signals
+		log.Print("Interrupted again: aborting")
+		signal.Stop(signals)
+		cancel()
+	}()
+	return drainChan, ctx
+}
+
+// flagLimits returns the limits set by the flags.
+func flagLimits() *analyzer.Limits {
+	return &analyzer.Limits{
+		ConnectTimeout:       *flagConnectTimeout,
+		ReadTimeout:          *flagReadTimeout,
+		TotalTimeout:         *flagFetchTimeout,
+		MaxCompressedBytes:   *flagMaxCompressed,
+		MaxDecompressedBytes: *flagMaxDecompressed,
+		MaxEntries:           *flagMaxEntries,
+		MaxEntryBytes:        *flagMaxEntrySize,
+	}
+}
+
+// planExtractors plans the comma-separated feature extractors and their
+// dependencies, or all of them if names is empty.
+func planExtractors(names string) ([]feature.Extractor, error) {
+	if names == "" {
+		return feature.Default.Plan()
+	}
+	return feature.Default.Plan(strings.Split(names, ",")...)
+}
+
+// planMatchers plans the comma-separated built-in matchers, or all of them if
+// names is empty, followed by the queries in queryFile if given.
+func planMatchers(names string, queryFile string) ([]rparse.MatcherSpec, error) {
+	registry := matcher.Default.Clone()
+	var selected []string
+	if names != "" {
+		selected = strings.Split(names, ",")
+	} else {
+		selected = registry.Names()
+	}
+	if queryFile != "" {
+		queries, err := query.LoadFile(queryFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range queries {
+			if err := registry.Register(rparse.NewMatcherSpec(q.MatcherName(), nil, q.Update)); err != nil {
+				return nil, err
+			}
+			selected = append(selected, q.MatcherName())
 		}
 	}
+	return registry.Plan(selected...)
 }
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"Project2/model"
+	"Project2/rparse"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the latency histograms.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(latencyBuckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	s := d.Seconds()
+	for i, le := range latencyBuckets {
+		if s <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += s
+}
+
+func (h *histogram) write(w io.Writer, name string) {
+	for i, le := range latencyBuckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, le, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// failureKey labels failed packages by the stage that failed and the error
+// class: a store.Failure* class for stage "fetch", otherwise the violation of
+// a model.StageLimit parse error or "error".
+type failureKey struct {
+	Stage string
+	Class string
+}
+
+// inFlight is a package being fetched and parsed by a worker.
+type inFlight struct {
+	Worker int        `json:"worker"`
+	URL    string     `json:"url,omitempty"`
+	Name   string     `json:"name,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// crawlMetrics are the metrics of an extractPackages crawl. They observe the
+// downloads of the crawl's parsers as an analyzer.Observer.
+type crawlMetrics struct {
+	mu         sync.Mutex
+	started    time.Time
+	total      int
+	dispatched uint64
+	completed  uint64
+	skipped    uint64
+	failed     map[failureKey]uint64
+	fetch      *histogram
+	parse      *histogram
+	pkg        *histogram
+	workers    []inFlight
+	// bytes is updated atomically by the parsers
+	bytes uint64
+	// agents returns the statistics of the R parser agent of each worker
+	agents func() []rparse.AgentStats
+}
+
+func newCrawlMetrics(total int, nWorkers int, agents func() []rparse.AgentStats) *crawlMetrics {
+	m := &crawlMetrics{
+		started: time.Now(),
+		total:   total,
+		failed:  make(map[failureKey]uint64),
+		fetch:   newHistogram(),
+		parse:   newHistogram(),
+		pkg:     newHistogram(),
+		workers: make([]inFlight, nWorkers),
+		agents:  agents,
+	}
+	for i := range m.workers {
+		m.workers[i].Worker = i
+	}
+	return m
+}
+
+// setAgents sets the function returning the statistics of the R parser agents.
+func (m *crawlMetrics) setAgents(agents func() []rparse.AgentStats) {
+	m.mu.Lock()
+	m.agents = agents
+	m.mu.Unlock()
+}
+
+func (m *crawlMetrics) dispatch() {
+	m.mu.Lock()
+	m.dispatched++
+	m.mu.Unlock()
+}
+
+func (m *crawlMetrics) skip() {
+	m.mu.Lock()
+	m.skipped++
+	m.mu.Unlock()
+}
+
+// start marks a package as in flight on a worker.
+func (m *crawlMetrics) start(worker int, url string, name string) {
+	m.mu.Lock()
+	now := time.Now()
+	m.workers[worker] = inFlight{Worker: worker, URL: url, Name: name, Since: &now}
+	m.mu.Unlock()
+}
+
+// finish records the result of the package in flight on a worker, with the
+// error of ParseProject.
+func (m *crawlMetrics) finish(worker int, res *model.P, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pkg.observe(time.Since(*m.workers[worker].Since))
+	m.workers[worker] = inFlight{Worker: worker}
+	m.completed++
+	if err != nil {
+		m.failed[failureKey{"fetch", classifyFetchError(err)}]++
+		return
+	}
+	seen := make(map[failureKey]bool)
+	for _, e := range res.ParseError {
+		key := failureKey{e.Stage, "error"}
+		if e.Violation != "" {
+			key.Class = e.Violation
+		}
+		if !seen[key] {
+			seen[key] = true
+			m.failed[key]++
+		}
+	}
+}
+
+// abandon marks the package in flight on a worker as abandoned after the crawl
+// was aborted.
+func (m *crawlMetrics) abandon(worker int) {
+	m.mu.Lock()
+	m.workers[worker] = inFlight{Worker: worker}
+	m.mu.Unlock()
+}
+
+// Fetched records the time to receive the response headers of a download.
+func (m *crawlMetrics) Fetched(d time.Duration) {
+	m.mu.Lock()
+	m.fetch.observe(d)
+	m.mu.Unlock()
+}
+
+// Parsed records the time to parse the R files of a package.
+func (m *crawlMetrics) Parsed(d time.Duration) {
+	m.mu.Lock()
+	m.parse.observe(d)
+	m.mu.Unlock()
+}
+
+// Downloaded counts downloaded bytes.
+func (m *crawlMetrics) Downloaded(n int) {
+	atomic.AddUint64(&m.bytes, uint64(n))
+}
+
+// writeMetrics writes the metrics in the Prometheus text format.
+func (m *crawlMetrics) writeMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counter := func(name string, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	}
+	counter("crawl_packages_dispatched_total", "Packages handed to a worker.")
+	fmt.Fprintf(w, "crawl_packages_dispatched_total %d\n", m.dispatched)
+	counter("crawl_packages_completed_total", "Packages fetched and parsed or failed.")
+	fmt.Fprintf(w, "crawl_packages_completed_total %d\n", m.completed)
+	counter("crawl_packages_skipped_total", "Packages skipped because they are in the output or the failure ledger.")
+	fmt.Fprintf(w, "crawl_packages_skipped_total %d\n", m.skipped)
+	counter("crawl_packages_failed_total", "Packages that failed, by stage and error class.")
+	keys := make([]failureKey, 0, len(m.failed))
+	for key := range m.failed {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Stage != keys[j].Stage {
+			return keys[i].Stage < keys[j].Stage
+		}
+		return keys[i].Class < keys[j].Class
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "crawl_packages_failed_total{stage=%q,class=%q} %d\n", key.Stage, key.Class, m.failed[key])
+	}
+	counter("crawl_downloaded_bytes_total", "Bytes of package tarballs downloaded.")
+	fmt.Fprintf(w, "crawl_downloaded_bytes_total %d\n", atomic.LoadUint64(&m.bytes))
+	fmt.Fprintf(w, "# HELP crawl_packages Packages to crawl.\n# TYPE crawl_packages gauge\ncrawl_packages %d\n", m.total)
+
+	fmt.Fprintf(w, "# HELP crawl_fetch_seconds Time to receive the response headers of a download.\n# TYPE crawl_fetch_seconds histogram\n")
+	m.fetch.write(w, "crawl_fetch_seconds")
+	fmt.Fprintf(w, "# HELP crawl_package_seconds Time to fetch and parse a package.\n# TYPE crawl_package_seconds histogram\n")
+	m.pkg.write(w, "crawl_package_seconds")
+	fmt.Fprintf(w, "# HELP crawl_parse_seconds Time to parse the R files of a package and run the matchers.\n# TYPE crawl_parse_seconds histogram\n")
+	m.parse.write(w, "crawl_parse_seconds")
+
+	if m.agents == nil {
+		return
+	}
+	stats := m.agents()
+	for _, c := range []struct {
+		name  string
+		help  string
+		value func(rparse.AgentStats) uint64
+	}{
+		{"crawl_agent_starts_total", "R parser agent starts.", func(s rparse.AgentStats) uint64 { return s.Start }},
+		{"crawl_agent_kills_total", "R parser agents killed.", func(s rparse.AgentStats) uint64 { return s.Kill }},
+		{"crawl_agent_errors_total", "R parser agent commands that failed.", func(s rparse.AgentStats) uint64 { return s.Err }},
+		{"crawl_agent_ok_total", "R parser agent commands that succeeded.", func(s rparse.AgentStats) uint64 { return s.OK }},
+	} {
+		counter(c.name, c.help)
+		for i, s := range stats {
+			fmt.Fprintf(w, "%s{agent=\"%d\"} %d\n", c.name, i, c.value(s))
+		}
+	}
+}
+
+// crawlStatus is the /status page.
+type crawlStatus struct {
+	Started    time.Time  `json:"started"`
+	Total      int        `json:"total"`
+	Dispatched uint64     `json:"dispatched"`
+	Completed  uint64     `json:"completed"`
+	Skipped    uint64     `json:"skipped"`
+	Workers    []inFlight `json:"workers"`
+}
+
+func (m *crawlMetrics) status() crawlStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return crawlStatus{
+		Started:    m.started,
+		Total:      m.total,
+		Dispatched: m.dispatched,
+		Completed:  m.completed,
+		Skipped:    m.skipped,
+		Workers:    append([]inFlight(nil), m.workers...),
+	}
+}
+
+// serve serves /metrics and /status on addr until the returned function is
+// called.
+func (m *crawlMetrics) serve(addr string) (stop func(), err error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.writeMetrics(w)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(m.status())
+	})
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("metrics server: %s", err)
+		}
+	}()
+	log.Printf("Serving metrics on http://%s/metrics", strings.Replace(listener.Addr().String(), "[::]", "localhost", 1))
+	return func() { server.Close() }, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"Project2/analyzer"
+	"Project2/model"
+	"Project2/rparse"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlMetrics(t *testing.T) {
+	m := newCrawlMetrics(3, 2, func() []rparse.AgentStats {
+		return []rparse.AgentStats{{Start: 1, OK: 5}, {Start: 2, Kill: 1, Err: 1}}
+	})
+	for i := 0; i < 3; i++ {
+		m.dispatch()
+	}
+	m.skip()
+	m.start(0, "https://example.org/foo_1.0.tar.gz", "foo")
+	m.start(1, "https://example.org/bar_1.0.tar.gz", "bar")
+	status := m.status()
+	assert.Equal(t, "foo", status.Workers[0].Name)
+	assert.Equal(t, "bar", status.Workers[1].Name)
+
+	m.Downloaded(4)
+	m.Downloaded(6)
+	m.Parsed(300 * time.Millisecond)
+	m.finish(0, &model.P{ParseError: []model.ParseError{
+		{Stage: model.StageLimit, Violation: model.ViolationLink},
+		{Stage: model.StageLimit, Violation: model.ViolationLink},
+		{Stage: "SOURCE_R", Message: "oops"},
+	}}, nil)
+	m.finish(1, nil, analyzer.StatusError{Code: 404})
+	status = m.status()
+	assert.Empty(t, status.Workers[0].URL)
+	assert.EqualValues(t, 2, status.Completed)
+
+	var out strings.Builder
+	m.writeMetrics(&out)
+	for _, line := range []string{
+		"crawl_packages_dispatched_total 3",
+		"crawl_packages_completed_total 2",
+		"crawl_packages_skipped_total 1",
+		`crawl_packages_failed_total{stage="LIMIT",class="link"} 1`,
+		`crawl_packages_failed_total{stage="SOURCE_R",class="error"} 1`,
+		`crawl_packages_failed_total{stage="fetch",class="http"} 1`,
+		"crawl_downloaded_bytes_total 10",
+		`crawl_package_seconds_bucket{le="+Inf"} 2`,
+		"crawl_fetch_seconds_count 0",
+		`crawl_parse_seconds_bucket{le="0.25"} 0`,
+		`crawl_parse_seconds_bucket{le="0.5"} 1`,
+		"crawl_parse_seconds_count 1",
+		`crawl_agent_starts_total{agent="1"} 2`,
+		`crawl_agent_kills_total{agent="1"} 1`,
+		`crawl_agent_ok_total{agent="0"} 5`,
+	} {
+		assert.Contains(t, out.String(), line+"\n")
+	}
+}
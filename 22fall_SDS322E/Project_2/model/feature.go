@@ -4,6 +4,7 @@ import (
 	"log"
 	"math"
 	"reflect"
+	"sort"
 	"strconv"
 )
 
@@ -34,9 +35,41 @@ func (n NamingConvention) Props() NamingConventionProp {
 	}
 }
 
+type ObjectSystemCounts struct {
+	S3Generics          int `csv:"s3.generics"`
+	S3Methods           int `csv:"s3.methods"`
+	S3MethodsRegistered int `csv:"s3.methods_registered"`
+	S3MethodsUndefined  int `csv:"s3.methods_undefined"`
+	S4Classes           int `csv:"s4.classes"`
+	S4Generics          int `csv:"s4.generics"`
+	S4Methods           int `csv:"s4.methods"`
+	RCClasses           int `csv:"rc.classes"`
+	R6Classes           int `csv:"r6.classes"`
+	ClassesExported     int `csv:"classes_exported"`
+	ClassesUndefined    int `csv:"classes_undefined"`
+	GenericsExported    int `csv:"generics_exported"`
+	GenericsUndefined   int `csv:"generics_undefined"`
+	Fields              int `csv:"fields"`
+	ClassMethods        int `csv:"class_methods"`
+	ClassesWithValidity int `csv:"classes_with_validity"`
+}
+
+// BiocViewCounts are the number of biocViews terms under each top-level term.
+type BiocViewCounts struct {
+	Software       int `csv:"software"`
+	AnnotationData int `csv:"annotation_data"`
+	ExperimentData int `csv:"experiment_data"`
+	Workflow       int `csv:"workflow"`
+	Unknown        int `csv:"unknown"`
+}
+
 type F struct {
 	Package          string               `csv:"package"`
+	Version          string               `csv:"version"`
 	Repo             string               `csv:"repo"`
+	RepoBranch       string               `csv:"repo.branch"`
+	RepoSection      string               `csv:"repo.section"`
+	RepoOrigin       string               `csv:"repo.origin"`
 	TitleWords       int                  `csv:"title.words"`
 	DescriptionWords int                  `csv:"description.words"`
 	PropEqAssign     float64              `csv:"eq_assign.prop"`
@@ -59,6 +92,25 @@ type F struct {
 	ExtRd            float64              `csv:"ext.rd"`
 	ExtRds           float64              `csv:"ext.rds"`
 	ExtRda           float64              `csv:"ext.rda"`
+	ObjectSystem     string               `csv:"oop.system"`
+	ObjectSystems    ObjectSystemCounts   `csv:"oop"`
+	BiocViews        BiocViewCounts       `csv:"biocviews"`
+	BiocViewsType    string               `csv:"biocviews.type"`
+	// Errors are why feature extractors failed, "name: error" separated by "; "
+	Errors string `csv:"errors"`
+	// Queries are the match counts of token pattern queries, one column per query
+	Queries map[string]int `csv:"query"`
+	// Missing are the csv tags of the fields that were not extracted. Their
+	// columns are NA.
+	Missing map[string]bool `csv:"-"`
+}
+
+func sortedKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
 }
 
 func (f F) FloatCheck() {
@@ -88,18 +140,45 @@ func (f F) FloatCheck() {
 	}
 }
 
+// Row is a record that can be written as a table row. Columns are named by the
+// csv tags of its fields; struct fields and map entries are flattened into
+// "field..subfield" columns. Fields tagged `csv:"-"` are skipped.
+type Row interface {
+	Header() []string
+	KVPairs() []KV
+	FieldValues() []string
+}
+
 func (f F) Header() []string {
-	t := reflect.TypeOf(f)
+	return rowHeader(reflect.ValueOf(f))
+}
+
+func (f F) KVPairs() []KV {
+	return rowKVPairs(reflect.ValueOf(f), f.Missing)
+}
+
+func (f F) FieldValues() []string {
+	return rowFieldValues(reflect.ValueOf(f), f.Missing)
+}
+
+func rowHeader(v reflect.Value) []string {
+	t := v.Type()
 	var h []string
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 		tag := field.Tag.Get("csv")
-		if field.Type.Kind() == reflect.Struct {
+		if tag == "-" {
+			continue
+		} else if field.Type.Kind() == reflect.Struct {
 			for j := 0; j < field.Type.NumField(); j++ {
 				subField := field.Type.Field(j)
 				subTag := subField.Tag.Get("csv")
 				h = append(h, tag+".."+subTag)
 			}
+		} else if field.Type.Kind() == reflect.Map {
+			for _, key := range sortedKeys(v.Field(i)) {
+				h = append(h, tag+".."+key.String())
+			}
 		} else {
 			h = append(h, tag)
 		}
@@ -107,45 +186,60 @@ func (f F) Header() []string {
 	return h
 }
 
+// KV is a column of a row. Value is the zero value of the column's type if
+// NA is set.
 type KV struct {
 	Key   string
 	Value any
+	NA    bool
 }
 
-func (f F) KVPairs() []KV {
-	v := reflect.ValueOf(f)
+// rowKVPairs returns the columns of a row; those of fields whose csv tag is in
+// missing are NA.
+func rowKVPairs(v reflect.Value, missing map[string]bool) []KV {
 	var kvs []KV
-	addField := func(field reflect.Value, key string) {
+	addField := func(field reflect.Value, key string, na bool) {
 		switch field.Kind() {
 		case reflect.Int:
-			kvs = append(kvs, KV{key, int(field.Int())})
+			kvs = append(kvs, KV{key, int(field.Int()), na})
 		case reflect.Float64:
-			kvs = append(kvs, KV{key, field.Float()})
+			kvs = append(kvs, KV{key, field.Float(), na})
 		case reflect.String:
-			kvs = append(kvs, KV{key, field.String()})
+			kvs = append(kvs, KV{key, field.String(), na})
 		}
 	}
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
 		fieldTag := v.Type().Field(i).Tag.Get("csv")
-		if field.Kind() == reflect.Struct {
+		na := missing[fieldTag]
+		if fieldTag == "-" {
+			continue
+		} else if field.Kind() == reflect.Struct {
 			for j := 0; j < field.NumField(); j++ {
 				subField := field.Field(j)
 				subFieldTag := field.Type().Field(j).Tag.Get("csv")
-				addField(subField, fieldTag+".."+subFieldTag)
+				addField(subField, fieldTag+".."+subFieldTag, na)
+			}
+		} else if field.Kind() == reflect.Map {
+			for _, key := range sortedKeys(field) {
+				addField(field.MapIndex(key), fieldTag+".."+key.String(), na)
 			}
 		} else {
-			tag := v.Type().Field(i).Tag.Get("csv")
-			addField(field, tag)
+			addField(field, fieldTag, na)
 		}
 	}
 	return kvs
 }
 
-func (f F) FieldValues() []string {
-	v := reflect.ValueOf(f)
+// rowFieldValues returns the values of a row as text, with NA for the fields
+// whose csv tag is in missing.
+func rowFieldValues(v reflect.Value, missing map[string]bool) []string {
 	var vals []string
-	addField := func(field reflect.Value) {
+	addField := func(field reflect.Value, na bool) {
+		if na {
+			vals = append(vals, "NA")
+			return
+		}
 		switch field.Kind() {
 		case reflect.Int:
 			vals = append(vals, strconv.Itoa(int(field.Int())))
@@ -157,13 +251,21 @@ func (f F) FieldValues() []string {
 	}
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
-		if field.Kind() == reflect.Struct {
+		tag := v.Type().Field(i).Tag.Get("csv")
+		na := missing[tag]
+		if tag == "-" {
+			continue
+		} else if field.Kind() == reflect.Struct {
 			for j := 0; j < field.NumField(); j++ {
 				subField := field.Field(j)
-				addField(subField)
+				addField(subField, na)
+			}
+		} else if field.Kind() == reflect.Map {
+			for _, key := range sortedKeys(field) {
+				addField(field.MapIndex(key), na)
 			}
 		} else {
-			addField(field)
+			addField(field, na)
 		}
 	}
 	return vals
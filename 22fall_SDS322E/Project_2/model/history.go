@@ -0,0 +1,71 @@
+package model
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Delta is the change between two consecutive releases of a package. The
+// *Names columns list the added or removed names separated by spaces.
+type Delta struct {
+	Package             string `csv:"package"`
+	From                string `csv:"from"`
+	To                  string `csv:"to"`
+	ExportsAdded        int    `csv:"exports.added"`
+	ExportsRemoved      int    `csv:"exports.removed"`
+	ExportsAddedNames   string `csv:"exports.added.names"`
+	ExportsRemovedNames string `csv:"exports.removed.names"`
+	// Dependencies are the packages in Depends and Imports, without R itself
+	DepsAdded        int    `csv:"deps.added"`
+	DepsRemoved      int    `csv:"deps.removed"`
+	DepsAddedNames   string `csv:"deps.added.names"`
+	DepsRemovedNames string `csv:"deps.removed.names"`
+	RFilesDelta      int    `csv:"rfiles.delta"`
+	TokensDelta      int    `csv:"tokens.delta"`
+	FunctionsDelta   int    `csv:"functions.delta"`
+}
+
+func (d Delta) Header() []string {
+	return rowHeader(reflect.ValueOf(d))
+}
+
+func (d Delta) KVPairs() []KV {
+	return rowKVPairs(reflect.ValueOf(d), nil)
+}
+
+func (d Delta) FieldValues() []string {
+	return rowFieldValues(reflect.ValueOf(d), nil)
+}
+
+// CompareVersions compares R package versions such as 1.2-3 component by
+// component, returning -1, 0 or 1. Non-numeric components compare as strings.
+func CompareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' })
+	}
+	as, bs := split(a), split(b)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		if i >= len(as) {
+			return -1
+		}
+		if i >= len(bs) {
+			return 1
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -1,7 +1,31 @@
 package model
 
+import "time"
+
+// Crawl statuses of a package version.
+const (
+	// StatusCurrent versions are listed in the latest package index
+	StatusCurrent = "current"
+	// StatusArchived versions have been replaced by another version of the package
+	StatusArchived = "archived"
+	// StatusRemoved packages are no longer in the package index
+	StatusRemoved = "removed"
+)
+
 type P struct {
-	URL         string
+	// Schema is the SchemaVersion the package was written with
+	Schema int
+	URL    string
+	// Name and Version are the package name and version from the input list,
+	// which are known even if fetching fails
+	Name    string
+	Version string `json:",omitempty"`
+	// FirstSeen and LastSeen are the first and last crawls whose package index listed this version
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Status    string `json:",omitempty"`
+	// Commit is the revision of a package read from a git repository
+	Commit      *Commit `json:",omitempty"`
 	Description struct {
 		Package     string
 		Title       string
@@ -17,25 +41,65 @@ type P struct {
 		Calls   []NamespaceCall `json:"-"`
 		Exports []string
 		Imports []string
+		// ExportClasses and ExportMethods are the arguments of exportClasses() and exportMethods()
+		ExportClasses []string
+		ExportMethods []string
+		// S3Methods are the methods registered with S3method(), as generic.class
+		S3Methods []string
 	}
 	// Number of files per extension
 	FileExtensions map[string]uint
 	// number of R function calls
 	// a function call is tokenized as:
 	// [ SYMBOL_PACKAGE (package.name) NS_GET (::) ] SYMBOL_FUNCTION_CALL '(' ... ')'
-	RFiles     []RFile
+	RFiles []RFile
+	// Queries are the names of the token pattern queries matched against the R files
+	Queries    []string `json:",omitempty"`
 	Files      []string `json:"-"`
 	FetchError string
 	ParseError []ParseError
 }
 
+type Commit struct {
+	Hash string
+	Date time.Time
+	// Revision is the ref, tag or commit the package was read at
+	Revision string
+}
+
 type ParseError struct {
 	Stage   string
 	File    string
 	Message string
 	Stack   string
+	// Violation is the safety limit a package broke, with Stage StageLimit
+	Violation string `json:",omitempty"`
 }
 
+// StageLimit is the ParseError stage of safety limit violations. Reading a
+// package stops at a timeout, size or entry count violation; entries with a
+// path or type violation are skipped.
+const StageLimit = "LIMIT"
+
+// Safety limit violations.
+const (
+	ViolationTimeout          = "timeout"
+	ViolationCompressedSize   = "compressed_size"
+	ViolationDecompressedSize = "decompressed_size"
+	ViolationEntryCount       = "entry_count"
+	ViolationEntrySize        = "entry_size"
+	// ViolationAbsolutePath and ViolationPathTraversal entries would be
+	// extracted outside of the package directory
+	ViolationAbsolutePath  = "absolute_path"
+	ViolationPathTraversal = "path_traversal"
+	// ViolationNoPackageDir entries are not in a package directory
+	ViolationNoPackageDir = "no_package_dir"
+	// ViolationLink entries are symbolic or hard links
+	ViolationLink = "link"
+	// ViolationSpecialFile entries are devices, FIFOs or other special files
+	ViolationSpecialFile = "special_file"
+)
+
 type NamespaceCall struct {
 	Name string
 	Args []string
@@ -45,11 +109,31 @@ type NamespaceCall struct {
 type RFile struct {
 	Name    string
 	NTokens int
-	Stats   map[string]interface{}
+	Stats   FileStats
 }
 
 func NewP() *P {
 	return &P{
+		Schema:         SchemaVersion,
 		FileExtensions: make(map[string]uint),
 	}
 }
+
+// PackageVersion identifies a version of a package.
+type PackageVersion struct {
+	Name    string
+	Version string
+}
+
+// PackageVersion returns the name and version of p from the input list, or from
+// its DESCRIPTION for packages written without them.
+func (p *P) PackageVersion() PackageVersion {
+	v := PackageVersion{Name: p.Name, Version: p.Version}
+	if v.Name == "" {
+		v.Name = p.Description.Package
+	}
+	if v.Version == "" {
+		v.Version = p.Description.Version
+	}
+	return v
+}
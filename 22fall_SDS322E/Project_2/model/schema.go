@@ -0,0 +1,125 @@
+package model
+
+import (
+	"Project2/rparse/matcher"
+	"Project2/rparse/query"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SchemaVersion is the version of the P JSON schema written by this build.
+//
+//	1: no Schema field; RFile.Stats is a map of untyped matcher states keyed by matcher name
+//	2: RFile.Stats is a FileStats; query states are nested under "query"
+const SchemaVersion = 2
+
+// Decoder reads a stream of P, upgrading packages written with older schema versions.
+type Decoder struct {
+	dec *json.Decoder
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: json.NewDecoder(r)}
+}
+
+// Decode reads the next package from the stream. It returns io.EOF at the end of the stream.
+func (d *Decoder) Decode(p *P) error {
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		return err
+	}
+	return Unmarshal(raw, p)
+}
+
+// InputOffset returns the offset in the stream just after the last decoded package.
+func (d *Decoder) InputOffset() int64 {
+	return d.dec.InputOffset()
+}
+
+// Unmarshal decodes a package of any supported schema version and upgrades it to SchemaVersion.
+func Unmarshal(data []byte, p *P) error {
+	var version struct{ Schema int }
+	if err := json.Unmarshal(data, &version); err != nil {
+		return err
+	}
+	switch {
+	case version.Schema > SchemaVersion:
+		return fmt.Errorf("unsupported schema version %d (newest supported is %d)", version.Schema, SchemaVersion)
+	case version.Schema <= 1:
+		return unmarshalV1(data, p)
+	}
+	return json.Unmarshal(data, p)
+}
+
+func unmarshalV1(data []byte, p *P) error {
+	if err := json.Unmarshal(data, p); err != nil {
+		return err
+	}
+	var legacy struct {
+		RFiles []struct {
+			Stats map[string]json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	for i := range p.RFiles {
+		stats := &p.RFiles[i].Stats
+		for name, state := range legacy.RFiles[i].Stats {
+			if !strings.HasPrefix(name, query.Prefix) {
+				continue
+			}
+			var queryState query.State
+			if err := json.Unmarshal(state, &queryState); err != nil {
+				return fmt.Errorf("file %s: %s: %w", p.RFiles[i].Name, name, err)
+			}
+			stats.Set(name, queryState)
+		}
+		if stats.Assignment != nil {
+			for j := range stats.Assignment.StatsVariables {
+				upgradeVariableV1(&stats.Assignment.StatsVariables[j])
+			}
+		}
+		if stats.FunctionCall != nil {
+			upgradeFunctionCallsV1(stats.FunctionCall.StatsFunctionCalls)
+		}
+	}
+	p.Schema = SchemaVersion
+	return nil
+}
+
+// upgradeVariableV1 fills in a version 1 Variable, which only recorded assignments
+// to plain symbols and stored the token following the operator as RHSType.
+func upgradeVariableV1(v *matcher.Variable) {
+	v.TargetKind = matcher.TargetSymbol
+	switch v.AssignType {
+	case "EQ_ASSIGN":
+		v.Operator = "="
+	case "LEFT_ASSIGN":
+		v.Operator = "<-"
+	}
+	switch token := v.RHSType; {
+	case token == "FUNCTION":
+		v.RHSType = matcher.ExprFunction
+	case token == "SYMBOL_FUNCTION_CALL", token == "SYMBOL_PACKAGE":
+		v.RHSType = matcher.ExprCall
+	case strings.HasSuffix(token, "_CONST"):
+		v.RHSType = matcher.ExprLiteral
+	default:
+		// a SYMBOL may have been the start of a larger expression
+		v.RHSType = matcher.ExprExpr
+	}
+}
+
+// upgradeFunctionCallsV1 marks version 1 calls, which did not record nesting, as top level.
+func upgradeFunctionCallsV1(calls []matcher.FunctionCall) {
+	for i := range calls {
+		calls[i].Parent = -1
+		calls[i].ArgPos = -1
+		for j := range calls[i].Args {
+			calls[i].Args[j].Call = -1
+		}
+	}
+}
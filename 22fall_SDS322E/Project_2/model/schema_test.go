@@ -0,0 +1,63 @@
+package model
+
+import (
+	"Project2/rparse/matcher"
+	"Project2/rparse/query"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const v1Package = `{
+  "URL": "https://example.org/foo_1.0.tar.gz",
+  "RFiles": [{
+    "Name": "foo/R/foo.R",
+    "NTokens": 12,
+    "Stats": {
+      "paren": {"Stack": ""},
+      "assign": {"StatsVariables": [{"Name": "f", "AssignType": "LEFT_ASSIGN", "RHSType": "FUNCTION"}], "StatsLeftAssignCount": 1},
+      "function_call": {"StatsFunctionCalls": [{"Name": "lm", "Args": [{"Name": "", "Value": "y~x"}]}]},
+      "query.lm": {"Matches": [{"Text": "lm(y~x)"}]}
+    }
+  }]
+}`
+
+func TestDecodeV1(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(v1Package))
+	var p P
+	assert.NoError(t, dec.Decode(&p))
+	assert.Equal(t, SchemaVersion, p.Schema)
+	stats := p.RFiles[0].Stats
+	assert.Equal(t, []matcher.Variable{{
+		Name:       "f",
+		AssignType: "LEFT_ASSIGN",
+		Operator:   "<-",
+		TargetKind: matcher.TargetSymbol,
+		RHSType:    matcher.ExprFunction,
+	}}, stats.Assignment.StatsVariables)
+	call := stats.FunctionCall.StatsFunctionCalls[0]
+	assert.Equal(t, -1, call.Parent)
+	assert.Equal(t, -1, call.Args[0].Call)
+	assert.Len(t, stats.Queries["lm"].Matches, 1)
+	assert.Equal(t, io.EOF, dec.Decode(&p))
+}
+
+func TestDecodeCurrent(t *testing.T) {
+	p := NewP()
+	p.RFiles = []RFile{{Name: "foo/R/foo.R", Stats: NewFileStats(map[string]any{
+		matcher.MatchLibraryCalls: matcher.MatchLibraryCallsState{NamespaceUsed: []string{"stats"}},
+		query.Prefix + "lm":       query.State{},
+	})}}
+	var buf bytes.Buffer
+	assert.NoError(t, json.NewEncoder(&buf).Encode(p))
+
+	var decoded P
+	assert.NoError(t, NewDecoder(&buf).Decode(&decoded))
+	assert.Equal(t, *p, decoded)
+
+	assert.Error(t, Unmarshal([]byte(`{"Schema": 99}`), &decoded))
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"Project2/rparse/matcher"
+	"Project2/rparse/query"
+	"strings"
+)
+
+// FileStats holds the final matcher states of an R file. A state is nil if its
+// matcher was not run on the file or failed.
+type FileStats struct {
+	Assignment   *matcher.MatchAssignmentState   `json:"assign,omitempty"`
+	FunctionDef  *matcher.MatchFunctionDefState  `json:"function_def,omitempty"`
+	FunctionCall *matcher.MatchFunctionCallState `json:"function_call,omitempty"`
+	Library      *matcher.MatchLibraryCallsState `json:"library,omitempty"`
+	ObjectSystem *matcher.MatchObjectSystemState `json:"oop,omitempty"`
+	// Queries are the states of token pattern queries by query name, without query.Prefix
+	Queries map[string]*query.State `json:"query,omitempty"`
+}
+
+// NewFileStats collects the results of rparse.RunMatchers. States of matchers
+// that are only used by other matchers, such as paren, are dropped.
+func NewFileStats(results map[string]any) FileStats {
+	var stats FileStats
+	for name, state := range results {
+		stats.Set(name, state)
+	}
+	return stats
+}
+
+// Set stores the final state of the named matcher.
+func (s *FileStats) Set(name string, state any) {
+	switch state := state.(type) {
+	case matcher.MatchAssignmentState:
+		s.Assignment = &state
+	case matcher.MatchFunctionDefState:
+		s.FunctionDef = &state
+	case matcher.MatchFunctionCallState:
+		s.FunctionCall = &state
+	case matcher.MatchLibraryCallsState:
+		s.Library = &state
+	case matcher.MatchObjectSystemState:
+		s.ObjectSystem = &state
+	case query.State:
+		if s.Queries == nil {
+			s.Queries = make(map[string]*query.State)
+		}
+		s.Queries[strings.TrimPrefix(name, query.Prefix)] = &state
+	}
+}
@@ -1,11 +0,0 @@
-package feature
-
-import "encoding/json"
-
-func remarshalAs(input interface{}, output interface{}) error {
-	bytes, err := json.Marshal(input)
-	if err != nil {
-		return err
-	}
-	return json.Unmarshal(bytes, output)
-}
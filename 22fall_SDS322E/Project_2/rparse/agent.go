@@ -2,6 +2,7 @@ package rparse
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,10 +36,7 @@ func (a *AgentStats) Collect(agents ...*Agent) {
 	a.OK = 0
 	a.Start = 0
 	for _, agent := range agents {
-		a.Start += agent.Stats.Start
-		a.Kill += agent.Stats.Kill
-		a.Err += agent.Stats.Err
-		a.OK += agent.Stats.OK
+		a.Add(agent.LoadStats())
 	}
 }
 
@@ -59,15 +58,30 @@ type Agent struct {
 	input     *bufio.Writer
 	stdout    *bufio.Scanner
 	busyMutex sync.Mutex
+	// procMutex guards cmd, which the watchdog stops
+	procMutex sync.Mutex
 	Debug     bool
 }
 
+// LoadStats returns the counters of a while it may be running.
+func (a *Agent) LoadStats() AgentStats {
+	return AgentStats{
+		Start: atomic.LoadUint64(&a.Stats.Start),
+		Kill:  atomic.LoadUint64(&a.Stats.Kill),
+		Err:   atomic.LoadUint64(&a.Stats.Err),
+		OK:    atomic.LoadUint64(&a.Stats.OK),
+	}
+}
+
 type RToken struct {
 	Filename string
 	Token    string
 	Text     string
 
-	MatcherState map[string]any
+	// Depth is the parenthesis nesting depth of the token, annotated by the paren matcher.
+	Depth int
+	// annotations holds sparse per-token values published by matchers, see Annotate.
+	annotations map[string]any
 }
 
 func (a *Agent) Start(Rpath string) (err error) {
@@ -76,7 +90,7 @@ func (a *Agent) Start(Rpath string) (err error) {
 	}
 
 	a.rPath = Rpath
-	a.cmd = exec.Command(
+	cmd := exec.Command(
 		Rpath, "--vanilla", "--slave", "-")
 	//"cat")
 
@@ -126,21 +140,24 @@ func (a *Agent) Start(Rpath string) (err error) {
 		"};\n",
 	}, ""), "\t", " ")
 
-	if stdin, err := a.cmd.StdinPipe(); err != nil {
+	if stdin, err := cmd.StdinPipe(); err != nil {
 		return err
 	} else {
 		a.input = bufio.NewWriter(stdin)
 	}
-	a.cmd.Stderr = os.Stderr
-	if stdout, err := a.cmd.StdoutPipe(); err != nil {
+	cmd.Stderr = os.Stderr
+	if stdout, err := cmd.StdoutPipe(); err != nil {
 		return err
 	} else {
 		a.stdout = bufio.NewScanner(stdout)
 	}
-	//a.cmd.Stdout = os.Stdout
-	if err := a.cmd.Start(); err != nil {
+	//cmd.Stdout = os.Stdout
+	if err := cmd.Start(); err != nil {
 		return err
 	}
+	a.procMutex.Lock()
+	a.cmd = cmd
+	a.procMutex.Unlock()
 	if _, err := a.input.Write([]byte(prelude)); err != nil {
 		return err
 	}
@@ -148,12 +165,12 @@ func (a *Agent) Start(Rpath string) (err error) {
 		return err
 	}
 
-	a.Stats.Start++
+	atomic.AddUint64(&a.Stats.Start, 1)
 	return nil
 }
 
-func (a *Agent) CmdParseFile(filename string, path string) (tokens RTokenList, err error) {
-	data, err := a.IssueCmd(agentCommand{
+func (a *Agent) CmdParseFile(ctx context.Context, filename string, path string) (tokens RTokenList, err error) {
+	data, err := a.IssueCmd(ctx, agentCommand{
 		OpCode: "parse_file",
 		Args:   []string{filename, path},
 	})
@@ -170,8 +187,8 @@ func (a *Agent) CmdParseFile(filename string, path string) (tokens RTokenList, e
 	return
 }
 
-func (a *Agent) CmdParseText(filename string, text string) (tokens RTokenList, err error) {
-	data, err := a.IssueCmd(agentCommand{
+func (a *Agent) CmdParseText(ctx context.Context, filename string, text string) (tokens RTokenList, err error) {
+	data, err := a.IssueCmd(ctx, agentCommand{
 		OpCode: "parse_text",
 		Args:   []string{filename, text},
 	})
@@ -241,12 +258,17 @@ func writeHexString(out *bufio.Writer, s string) (err error) {
 	return nil
 }
 
-func (a *Agent) IssueCmd(cmd agentCommand) (data [][]string, err error) {
+// IssueCmd runs a command on the agent, starting it if needed. The agent is
+// killed if the command takes too long or ctx is canceled.
+func (a *Agent) IssueCmd(ctx context.Context, cmd agentCommand) (data [][]string, err error) {
 	a.busyMutex.Lock()
 	defer a.busyMutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	kill := func(reason string) {
-		a.Stats.Kill++
+		atomic.AddUint64(&a.Stats.Kill, 1)
 		if err := a.Stop(); err != nil {
 			log.Printf("Error stopping agent: %s", err)
 		} else {
@@ -265,12 +287,15 @@ func (a *Agent) IssueCmd(cmd agentCommand) (data [][]string, err error) {
 		case <-done:
 		case <-timeout:
 			kill("watchdog timeout")
+		case <-ctx.Done():
+			kill("canceled")
 		}
 		close(watchdogDone)
 	}()
 
-	if a.cmd == nil || a.cmd.Process == nil || a.cmd.ProcessState != nil && a.cmd.ProcessState.Exited() {
-		if err := a.Start(""); err != nil {
+	if !a.running() {
+		// restart with the Rscript of the first Start
+		if err := a.Start(a.rPath); err != nil {
 			return nil, err
 		}
 	}
@@ -305,8 +330,7 @@ func (a *Agent) IssueCmd(cmd agentCommand) (data [][]string, err error) {
 
 	for {
 		if !a.stdout.Scan() {
-			kill("unexpected EOF")
-			return nil, errors.New("R agent died")
+			return nil, a.died(ctx, kill)
 		}
 		line := a.stdout.Text()
 		if line == "" {
@@ -318,8 +342,7 @@ func (a *Agent) IssueCmd(cmd agentCommand) (data [][]string, err error) {
 		}
 		for !strings.HasSuffix(line, a.eol) {
 			if !a.stdout.Scan() {
-				kill("unexpected EOF")
-				return nil, errors.New("R agent died")
+				return nil, a.died(ctx, kill)
 			}
 			line += a.stdout.Text()
 		}
@@ -331,11 +354,11 @@ func (a *Agent) IssueCmd(cmd agentCommand) (data [][]string, err error) {
 		}
 		if record[0] == "done" {
 			if err == nil {
-				a.Stats.OK++
+				atomic.AddUint64(&a.Stats.OK, 1)
 			}
 			return data, err
 		} else if record[0] == "error" {
-			a.Stats.Err++
+			atomic.AddUint64(&a.Stats.Err, 1)
 			err = errors.New(record[1])
 		} else if record[0] == "data" {
 			data = append(data, record[1:])
@@ -345,11 +368,35 @@ func (a *Agent) IssueCmd(cmd agentCommand) (data [][]string, err error) {
 	}
 }
 
-func (a *Agent) Stop() error {
-	if err := a.cmd.Process.Kill(); err != nil {
+// died returns the error of a command whose output ended early, which is
+// ctx's error if the agent was killed because ctx was canceled.
+func (a *Agent) died(ctx context.Context, kill func(reason string)) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
+	kill("unexpected EOF")
+	return errors.New("R agent died")
+}
+
+// running reports whether the agent's R process was started and not stopped.
+func (a *Agent) running() bool {
+	a.procMutex.Lock()
+	defer a.procMutex.Unlock()
+	return a.cmd != nil && a.cmd.Process != nil && (a.cmd.ProcessState == nil || !a.cmd.ProcessState.Exited())
+}
+
+// Stop kills the agent's R process if it is running.
+func (a *Agent) Stop() error {
+	a.procMutex.Lock()
+	defer a.procMutex.Unlock()
+	if a.cmd == nil || a.cmd.Process == nil {
+		return nil
+	}
+	err := a.cmd.Process.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		err = nil
+	}
 	a.cmd.Wait()
 	a.cmd = nil
-	return nil
+	return err
 }
@@ -1,7 +1,9 @@
 package rparse
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -17,7 +19,7 @@ func TestAgentCommandPing(t *testing.T) {
 		OpCode: "ping",
 		Args:   []string{},
 	}
-	data, err := agent.IssueCmd(pingCmd)
+	data, err := agent.IssueCmd(context.Background(), pingCmd)
 	assert.NoError(t, err)
 	assert.Equal(t, [][]string{{"pong"}}, data)
 }
@@ -36,7 +38,7 @@ func TestAgentCommandParse(t *testing.T) {
 	for retries := 0; retries < 5; retries++ {
 
 		fileName := fmt.Sprintf("hello_%d.R", retries)
-		tokens, err := agent.CmdParseText(fileName, exampleCode)
+		tokens, err := agent.CmdParseText(context.Background(), fileName, exampleCode)
 		assert.NoError(t, err)
 
 		containTokens := make(map[string]bool)
@@ -51,3 +53,14 @@ func TestAgentCommandParse(t *testing.T) {
 		assert.True(t, containTokens["LEFT_ASSIGN"])
 	}
 }
+
+func TestAgentRestartRscript(t *testing.T) {
+	rscript := filepath.Join(t.TempDir(), "Rscript")
+	agent := new(Agent)
+	assert.Error(t, agent.Start(rscript))
+	// the agent is restarted with the Rscript it was started with
+	_, err := agent.IssueCmd(context.Background(), agentCommand{OpCode: "ping"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), rscript)
+	}
+}
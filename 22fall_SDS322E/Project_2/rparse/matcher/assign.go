@@ -7,84 +7,238 @@ import (
 
 const MatchAssignment = "assign"
 
+func init() {
+	Default.MustRegister(rparse.NewMatcherSpec(MatchAssignment, []string{TrackParenthesis}, MatchAssignmentUpdate))
+}
+
+// Kinds of assignment targets.
+const (
+	TargetSymbol      = "symbol"
+	TargetIndex       = "index"
+	TargetMember      = "member"
+	TargetSlot        = "slot"
+	TargetReplacement = "replacement"
+)
+
+// AnonymousFunction is the enclosing function name of assignments in a function not assigned to a name.
+const AnonymousFunction = "<anonymous>"
+
 type Variable struct {
-	Name       string
+	Name string
+	// AssignType is the token of the assignment operator, or SYMBOL_FUNCTION_CALL for assign().
 	AssignType string
-	RHSType    string
+	// Operator is the operator text, or the name of the function for assign().
+	Operator string
+	Super    bool
+	// TargetKind is one of TargetSymbol, TargetIndex, TargetMember, TargetSlot or TargetReplacement.
+	TargetKind string
+	// Replacement is the replacement function the target goes through, e.g.
+	// "names" for names(x) <- ... and also for names(x)[2] <- ..., whose
+	// TargetKind is TargetIndex.
+	Replacement string
+	// Function is the name of the enclosing function, empty at top level.
+	Function string
+	// RHSType is the kind of the assigned expression, one of the Expr* constants.
+	RHSType string
+	RHSName string
+}
+
+type assignScope struct {
+	name       string
+	braceDepth int
 }
 
 type MatchAssignmentState struct {
-	initialized    bool
-	assignTokenIdx int
-	assignName     string
+	// assignName is the target of an assignment operator on the previous token.
+	assignName string
+	scopes     []assignScope
 
-	partAssignMode          string
-	partAssignParenStackLen int
+	Errors                []string
+	StatsVariables        []Variable
+	StatsEqAssignCount    int
+	StatsLeftAssignCount  int
+	StatsRightAssignCount int
+	StatsSuperAssignCount int
+	StatsAssignCallCount  int
+}
 
-	Errors               []string
-	StatsVariables       []Variable
-	StatsEqAssignCount   int
-	StatsLeftAssignCount int
+func (state *MatchAssignmentState) function() string {
+	if len(state.scopes) == 0 {
+		return ""
+	}
+	return state.scopes[len(state.scopes)-1].name
 }
 
-func MatchAssignmentUpdate(state MatchAssignmentState, i int, tokens rparse.RTokenList) (next MatchAssignmentState, delta int, err error) {
-	if !state.initialized {
-		state.initialized = true
-		state.assignTokenIdx = -1
-		return state, 0, nil
+// resolveTarget resolves the assignment target ending at tokens[end] to its root variable.
+func resolveTarget(tokens rparse.RTokenList, end int) (v Variable, err error) {
+	if end < 0 {
+		return v, fmt.Errorf("missing assignment target")
 	}
-	if state.assignName != "" {
-		if i != state.assignTokenIdx {
-			return state, state.assignTokenIdx - i, nil
+	switch tokens[end].Token {
+	case "SYMBOL", "STR_CONST":
+		if end >= 2 && (tokens[end-1].Token == "'$'" || tokens[end-1].Token == "'@'") {
+			if v, err = resolveTarget(tokens, end-2); err != nil {
+				return v, err
+			}
+			if tokens[end-1].Token == "'$'" {
+				v.TargetKind = TargetMember
+			} else {
+				v.TargetKind = TargetSlot
+			}
+			return v, nil
 		}
-		rhsType := tokens[i+1].Token
-		state.StatsVariables = append(state.StatsVariables, Variable{
-			Name:       state.assignName,
-			AssignType: tokens[i].Token,
-			RHSType:    rhsType,
-		})
-		state.assignName = ""
-		state.assignTokenIdx = -1
-		return state, 1, nil
-	}
-	thisParenStackLen := len(tokens[i].MatcherState[TrackParenthesis].(TrackParenthesisState).Stack)
-	if state.partAssignParenStackLen > 0 && state.partAssignParenStackLen == thisParenStackLen {
-		if tokens[i].Token == "SYMBOL" {
-			state.assignName = tokens[i].Text
-		} else {
-			state.Errors = append(state.Errors, fmt.Sprintf("unexpected token %s trying to resolve ']' assign at %d", tokens[i].Token, i))
+		return Variable{Name: unquote(tokens[end].Text), TargetKind: TargetSymbol}, nil
+	case "']'":
+		open := matchingBracketOpen(tokens, end)
+		if open == -1 {
+			return v, fmt.Errorf("unmatched ']' in assignment target at %d", end)
+		}
+		if v, err = resolveTarget(tokens, open-1); err != nil {
+			return v, err
+		}
+		v.TargetKind = TargetIndex
+		return v, nil
+	case "')'":
+		open := matchingOpen(tokens, end)
+		if open < 1 || tokens[open-1].Token != "SYMBOL_FUNCTION_CALL" {
+			return v, fmt.Errorf("unexpected ')' in assignment target at %d", end)
+		}
+		argEnd := open + 1
+		for argEnd < end && !(tokens[argEnd].Token == "','" && parenDepth(tokens, argEnd) == parenDepth(tokens, open)) {
+			argEnd++
 		}
-		return state, state.assignTokenIdx - i, nil
+		if v, err = resolveTarget(tokens, argEnd-1); err != nil {
+			return v, err
+		}
+		v.TargetKind = TargetReplacement
+		v.Replacement = tokens[open-1].Text
+		return v, nil
 	}
+	return v, fmt.Errorf("unexpected token %s before assignment at %d", tokens[end].Token, end)
+}
 
-	if state.assignTokenIdx > i {
-		if i == 0 || tokens[i-1].Token != "'$'" && tokens[i-1].Token != "'@'" {
-			if tokens[i].Token == "SYMBOL" {
-				state.assignName = tokens[i].Text
-			} else if tokens[i].Token == "']'" {
-				state.partAssignMode = tokens[i].Token
-			} else if tokens[i].Token == "')'" {
-				// attributes(x)...
-			} else {
-				state.Errors = append(state.Errors, fmt.Sprintf("unexptected token before assignment %s", tokens[i].Token))
+// classifyValueBefore classifies the value of a right assignment ending at tokens[end].
+func classifyValueBefore(tokens rparse.RTokenList, end int) (kind string, name string) {
+	switch token := tokens[end].Token; {
+	case isConstToken(token), token == "SYMBOL":
+		if end == 0 || !binaryOperatorTokens[tokens[end-1].Token] {
+			return classifyExpr(tokens, end)
+		}
+	case token == "')'":
+		if open := matchingOpen(tokens, end); open >= 1 && tokens[open-1].Token == "SYMBOL_FUNCTION_CALL" {
+			start := open - 1
+			if start >= 2 && tokens[start-2].Token == "SYMBOL_PACKAGE" {
+				start -= 2
+			}
+			if start == 0 || !binaryOperatorTokens[tokens[start-1].Token] {
+				return ExprCall, exprText(tokens, start, open)
 			}
 		}
-		return state, state.assignTokenIdx - i + 1, nil
 	}
-	isAssign := false
-	if tokens[i].Token == "EQ_ASSIGN" {
-		isAssign = true
-		state.StatsEqAssignCount++
-	} else if tokens[i].Token == "LEFT_ASSIGN" {
-		isAssign = true
-		state.StatsLeftAssignCount++
+	return ExprExpr, ""
+}
+
+func (state *MatchAssignmentState) matchAssignCall(i int, tokens rparse.RTokenList) {
+	if i+1 >= len(tokens) || tokens[i+1].Token != "'('" {
+		return
+	}
+	if i >= 2 && tokens[i-1].Token == "NS_GET" && tokens[i-2].Text != "base" {
+		return
+	}
+	j := i + 2
+	if j+1 < len(tokens) && tokens[j].Token == "SYMBOL_SUB" && tokens[j+1].Token == "EQ_SUB" {
+		j += 2
+	}
+	if j+1 >= len(tokens) || tokens[j].Token != "STR_CONST" || tokens[j+1].Token != "','" {
+		return
 	}
-	if isAssign {
-		state.assignName = ""
-		state.assignTokenIdx = i
-		state.partAssignParenStackLen = 0
-		state.partAssignMode = ""
-		return state, -1, nil
+	v := Variable{
+		Name:       unquote(tokens[j].Text),
+		AssignType: tokens[i].Token,
+		Operator:   tokens[i].Text,
+		TargetKind: TargetSymbol,
+		Function:   state.function(),
+	}
+	j += 2
+	if j+1 < len(tokens) && tokens[j].Token == "SYMBOL_SUB" && tokens[j+1].Token == "EQ_SUB" {
+		j += 2
+	}
+	v.RHSType, v.RHSName = classifyExpr(tokens, j)
+	state.StatsAssignCallCount++
+	state.StatsVariables = append(state.StatsVariables, v)
+}
+
+func MatchAssignmentUpdate(state MatchAssignmentState, i int, tokens rparse.RTokenList) (next MatchAssignmentState, delta int, err error) {
+	assignName := state.assignName
+	state.assignName = ""
+
+	switch tokens[i].Token {
+	case "EQ_ASSIGN", "LEFT_ASSIGN":
+		// every operator is counted, also those whose target is not resolved
+		if tokens[i].Token == "EQ_ASSIGN" {
+			state.StatsEqAssignCount++
+		} else {
+			state.StatsLeftAssignCount++
+		}
+		super := tokens[i].Text == "<<-"
+		if super {
+			state.StatsSuperAssignCount++
+		}
+		v, err := resolveTarget(tokens, i-1)
+		if err != nil {
+			state.Errors = append(state.Errors, err.Error())
+			return state, 1, nil
+		}
+		v.AssignType = tokens[i].Token
+		v.Operator = tokens[i].Text
+		v.Super = super
+		v.Function = state.function()
+		v.RHSType, v.RHSName = classifyExpr(tokens, i+1)
+		state.StatsVariables = append(state.StatsVariables, v)
+		state.assignName = v.Name
+	case "RIGHT_ASSIGN":
+		if i == 0 || i+1 >= len(tokens) || (tokens[i+1].Token != "SYMBOL" && tokens[i+1].Token != "STR_CONST") {
+			state.Errors = append(state.Errors, fmt.Sprintf("unexpected right assignment target at %d", i))
+			return state, 1, nil
+		}
+		v := Variable{
+			Name:       unquote(tokens[i+1].Text),
+			AssignType: tokens[i].Token,
+			Operator:   tokens[i].Text,
+			Super:      tokens[i].Text == "->>",
+			TargetKind: TargetSymbol,
+			Function:   state.function(),
+		}
+		v.RHSType, v.RHSName = classifyValueBefore(tokens, i-1)
+		state.StatsRightAssignCount++
+		if v.Super {
+			state.StatsSuperAssignCount++
+		}
+		state.StatsVariables = append(state.StatsVariables, v)
+	case "SYMBOL_FUNCTION_CALL":
+		if tokens[i].Text == "assign" || tokens[i].Text == "delayedAssign" {
+			state.matchAssignCall(i, tokens)
+		}
+	case "FUNCTION":
+		if assignName != "" {
+			tokens[i].Annotate(MatchAssignment, assignName)
+		}
+		name := assignName
+		if name == "" && i >= 2 && tokens[i-1].Token == "EQ_SUB" {
+			name = unquote(tokens[i-2].Text)
+		}
+		if name == "" {
+			name = AnonymousFunction
+		}
+		if i+1 < len(tokens) && tokens[i+1].Token == "'('" {
+			if body := matchingClose(tokens, i+1) + 1; body > 0 && body < len(tokens) && tokens[body].Token == "'{'" {
+				state.scopes = append(state.scopes, assignScope{name: name, braceDepth: parenDepth(tokens, body)})
+			}
+		}
+	case "'}'":
+		if n := len(state.scopes); n > 0 && state.scopes[n-1].braceDepth == parenDepth(tokens, i) {
+			state.scopes = state.scopes[:n-1]
+		}
 	}
 
 	return state, 1, nil
@@ -0,0 +1,57 @@
+package matcher
+
+import (
+	"Project2/rparse"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// generateTokens returns the tokens of a generated R file of roughly n tokens
+// made of function definitions like
+//
+//	f1 <- function(x, y = 2) { z <- g(x, h(y)); if (z > 1) { z[1] <- list(a = 1) }; z }
+func generateTokens(n int) rparse.RTokenList {
+	var tokens rparse.RTokenList
+	for i := 0; len(tokens) < n; i++ {
+		tokens = append(tokens, makeTokens(
+			"SYMBOL", fmt.Sprintf("f%d", i), "LEFT_ASSIGN", "<-",
+			"FUNCTION", "function", "'('", "(", "SYMBOL_FORMALS", "x", "','", ",",
+			"SYMBOL_FORMALS", "y", "EQ_FORMALS", "=", "NUM_CONST", "2", "')'", ")", "'{'", "{",
+			"SYMBOL", "z", "LEFT_ASSIGN", "<-", "SYMBOL_FUNCTION_CALL", "g", "'('", "(", "SYMBOL", "x", "','", ",",
+			"SYMBOL_FUNCTION_CALL", "h", "'('", "(", "SYMBOL", "y", "')'", ")", "')'", ")", "';'", ";",
+			"IF", "if", "'('", "(", "SYMBOL", "z", "GT", ">", "NUM_CONST", "1", "')'", ")", "'{'", "{",
+			"SYMBOL", "z", "'['", "[", "NUM_CONST", "1", "']'", "]", "LEFT_ASSIGN", "<-",
+			"SYMBOL_FUNCTION_CALL", "list", "'('", "(", "SYMBOL_SUB", "a", "EQ_SUB", "=", "NUM_CONST", "1", "')'", ")",
+			"'}'", "}", "';'", ";", "SYMBOL", "z", "'}'", "}",
+		)...)
+	}
+	return tokens
+}
+
+func BenchmarkDefaultMatchers50k(b *testing.B) {
+	plan, err := Default.Plan()
+	if err != nil {
+		b.Fatal(err)
+	}
+	source := generateTokens(50000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var retained uint64
+	for n := 0; n < b.N; n++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		tokens := append(rparse.RTokenList(nil), source...)
+		results, errs := rparse.RunMatchers(plan, tokens)
+		if len(errs) > 0 {
+			b.Fatal(errs)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		retained += after.HeapAlloc - before.HeapAlloc
+		runtime.KeepAlive(tokens)
+		runtime.KeepAlive(results)
+	}
+	b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+}
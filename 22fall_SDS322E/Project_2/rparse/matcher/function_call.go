@@ -2,74 +2,162 @@ package matcher
 
 import (
 	"Project2/rparse"
-	"strings"
 )
 
 const MatchFunctionCall = "function_call"
 
+func init() {
+	Default.MustRegister(rparse.NewMatcherSpec(MatchFunctionCall, []string{TrackParenthesis}, MatchFunctionCallUpdate))
+}
+
+// Argument types that are not a single R token.
+const (
+	ArgCall     = "call"
+	ArgFunction = "function"
+	ArgFormula  = "formula"
+	ArgExpr     = "expr"
+)
+
 type FunctionCallArg struct {
-	Name  string
+	Name string
+	// Type is the R token of a single-token argument (SYMBOL, STR_CONST, ...),
+	// otherwise one of ArgCall, ArgFunction, ArgFormula or ArgExpr.
+	Type  string
 	Value string
+	// Call is the index into StatsFunctionCalls of the call making up the whole argument, or -1.
+	Call int
 }
 
 type FunctionCall struct {
-	Name string
-	Args []FunctionCallArg
+	Name    string
+	Package string
+	// Parent is the index into StatsFunctionCalls of the enclosing call, or -1 at top level.
+	Parent int
+	// ArgPos is the position of this call within the arguments of Parent, or -1 at top level.
+	ArgPos int
+	Args   []FunctionCallArg
 }
 
-type MatchFunctionCallState struct {
-	curCallIdx int
+type callFrame struct {
+	callIdx    int
+	parenDepth int
+	brackets   int
+	startToken int
+
+	argStart int
+	argName  string
 
-	inSub              bool
-	thisCallParenDepth int
-	thisCall           FunctionCall
+	lastChild      int
+	lastChildStart int
+	lastChildEnd   int
+}
+
+type MatchFunctionCallState struct {
+	stack []callFrame
 
 	Errors             []string
 	StatsFunctionCalls []FunctionCall
 }
 
-func MatchFunctionCallUpdate(state MatchFunctionCallState, i int, tokens rparse.RTokenList) (next MatchFunctionCallState, delta int, err error) {
-	parenStack := tokens[i].MatcherState[TrackParenthesis].(TrackParenthesisState).Stack
-	if state.thisCall.Name != "" {
-		if len(parenStack) == state.thisCallParenDepth {
-			// finish parsing this function call
-			state.StatsFunctionCalls = append(state.StatsFunctionCalls, state.thisCall)
-			state.thisCall = FunctionCall{}
-			state.thisCallParenDepth = 0
-			state.inSub = false
-			return state, 1, nil
+func (state *MatchFunctionCallState) finishArg(frame *callFrame, end int, tokens rparse.RTokenList) {
+	call := &state.StatsFunctionCalls[frame.callIdx]
+	if frame.argStart < end || frame.argName != "" {
+		arg := FunctionCallArg{
+			Name:  frame.argName,
+			Value: exprText(tokens, frame.argStart, end),
+			Call:  -1,
 		}
-		token := tokens[i].Token
-		if token == "SYMBOL" || strings.HasSuffix(token, "_CONST") {
-			if state.inSub {
-				state.thisCall.Args[len(state.thisCall.Args)-1].Value = tokens[i].Text
-				state.inSub = false
-			} else {
-				state.thisCall.Args = append(state.thisCall.Args, FunctionCallArg{
-					Name:  "",
-					Value: tokens[i].Text,
-				})
+		switch {
+		case frame.argStart >= end:
+			arg.Type = "EMPTY"
+		case end-frame.argStart == 1:
+			arg.Type = tokens[frame.argStart].Token
+		case frame.lastChild != -1 && frame.lastChildStart == frame.argStart && frame.lastChildEnd == end-1:
+			arg.Type = ArgCall
+			arg.Call = frame.lastChild
+		case tokens[frame.argStart].Token == "FUNCTION":
+			arg.Type = ArgFunction
+		default:
+			arg.Type = ArgExpr
+			for j := frame.argStart; j < end; j++ {
+				if tokens[j].Token == "'~'" && parenDepth(tokens, j) == frame.parenDepth {
+					arg.Type = ArgFormula
+					break
+				}
 			}
-		} else if token == "SYMBOL_SUB" {
-			state.thisCall.Args = append(state.thisCall.Args, FunctionCallArg{
-				Name:  tokens[i].Text,
-				Value: "",
-			})
-			state.inSub = true
 		}
-		return state, 1, nil
+		call.Args = append(call.Args, arg)
 	}
+	frame.argName = ""
+	frame.argStart = end + 1
+	frame.lastChild = -1
+}
 
-	if tokens[i].Token == "SYMBOL_FUNCTION_CALL" {
-		if tokens[i+1].Token != "'('" {
+func MatchFunctionCallUpdate(state MatchFunctionCallState, i int, tokens rparse.RTokenList) (next MatchFunctionCallState, delta int, err error) {
+	token := tokens[i].Token
+	if len(state.stack) > 0 {
+		frame := &state.stack[len(state.stack)-1]
+		if parenDepth(tokens, i) == frame.parenDepth {
+			switch token {
+			case "')'":
+				state.finishArg(frame, i, tokens)
+				closed := *frame
+				state.stack = state.stack[:len(state.stack)-1]
+				if len(state.stack) > 0 {
+					parent := &state.stack[len(state.stack)-1]
+					parent.lastChild = closed.callIdx
+					parent.lastChildStart = closed.startToken
+					parent.lastChildEnd = i
+				}
+				return state, 1, nil
+			case "','":
+				if frame.brackets == 0 {
+					state.finishArg(frame, i, tokens)
+				}
+			case "'['":
+				frame.brackets++
+			case "LBB":
+				frame.brackets += 2
+			case "']'":
+				frame.brackets--
+			case "SYMBOL_SUB", "STR_CONST", "NULL_CONST":
+				if i == frame.argStart && i+1 < len(tokens) && tokens[i+1].Token == "EQ_SUB" {
+					frame.argName = unquote(tokens[i].Text)
+					frame.argStart = i + 2
+				}
+			}
+		}
+	}
+
+	if token == "SYMBOL_FUNCTION_CALL" {
+		if i+1 >= len(tokens) || tokens[i+1].Token != "'('" {
 			state.Errors = append(state.Errors, "function call missing '('")
 			return state, 1, nil
 		}
-		state.thisCall.Name = tokens[i].Text
-		state.thisCall.Args = []FunctionCallArg{}
-		state.curCallIdx = i
-		state.thisCallParenDepth = len(parenStack)
-		return state, 2, nil
+		call := FunctionCall{
+			Name:   tokens[i].Text,
+			Parent: -1,
+			ArgPos: -1,
+			Args:   []FunctionCallArg{},
+		}
+		startToken := i
+		if i >= 2 && tokens[i-2].Token == "SYMBOL_PACKAGE" &&
+			(tokens[i-1].Token == "NS_GET" || tokens[i-1].Token == "NS_GET_INT") {
+			call.Package = tokens[i-2].Text
+			startToken = i - 2
+		}
+		if len(state.stack) > 0 {
+			call.Parent = state.stack[len(state.stack)-1].callIdx
+			call.ArgPos = len(state.StatsFunctionCalls[call.Parent].Args)
+		}
+		state.StatsFunctionCalls = append(state.StatsFunctionCalls, call)
+		state.stack = append(state.stack, callFrame{
+			callIdx:    len(state.StatsFunctionCalls) - 1,
+			parenDepth: parenDepth(tokens, i+1),
+			startToken: startToken,
+			argStart:   i + 2,
+			lastChild:  -1,
+		})
 	}
 
 	return state, 1, nil
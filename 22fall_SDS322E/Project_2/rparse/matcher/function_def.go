@@ -6,6 +6,10 @@ import (
 
 const MatchFunctionDef = "function_def"
 
+func init() {
+	Default.MustRegister(rparse.NewMatcherSpec(MatchFunctionDef, []string{TrackParenthesis, MatchAssignment}, MatchFunctionDefUpdate))
+}
+
 type FunctionArg struct {
 	Name    string
 	Default string
@@ -21,9 +25,8 @@ type MatchFunctionDefState struct {
 	curArg              FunctionArg
 	nextIsFormalDefault bool
 
-	thisFuntion         Function
 	funcKeywordTokenIdx int
-	beginParenStack     []byte
+	beginDepth          int
 	StatFunctionDefs    []Function
 }
 
@@ -36,23 +39,18 @@ func MatchFunctionDefUpdate(state MatchFunctionDefState, i int, tokens rparse.RT
 
 	if tokens[i].Token == "FUNCTION" {
 		state.funcKeywordTokenIdx = i
-		assignMatcherState := tokens[i-1].MatcherState[MatchAssignment].(MatchAssignmentState)
-		if assignMatcherState.assignName != "" {
-			state.functionDef.AssignedName = assignMatcherState.assignName
+		if assignName, ok := tokens[i].Annotation(MatchAssignment).(string); ok {
+			state.functionDef.AssignedName = assignName
 		}
-		state.beginParenStack = tokens[i].MatcherState[TrackParenthesis].(TrackParenthesisState).Stack
+		state.beginDepth = tokens[i].Depth
 		return state, 1, nil
 	} else if state.funcKeywordTokenIdx != -1 {
-		thisParenStack := tokens[i].MatcherState[TrackParenthesis].(TrackParenthesisState).Stack
-		diffDelta := len(thisParenStack) - len(state.beginParenStack)
+		diffDelta := tokens[i].Depth - state.beginDepth
 		if diffDelta == 0 {
 			if state.curArg.Name != "" {
 				state.functionDef.Args = append(state.functionDef.Args, state.curArg)
 			}
-			// finish parsing all arguments, go back to function keyword
-			stateOnFunctionKeyword := tokens[state.funcKeywordTokenIdx].MatcherState[MatchFunctionDef].(MatchFunctionDefState)
-			stateOnFunctionKeyword.thisFuntion = state.functionDef
-			tokens[state.funcKeywordTokenIdx].MatcherState[MatchFunctionDef] = stateOnFunctionKeyword
+			// finish parsing all arguments
 			state.StatFunctionDefs = append(state.StatFunctionDefs, state.functionDef)
 			state.functionDef = Function{}
 			state.funcKeywordTokenIdx = -1
@@ -8,6 +8,10 @@ import (
 
 const MatchLibraryCalls = "library"
 
+func init() {
+	Default.MustRegister(rparse.NewMatcherSpec(MatchLibraryCalls, nil, MatchLibraryCallsUpdate))
+}
+
 type LibraryCall struct {
 	Method    string
 	Namespace string
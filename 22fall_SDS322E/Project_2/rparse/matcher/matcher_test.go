@@ -0,0 +1,138 @@
+package matcher
+
+import (
+	"Project2/rparse"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTokens builds a token list from alternating token/text pairs.
+func makeTokens(pairs ...string) rparse.RTokenList {
+	tokens := make(rparse.RTokenList, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		tokens = append(tokens, rparse.RToken{Filename: "test.R", Token: pairs[i], Text: pairs[i+1]})
+	}
+	return tokens
+}
+
+func TestMatchFunctionCallNested(t *testing.T) {
+	// print(summary(stats::lm(y ~ x, data = d)))
+	tokens := makeTokens(
+		"SYMBOL_FUNCTION_CALL", "print", "'('", "(",
+		"SYMBOL_FUNCTION_CALL", "summary", "'('", "(",
+		"SYMBOL_PACKAGE", "stats", "NS_GET", "::", "SYMBOL_FUNCTION_CALL", "lm", "'('", "(",
+		"SYMBOL", "y", "'~'", "~", "SYMBOL", "x", "','", ",",
+		"SYMBOL_SUB", "data", "EQ_SUB", "=", "SYMBOL", "d",
+		"')'", ")", "')'", ")", "')'", ")",
+	)
+	_, err := rparse.RunTokenMatcher(tokens, TrackParenthesisUpdate)
+	assert.NoError(t, err)
+	state, err := rparse.RunTokenMatcher(tokens, MatchFunctionCallUpdate)
+	assert.NoError(t, err)
+
+	calls := state.StatsFunctionCalls
+	assert.Len(t, calls, 3)
+	assert.Empty(t, state.Errors)
+
+	assert.Equal(t, "print", calls[0].Name)
+	assert.Equal(t, -1, calls[0].Parent)
+	assert.Equal(t, []FunctionCallArg{{Type: ArgCall, Value: "summary(stats::lm(y~x,data=d))", Call: 1}}, calls[0].Args)
+
+	assert.Equal(t, "summary", calls[1].Name)
+	assert.Equal(t, 0, calls[1].Parent)
+	assert.Equal(t, 0, calls[1].ArgPos)
+	assert.Equal(t, ArgCall, calls[1].Args[0].Type)
+	assert.Equal(t, 2, calls[1].Args[0].Call)
+
+	assert.Equal(t, "lm", calls[2].Name)
+	assert.Equal(t, "stats", calls[2].Package)
+	assert.Equal(t, 1, calls[2].Parent)
+	assert.Equal(t, []FunctionCallArg{
+		{Type: ArgFormula, Value: "y~x", Call: -1},
+		{Name: "data", Type: "SYMBOL", Value: "d", Call: -1},
+	}, calls[2].Args)
+}
+
+func TestMatchAssignment(t *testing.T) {
+	// names(x)[2] <- "a"
+	// f <- function(a) { obj$y <<- g(a); 1 -> w; assign("k", y ~ a) }
+	// f(1)
+	tokens := makeTokens(
+		"SYMBOL_FUNCTION_CALL", "names", "'('", "(", "SYMBOL", "x", "')'", ")",
+		"'['", "[", "NUM_CONST", "2", "']'", "]", "LEFT_ASSIGN", "<-", "STR_CONST", `"a"`,
+		"SYMBOL", "f", "LEFT_ASSIGN", "<-", "FUNCTION", "function", "'('", "(", "SYMBOL_FORMALS", "a", "')'", ")", "'{'", "{",
+		"SYMBOL", "obj", "'$'", "$", "SYMBOL", "y", "LEFT_ASSIGN", "<<-",
+		"SYMBOL_FUNCTION_CALL", "g", "'('", "(", "SYMBOL", "a", "')'", ")", "';'", ";",
+		"NUM_CONST", "1", "RIGHT_ASSIGN", "->", "SYMBOL", "w", "';'", ";",
+		"SYMBOL_FUNCTION_CALL", "assign", "'('", "(", "STR_CONST", `"k"`, "','", ",",
+		"SYMBOL", "y", "'~'", "~", "SYMBOL", "a", "')'", ")",
+		"'}'", "}",
+		"SYMBOL_FUNCTION_CALL", "f", "'('", "(", "NUM_CONST", "1", "')'", ")",
+	)
+	plan, err := Default.Plan(MatchFunctionDef)
+	assert.NoError(t, err)
+	results, errs := rparse.RunMatchers(plan, tokens)
+	assert.Empty(t, errs)
+
+	state := results[MatchAssignment].(MatchAssignmentState)
+	assert.Empty(t, state.Errors)
+	assert.Equal(t, []Variable{
+		{Name: "x", AssignType: "LEFT_ASSIGN", Operator: "<-", TargetKind: TargetIndex, Replacement: "names", RHSType: ExprLiteral, RHSName: `"a"`},
+		{Name: "f", AssignType: "LEFT_ASSIGN", Operator: "<-", TargetKind: TargetSymbol, RHSType: ExprFunction},
+		{Name: "obj", AssignType: "LEFT_ASSIGN", Operator: "<<-", Super: true, TargetKind: TargetMember, Function: "f", RHSType: ExprCall, RHSName: "g"},
+		{Name: "w", AssignType: "RIGHT_ASSIGN", Operator: "->", TargetKind: TargetSymbol, Function: "f", RHSType: ExprLiteral, RHSName: "1"},
+		{Name: "k", AssignType: "SYMBOL_FUNCTION_CALL", Operator: "assign", TargetKind: TargetSymbol, Function: "f", RHSType: ExprFormula},
+	}, state.StatsVariables)
+	assert.Equal(t, 3, state.StatsLeftAssignCount)
+	assert.Equal(t, 1, state.StatsRightAssignCount)
+	assert.Equal(t, 1, state.StatsSuperAssignCount)
+	assert.Equal(t, 1, state.StatsAssignCallCount)
+
+	defs := results[MatchFunctionDef].(MatchFunctionDefState).StatFunctionDefs
+	assert.Len(t, defs, 1)
+	assert.Equal(t, "f", defs[0].AssignedName)
+
+	// 1 = 2: the operator is counted even though the target is not a variable
+	state, _, err = MatchAssignmentUpdate(MatchAssignmentState{}, 1, makeTokens("NUM_CONST", "1", "EQ_ASSIGN", "=", "NUM_CONST", "2"))
+	assert.NoError(t, err)
+	assert.Len(t, state.Errors, 1)
+	assert.Empty(t, state.StatsVariables)
+	assert.Equal(t, 1, state.StatsEqAssignCount)
+}
+
+func TestMatchObjectSystem(t *testing.T) {
+	// setClass("A", representation("Base", x = "numeric"))
+	// setMethod("show", signature(object = "A"), function(object) 1)
+	// print.A <- function(x) NextMethod()
+	tokens := makeTokens(
+		"SYMBOL_FUNCTION_CALL", "setClass", "'('", "(", "STR_CONST", `"A"`, "','", ",",
+		"SYMBOL_FUNCTION_CALL", "representation", "'('", "(", "STR_CONST", `"Base"`, "','", ",",
+		"SYMBOL_SUB", "x", "EQ_SUB", "=", "STR_CONST", `"numeric"`, "')'", ")", "')'", ")",
+		"SYMBOL_FUNCTION_CALL", "setMethod", "'('", "(", "STR_CONST", `"show"`, "','", ",",
+		"SYMBOL_FUNCTION_CALL", "signature", "'('", "(", "SYMBOL_SUB", "object", "EQ_SUB", "=", "STR_CONST", `"A"`, "')'", ")", "','", ",",
+		"FUNCTION", "function", "'('", "(", "SYMBOL_FORMALS", "object", "')'", ")", "NUM_CONST", "1", "')'", ")",
+		"SYMBOL", "print.A", "LEFT_ASSIGN", "<-", "FUNCTION", "function", "'('", "(", "SYMBOL_FORMALS", "x", "')'", ")",
+		"SYMBOL_FUNCTION_CALL", "NextMethod", "'('", "(", "')'", ")",
+	)
+	_, err := rparse.RunTokenMatcher(tokens, TrackParenthesisUpdate)
+	assert.NoError(t, err)
+	state, err := rparse.RunTokenMatcher(tokens, MatchObjectSystemUpdate)
+	assert.NoError(t, err)
+	assert.Empty(t, state.Errors)
+	assert.Equal(t, []ObjectClass{{
+		System: SystemS4, Name: "A", Defined: true,
+		Contains: []string{"Base"}, Fields: []string{"x"}, Methods: []string{"show"},
+	}}, state.Classes)
+	assert.Equal(t, []ObjectGeneric{{System: SystemS4, Name: "show", Methods: []string{"A"}}}, state.Generics)
+	assert.Equal(t, []string{"print.A"}, state.S3MethodCandidates)
+	assert.Equal(t, 1, state.StatsNextMethodCount)
+
+	// f(setClass(: only unclosed calls of the object systems are errors
+	tokens = makeTokens("SYMBOL_FUNCTION_CALL", "f", "'('", "(", "SYMBOL_FUNCTION_CALL", "setClass", "'('", "(")
+	_, err = rparse.RunTokenMatcher(tokens, TrackParenthesisUpdate)
+	assert.NoError(t, err)
+	state, err = rparse.RunTokenMatcher(tokens, MatchObjectSystemUpdate)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"unclosed call to setClass at 2"}, state.Errors)
+}
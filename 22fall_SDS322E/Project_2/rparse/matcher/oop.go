@@ -0,0 +1,279 @@
+package matcher
+
+import (
+	"Project2/rparse"
+	"fmt"
+	"strings"
+)
+
+const MatchObjectSystem = "oop"
+
+func init() {
+	Default.MustRegister(rparse.NewMatcherSpec(MatchObjectSystem, []string{TrackParenthesis}, MatchObjectSystemUpdate))
+}
+
+// Object systems.
+const (
+	SystemS3 = "S3"
+	SystemS4 = "S4"
+	SystemRC = "RC"
+	SystemR6 = "R6"
+)
+
+type ObjectClass struct {
+	System string
+	Name   string
+	// Defined is set if the class is created in this file rather than only given methods or a validity function.
+	Defined  bool
+	Contains []string
+	// Fields are the slots of S4 classes and the fields of RC and R6 classes.
+	Fields   []string
+	Methods  []string
+	Validity bool
+}
+
+type ObjectGeneric struct {
+	System string
+	Name   string
+	// Defined is set if the generic is created in the package rather than only extended with methods.
+	Defined bool
+	// Methods are the classes a method is defined for.
+	Methods []string
+}
+
+type MatchObjectSystemState struct {
+	Errors   []string
+	Classes  []ObjectClass
+	Generics []ObjectGeneric
+	// S3MethodCandidates are the names of functions that look like generic.class.
+	S3MethodCandidates []string
+
+	StatsUseMethodCount       int
+	StatsNextMethodCount      int
+	StatsStandardGenericCount int
+}
+
+func (state *MatchObjectSystemState) class(system string, name string) *ObjectClass {
+	for i := range state.Classes {
+		if state.Classes[i].System == system && state.Classes[i].Name == name {
+			return &state.Classes[i]
+		}
+	}
+	state.Classes = append(state.Classes, ObjectClass{System: system, Name: name})
+	return &state.Classes[len(state.Classes)-1]
+}
+
+func (state *MatchObjectSystemState) generic(system string, name string) *ObjectGeneric {
+	for i := range state.Generics {
+		if state.Generics[i].System == system && state.Generics[i].Name == name {
+			return &state.Generics[i]
+		}
+	}
+	state.Generics = append(state.Generics, ObjectGeneric{System: system, Name: name})
+	return &state.Generics[len(state.Generics)-1]
+}
+
+// positional returns the n-th unnamed argument, or the argument with the given name.
+func positional(args []argSpan, n int, name string) (argSpan, bool) {
+	for _, arg := range args {
+		if arg.name == name {
+			return arg, true
+		}
+	}
+	for _, arg := range args {
+		if arg.name == "" {
+			if n == 0 {
+				return arg, true
+			}
+			n--
+		}
+	}
+	return argSpan{}, false
+}
+
+// firstString returns the first string constant of the argument picked by positional.
+func firstString(tokens rparse.RTokenList, args []argSpan, n int, name string) string {
+	arg, ok := positional(args, n, name)
+	if !ok {
+		return ""
+	}
+	if values, _ := stringValues(tokens, arg); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// members splits list(a = 1, f = function() ...) into fields and methods.
+func members(tokens rparse.RTokenList, arg argSpan) (fields []string, methods []string) {
+	if tokens[arg.start].Token != "SYMBOL_FUNCTION_CALL" {
+		return nil, nil
+	}
+	for _, sub := range callArgs(tokens, arg.start+1) {
+		if sub.name == "" {
+			if sub.end-sub.start == 1 && tokens[sub.start].Token == "STR_CONST" {
+				fields = append(fields, unquote(tokens[sub.start].Text))
+			}
+		} else if tokens[sub.start].Token == "FUNCTION" {
+			methods = append(methods, sub.name)
+		} else {
+			fields = append(fields, sub.name)
+		}
+	}
+	return fields, methods
+}
+
+func (state *MatchObjectSystemState) matchCall(i int, tokens rparse.RTokenList) {
+	fn := tokens[i].Text
+	// only the arguments of the calls below are read, so other calls are not
+	// scanned for their closing parenthesis
+	switch fn {
+	case "NextMethod":
+		state.StatsNextMethodCount++
+		return
+	case "standardGeneric":
+		state.StatsStandardGenericCount++
+		return
+	case "setClass", "setRefClass", "R6Class", "setGeneric", "setMethod", "setReplaceMethod", "setValidity", "UseMethod":
+	default:
+		return
+	}
+	args := callArgs(tokens, i+1)
+	if args == nil {
+		state.Errors = append(state.Errors, fmt.Sprintf("unclosed call to %s at %d", fn, i))
+		return
+	}
+	switch fn {
+	case "setClass":
+		name := firstString(tokens, args, 0, "Class")
+		if name == "" {
+			return
+		}
+		class := state.class(SystemS4, name)
+		class.Defined = true
+		if arg, ok := positional(args, 1, "representation"); ok {
+			// representation("Base", a = "numeric")
+			values, names := stringValues(tokens, arg)
+			class.Fields = append(class.Fields, names...)
+			class.Contains = append(class.Contains, values...)
+		}
+		if arg, ok := positional(args, -1, "slots"); ok {
+			values, names := stringValues(tokens, arg)
+			if len(names) == 0 {
+				// slots = c("a", "b") declares slots of class ANY
+				names = values
+			}
+			class.Fields = append(class.Fields, names...)
+		}
+		if arg, ok := positional(args, -1, "contains"); ok {
+			values, _ := stringValues(tokens, arg)
+			class.Contains = append(class.Contains, values...)
+		}
+		if _, ok := positional(args, -1, "validity"); ok {
+			class.Validity = true
+		}
+	case "setRefClass":
+		name := firstString(tokens, args, 0, "Class")
+		if name == "" {
+			return
+		}
+		class := state.class(SystemRC, name)
+		class.Defined = true
+		if arg, ok := positional(args, -1, "fields"); ok {
+			values, names := stringValues(tokens, arg)
+			class.Fields = append(class.Fields, names...)
+			class.Fields = append(class.Fields, values...)
+		}
+		if arg, ok := positional(args, -1, "methods"); ok {
+			_, methods := members(tokens, arg)
+			class.Methods = append(class.Methods, methods...)
+		}
+		if arg, ok := positional(args, -1, "contains"); ok {
+			values, _ := stringValues(tokens, arg)
+			class.Contains = append(class.Contains, values...)
+		}
+	case "R6Class":
+		name := firstString(tokens, args, 0, "classname")
+		if name == "" {
+			// fall back to the variable the generator is assigned to
+			start := i
+			if i >= 2 && tokens[i-1].Token == "NS_GET" {
+				start = i - 2
+			}
+			if start >= 2 && (tokens[start-1].Token == "LEFT_ASSIGN" || tokens[start-1].Token == "EQ_ASSIGN") {
+				name = unquote(tokens[start-2].Text)
+			}
+		}
+		if name == "" {
+			return
+		}
+		class := state.class(SystemR6, name)
+		class.Defined = true
+		for _, section := range []string{"public", "private", "active"} {
+			if arg, ok := positional(args, -1, section); ok {
+				fields, methods := members(tokens, arg)
+				class.Fields = append(class.Fields, fields...)
+				class.Methods = append(class.Methods, methods...)
+			}
+		}
+		if arg, ok := positional(args, -1, "inherit"); ok && tokens[arg.start].Token == "SYMBOL" {
+			class.Contains = append(class.Contains, tokens[arg.start].Text)
+		}
+	case "setGeneric":
+		if name := firstString(tokens, args, 0, "name"); name != "" {
+			state.generic(SystemS4, name).Defined = true
+		}
+	case "setMethod", "setReplaceMethod":
+		name := firstString(tokens, args, 0, "f")
+		if name == "" {
+			return
+		}
+		if fn == "setReplaceMethod" {
+			name += "<-"
+		}
+		generic := state.generic(SystemS4, name)
+		arg, ok := positional(args, 1, "signature")
+		if !ok {
+			return
+		}
+		values, _ := stringValues(tokens, arg)
+		if len(values) == 0 {
+			// signature(x = "A")
+			for _, sub := range callArgs(tokens, arg.start+1) {
+				if sub.end-sub.start == 1 && tokens[sub.start].Token == "STR_CONST" {
+					values = append(values, unquote(tokens[sub.start].Text))
+				}
+			}
+		}
+		if len(values) > 0 {
+			generic.Methods = append(generic.Methods, values[0])
+			class := state.class(SystemS4, values[0])
+			class.Methods = append(class.Methods, name)
+		}
+	case "setValidity":
+		if name := firstString(tokens, args, 0, "Class"); name != "" {
+			state.class(SystemS4, name).Validity = true
+		}
+	case "UseMethod":
+		state.StatsUseMethodCount++
+		if name := firstString(tokens, args, 0, "generic"); name != "" {
+			state.generic(SystemS3, name).Defined = true
+		}
+	}
+}
+
+func MatchObjectSystemUpdate(state MatchObjectSystemState, i int, tokens rparse.RTokenList) (next MatchObjectSystemState, delta int, err error) {
+	switch tokens[i].Token {
+	case "SYMBOL_FUNCTION_CALL":
+		if i+1 < len(tokens) && tokens[i+1].Token == "'('" {
+			state.matchCall(i, tokens)
+		}
+	case "LEFT_ASSIGN", "EQ_ASSIGN":
+		if i >= 1 && i+1 < len(tokens) && tokens[i+1].Token == "FUNCTION" && parenDepth(tokens, i) == 0 {
+			name := unquote(tokens[i-1].Text)
+			if (tokens[i-1].Token == "SYMBOL" || tokens[i-1].Token == "STR_CONST") && len(name) > 1 && strings.IndexByte(name[1:], '.') != -1 {
+				state.S3MethodCandidates = append(state.S3MethodCandidates, name)
+			}
+		}
+	}
+	return state, 1, nil
+}
@@ -8,15 +8,17 @@ import (
 
 const TrackParenthesis = "paren"
 
+func init() {
+	Default.MustRegister(rparse.NewMatcherSpec(TrackParenthesis, nil, TrackParenthesisUpdate))
+}
+
 type TrackParenthesisState struct {
-	done  bool
 	Stack []byte
 }
 
 func (s TrackParenthesisState) Clone() TrackParenthesisState {
 	return TrackParenthesisState{
 		Stack: append([]byte(nil), s.Stack...),
-		done:  s.done,
 	}
 }
 
@@ -33,11 +35,9 @@ func (s TrackParenthesisState) Depth(paren byte) int {
 	return depth
 }
 
+// TrackParenthesisUpdate annotates every token with its nesting depth. Opening
+// and closing parentheses count as inside the pair they delimit.
 func TrackParenthesisUpdate(state TrackParenthesisState, i int, tokens rparse.RTokenList) (next TrackParenthesisState, delta int, err error) {
-	state = state.Clone()
-	pushStack := func(c byte) {
-		state.Stack = append(state.Stack, c)
-	}
 	popStack := func(expect byte) error {
 		if len(state.Stack) == 0 {
 			return errors.New("mismatched parenthesis")
@@ -48,24 +48,14 @@ func TrackParenthesisUpdate(state TrackParenthesisState, i int, tokens rparse.RT
 		state.Stack = state.Stack[:len(state.Stack)-1]
 		return nil
 	}
-	token := tokens[i]
-	switch token.Token {
+	switch tokens[i].Token {
 	case "'('":
-		if !state.done {
-			pushStack('(')
-			state.done = true
-			return state, 0, nil
-		} else {
-			state.done = false
-		}
+		state.Stack = append(state.Stack, '(')
 	case "'{'":
-		if !state.done {
-			pushStack('{')
-			state.done = true
-			return state, 0, nil
-		} else {
-			state.done = false
-		}
+		state.Stack = append(state.Stack, '{')
+	}
+	tokens[i].Depth = len(state.Stack)
+	switch tokens[i].Token {
 	case "')'":
 		if err := popStack('('); err != nil {
 			return state, 0, err
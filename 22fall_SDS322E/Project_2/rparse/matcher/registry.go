@@ -0,0 +1,6 @@
+package matcher
+
+import "Project2/rparse"
+
+// Default holds the built-in matchers, registered by each matcher's init().
+var Default = new(rparse.Registry)
@@ -1,5 +1,10 @@
 package matcher
 
+import (
+	"Project2/rparse"
+	"strings"
+)
+
 func contains[T comparable](list []T, item T) bool {
 	for _, x := range list {
 		if x == item {
@@ -8,3 +13,215 @@ func contains[T comparable](list []T, item T) bool {
 	}
 	return false
 }
+
+// parenDepth returns the parenthesis nesting depth recorded by TrackParenthesis at token i.
+func parenDepth(tokens rparse.RTokenList, i int) int {
+	return tokens[i].Depth
+}
+
+// maxExprTextLen caps the source text kept for an expression.
+const maxExprTextLen = 256
+
+// exprText joins the text of tokens[start:end], truncated to maxExprTextLen.
+func exprText(tokens rparse.RTokenList, start int, end int) string {
+	var sb strings.Builder
+	for i := start; i < end; i++ {
+		sb.WriteString(tokens[i].Text)
+		if sb.Len() >= maxExprTextLen {
+			return sb.String()[:maxExprTextLen]
+		}
+	}
+	return sb.String()
+}
+
+func unquote(text string) string {
+	if len(text) >= 2 && (text[0] == '"' || text[0] == '\'' || text[0] == '`') && text[len(text)-1] == text[0] {
+		return text[1 : len(text)-1]
+	}
+	return text
+}
+
+func isConstToken(token string) bool {
+	return strings.HasSuffix(token, "_CONST")
+}
+
+// matchingClose returns the index of the ')' or '}' closing the '(' or '{' at open, or -1.
+func matchingClose(tokens rparse.RTokenList, open int) int {
+	closeToken := "')'"
+	if tokens[open].Token == "'{'" {
+		closeToken = "'}'"
+	}
+	depth := parenDepth(tokens, open)
+	for j := open + 1; j < len(tokens); j++ {
+		if tokens[j].Token == closeToken && parenDepth(tokens, j) == depth {
+			return j
+		}
+	}
+	return -1
+}
+
+// matchingOpen returns the index of the '(' or '{' opening the ')' or '}' at close, or -1.
+func matchingOpen(tokens rparse.RTokenList, close int) int {
+	openToken := "'('"
+	if tokens[close].Token == "'}'" {
+		openToken = "'{'"
+	}
+	depth := parenDepth(tokens, close)
+	for j := close - 1; j >= 0; j-- {
+		if tokens[j].Token == openToken && parenDepth(tokens, j) == depth {
+			return j
+		}
+	}
+	return -1
+}
+
+// matchingBracketOpen returns the index of the '[' or '[[' opening the ']' at close, or -1.
+func matchingBracketOpen(tokens rparse.RTokenList, close int) int {
+	count := 0
+	for j := close; j >= 0; j-- {
+		switch tokens[j].Token {
+		case "']'":
+			count++
+		case "'['":
+			count--
+		case "LBB":
+			count -= 2
+		}
+		if count <= 0 {
+			return j
+		}
+	}
+	return -1
+}
+
+var binaryOperatorTokens = map[string]bool{
+	"'+'": true, "'-'": true, "'*'": true, "'/'": true, "'^'": true, "':'": true,
+	"'$'": true, "'@'": true, "'['": true, "LBB": true, "'('": true, "'?'": true,
+	"SPECIAL": true, "PIPE": true, "GT": true, "GE": true, "LT": true, "LE": true,
+	"EQ": true, "NE": true, "AND": true, "OR": true, "AND2": true, "OR2": true,
+}
+
+// Expression kinds returned by classifyExpr.
+const (
+	ExprLiteral  = "literal"
+	ExprSymbol   = "symbol"
+	ExprCall     = "call"
+	ExprFunction = "function"
+	ExprFormula  = "formula"
+	ExprAssign   = "assign"
+	ExprExpr     = "expr"
+)
+
+// classifyExpr classifies the expression starting at tokens[start] by its leading
+// operand and the operator following it, returning its kind and, for literals,
+// symbols and calls, its name.
+func classifyExpr(tokens rparse.RTokenList, start int) (kind string, name string) {
+	if start >= len(tokens) {
+		return ExprExpr, ""
+	}
+	end := start + 1
+	switch token := tokens[start].Token; {
+	case token == "FUNCTION", token == "'\\\\'":
+		return ExprFunction, ""
+	case token == "'~'":
+		return ExprFormula, ""
+	case isConstToken(token):
+		kind, name = ExprLiteral, tokens[start].Text
+	case token == "SYMBOL":
+		kind, name = ExprSymbol, tokens[start].Text
+	case token == "SYMBOL_PACKAGE" && start+2 < len(tokens) && tokens[start+2].Token == "SYMBOL_FUNCTION_CALL":
+		name = tokens[start].Text + tokens[start+1].Text + tokens[start+2].Text
+		start += 2
+		fallthrough
+	case token == "SYMBOL_FUNCTION_CALL":
+		if name == "" {
+			name = tokens[start].Text
+		}
+		if start+1 >= len(tokens) || tokens[start+1].Token != "'('" {
+			return ExprExpr, ""
+		}
+		if end = matchingClose(tokens, start+1); end == -1 {
+			return ExprExpr, ""
+		}
+		kind, end = ExprCall, end+1
+	default:
+		return ExprExpr, ""
+	}
+	if end < len(tokens) {
+		switch next := tokens[end].Token; {
+		case next == "'~'":
+			return ExprFormula, ""
+		case next == "LEFT_ASSIGN" || next == "EQ_ASSIGN":
+			return ExprAssign, name
+		case binaryOperatorTokens[next]:
+			return ExprExpr, ""
+		}
+	}
+	return kind, name
+}
+
+type argSpan struct {
+	name  string
+	start int
+	end   int
+}
+
+// callArgs splits the arguments of the call whose '(' is at tokens[open] into
+// spans of tokens, returning nil if the call is not closed.
+func callArgs(tokens rparse.RTokenList, open int) []argSpan {
+	end := matchingClose(tokens, open)
+	if end == -1 {
+		return nil
+	}
+	depth := parenDepth(tokens, open)
+	args := []argSpan{}
+	arg := argSpan{start: open + 1}
+	brackets := 0
+	for j := open + 1; j <= end; j++ {
+		if parenDepth(tokens, j) != depth {
+			continue
+		}
+		switch tokens[j].Token {
+		case "'['":
+			brackets++
+		case "LBB":
+			brackets += 2
+		case "']'":
+			brackets--
+		case "EQ_SUB":
+			if j == arg.start+1 {
+				arg.name = unquote(tokens[j-1].Text)
+				arg.start = j + 1
+			}
+		case "','", "')'":
+			if brackets > 0 && j != end {
+				continue
+			}
+			if arg.start < j || arg.name != "" {
+				arg.end = j
+				args = append(args, arg)
+			}
+			arg = argSpan{start: j + 1}
+		}
+	}
+	return args
+}
+
+// stringValues returns the string constants in an argument that is a single
+// string or a call such as c("a", "b"), together with the argument names of the call.
+func stringValues(tokens rparse.RTokenList, arg argSpan) (values []string, names []string) {
+	if arg.end-arg.start == 1 && tokens[arg.start].Token == "STR_CONST" {
+		return []string{unquote(tokens[arg.start].Text)}, nil
+	}
+	if tokens[arg.start].Token != "SYMBOL_FUNCTION_CALL" || arg.start+1 >= arg.end {
+		return nil, nil
+	}
+	for _, sub := range callArgs(tokens, arg.start+1) {
+		if sub.name != "" {
+			names = append(names, sub.name)
+		} else if sub.end-sub.start == 1 && tokens[sub.start].Token == "STR_CONST" {
+			values = append(values, unquote(tokens[sub.start].Text))
+		}
+	}
+	return values, names
+}
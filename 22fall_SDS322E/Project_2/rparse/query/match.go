@@ -0,0 +1,254 @@
+package query
+
+import (
+	"Project2/rparse"
+	"regexp"
+	"strings"
+)
+
+// maxSteps caps the node matches of a single match attempt, as nested
+// repeats can backtrack exponentially.
+const maxSteps = 1 << 20
+
+// machine holds the input of a single match attempt.
+type machine struct {
+	tokens   rparse.RTokenList
+	captures map[string][2]int
+	steps    int
+}
+
+// step counts a node match, returning false once the attempt has taken
+// maxSteps, which fails every remaining alternative.
+func (m *machine) step() bool {
+	m.steps++
+	return m.steps <= maxSteps
+}
+
+// node matches a part of a pattern at token i and calls k with the index after
+// the match, trying alternatives until k returns true.
+type node interface {
+	match(m *machine, i int, k func(int) bool) bool
+}
+
+type textPredicate struct {
+	negate bool
+	regex  bool
+	text   string
+	re     *regexp.Regexp
+}
+
+func (p textPredicate) test(text string) bool {
+	if p.regex {
+		return p.re.MatchString(text)
+	}
+	return p.text == text
+}
+
+type tokenNode struct {
+	class string
+	preds []textPredicate
+}
+
+func (n tokenNode) accepts(token rparse.RToken) bool {
+	switch n.class {
+	case "_":
+	case "CONST":
+		if !strings.HasSuffix(token.Token, "_CONST") {
+			return false
+		}
+	default:
+		if token.Token != n.class {
+			return false
+		}
+	}
+	hasPositive := false
+	positive := false
+	for _, pred := range n.preds {
+		if pred.negate {
+			if pred.test(token.Text) {
+				return false
+			}
+		} else {
+			hasPositive = true
+			positive = positive || pred.test(token.Text)
+		}
+	}
+	return !hasPositive || positive
+}
+
+func (n tokenNode) match(m *machine, i int, k func(int) bool) bool {
+	return m.step() && i < len(m.tokens) && n.accepts(m.tokens[i]) && k(i+1)
+}
+
+type seqNode []node
+
+func (n seqNode) match(m *machine, i int, k func(int) bool) bool {
+	if len(n) == 0 {
+		return k(i)
+	}
+	return n[0].match(m, i, func(j int) bool {
+		return n[1:].match(m, j, k)
+	})
+}
+
+type altNode []node
+
+func (n altNode) match(m *machine, i int, k func(int) bool) bool {
+	for _, alt := range n {
+		if alt.match(m, i, k) {
+			return true
+		}
+	}
+	return false
+}
+
+type repeatNode struct {
+	item node
+	min  int
+	// max is the maximum number of repetitions, or -1 for no limit.
+	max int
+}
+
+func (n repeatNode) match(m *machine, i int, k func(int) bool) bool {
+	return n.matchFrom(m, i, 0, k)
+}
+
+func (n repeatNode) matchFrom(m *machine, i int, count int, k func(int) bool) bool {
+	if !m.step() {
+		return false
+	}
+	if n.max == -1 || count < n.max {
+		// greedy: try one more repetition first, refusing empty repetitions to avoid looping
+		if n.item.match(m, i, func(j int) bool {
+			return j > i && n.matchFrom(m, j, count+1, k)
+		}) {
+			return true
+		}
+	}
+	return count >= n.min && k(i)
+}
+
+type captureNode struct {
+	name string
+	item node
+}
+
+func (n captureNode) match(m *machine, i int, k func(int) bool) bool {
+	return n.item.match(m, i, func(j int) bool {
+		prev, hadPrev := m.captures[n.name]
+		m.captures[n.name] = [2]int{i, j}
+		if k(j) {
+			return true
+		}
+		if hadPrev {
+			m.captures[n.name] = prev
+		} else {
+			delete(m.captures, n.name)
+		}
+		return false
+	})
+}
+
+// spanEnd returns the index after the balanced span starting at tokens[i], or -1.
+func spanEnd(tokens rparse.RTokenList, i int, open string, close string) int {
+	if i >= len(tokens) || tokens[i].Token != open {
+		return -1
+	}
+	depth := 0
+	for j := i; j < len(tokens); j++ {
+		switch tokens[j].Token {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// bracketEnd returns the index after the balanced [...] or [[...]] span starting at tokens[i], or -1.
+func bracketEnd(tokens rparse.RTokenList, i int) int {
+	if i >= len(tokens) || tokens[i].Token != "'['" && tokens[i].Token != "LBB" {
+		return -1
+	}
+	depth := 0
+	for j := i; j < len(tokens); j++ {
+		switch tokens[j].Token {
+		case "'['":
+			depth++
+		case "LBB":
+			depth += 2
+		case "']'":
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// balancedEnd returns the index after the balanced span starting at tokens[i], or -1 if there is none.
+func balancedEnd(tokens rparse.RTokenList, i int) int {
+	switch tokens[i].Token {
+	case "'('":
+		return spanEnd(tokens, i, "'('", "')'")
+	case "'{'":
+		return spanEnd(tokens, i, "'{'", "'}'")
+	case "'['", "LBB":
+		return bracketEnd(tokens, i)
+	}
+	return -1
+}
+
+type spanNode struct {
+	open  string
+	close string
+}
+
+func (n spanNode) match(m *machine, i int, k func(int) bool) bool {
+	if !m.step() {
+		return false
+	}
+	end := spanEnd(m.tokens, i, n.open, n.close)
+	return end != -1 && k(end)
+}
+
+type bracketNode struct{}
+
+func (n bracketNode) match(m *machine, i int, k func(int) bool) bool {
+	if !m.step() {
+		return false
+	}
+	end := bracketEnd(m.tokens, i)
+	return end != -1 && k(end)
+}
+
+type lazyNode struct{}
+
+func (n lazyNode) match(m *machine, i int, k func(int) bool) bool {
+	for {
+		if !m.step() {
+			return false
+		}
+		if k(i) {
+			return true
+		}
+		if i >= len(m.tokens) {
+			return false
+		}
+		switch m.tokens[i].Token {
+		case "')'", "'}'", "']'":
+			// never consume the closing token of an enclosing span
+			return false
+		}
+		if end := balancedEnd(m.tokens, i); end != -1 {
+			i = end
+		} else {
+			i++
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Pattern syntax:
+//
+//	SYMBOL_FUNCTION_CALL    a token class, as reported by getParseData()
+//	'('                     a literal token class such as '(' or '$'
+//	_                       any token
+//	CONST                   any *_CONST token
+//	X[="a"|~"^re$"|!="b"]   a token with text predicates: the text must satisfy one
+//	                        of the = and ~ predicates, if any, and all of the != and !~
+//	                        predicates
+//	name:item               capture the tokens matched by item
+//	(a b | c)               group with alternation
+//	item? item* item+       optional and repeated items, greedy
+//	@paren @brace @bracket  a balanced (...), {...} or [...] / [[...]] span
+//	...                     a lazy run of tokens, skipping balanced spans
+//
+// For example, a call to library() with a symbol or string argument:
+//
+//	fn:SYMBOL_FUNCTION_CALL[="library"|="require"] '(' pkg:(SYMBOL | STR_CONST) ... ')'
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("query: at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+}
+
+func (p *parser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) && isIdentByte(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) parseAlt() (node, error) {
+	var alts []node
+	for {
+		seq, err := p.parseSeq()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, seq)
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return altNode(alts), nil
+}
+
+func (p *parser) parseSeq() (node, error) {
+	var items []node
+	for {
+		switch c := p.peek(); c {
+		case 0, '|', ')':
+			return seqNode(items), nil
+		}
+		item, err := p.parseItem()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (p *parser) parseItem() (node, error) {
+	capture := ""
+	if isIdentByte(p.peek()) {
+		start := p.pos
+		name := p.ident()
+		if p.pos < len(p.src) && p.src[p.pos] == ':' {
+			capture = name
+			p.pos++
+		} else {
+			p.pos = start
+		}
+	}
+	item, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '?':
+			item = repeatNode{item: item, min: 0, max: 1}
+			p.pos++
+		case '*':
+			item = repeatNode{item: item, min: 0, max: -1}
+			p.pos++
+		case '+':
+			item = repeatNode{item: item, min: 1, max: -1}
+			p.pos++
+		}
+	}
+	if capture != "" {
+		item = captureNode{name: capture, item: item}
+	}
+	return item, nil
+}
+
+func (p *parser) parseAtom() (node, error) {
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		inner, err := p.parseAlt()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("expected ')'")
+		}
+		p.pos++
+		return inner, nil
+	case c == '@':
+		p.pos++
+		switch name := p.ident(); name {
+		case "paren":
+			return spanNode{open: "'('", close: "')'"}, nil
+		case "brace":
+			return spanNode{open: "'{'", close: "'}'"}, nil
+		case "bracket":
+			return bracketNode{}, nil
+		default:
+			return nil, p.errorf("unknown span @%s", name)
+		}
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		return lazyNode{}, nil
+	case c == '\'':
+		end := strings.IndexByte(p.src[p.pos+1:], '\'')
+		if end < 1 {
+			return nil, p.errorf("invalid token literal")
+		}
+		class := p.src[p.pos : p.pos+end+2]
+		p.pos += end + 2
+		return p.parsePredicate(tokenNode{class: class})
+	case isIdentByte(c):
+		return p.parsePredicate(tokenNode{class: p.ident()})
+	case c == 0:
+		return nil, p.errorf("unexpected end of pattern")
+	default:
+		return nil, p.errorf("unexpected character %q", c)
+	}
+}
+
+func (p *parser) parseString() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != '"' {
+		return "", p.errorf("expected string")
+	}
+	prefix, err := strconv.QuotedPrefix(p.src[p.pos:])
+	if err != nil {
+		return "", p.errorf("invalid string: %v", err)
+	}
+	p.pos += len(prefix)
+	return strconv.Unquote(prefix)
+}
+
+func (p *parser) parsePredicate(tok tokenNode) (node, error) {
+	if p.pos >= len(p.src) || p.src[p.pos] != '[' {
+		return tok, nil
+	}
+	p.pos++
+	for {
+		var pred textPredicate
+		p.skipSpace()
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "!="):
+			pred.negate = true
+			p.pos += 2
+		case strings.HasPrefix(p.src[p.pos:], "!~"):
+			pred.negate = true
+			pred.regex = true
+			p.pos += 2
+		case strings.HasPrefix(p.src[p.pos:], "="):
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "~"):
+			pred.regex = true
+			p.pos++
+		default:
+			return nil, p.errorf("expected one of = != ~ !~")
+		}
+		text, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		if pred.regex {
+			if pred.re, err = regexp.Compile(text); err != nil {
+				return nil, p.errorf("invalid regular expression: %v", err)
+			}
+		} else {
+			pred.text = text
+		}
+		tok.preds = append(tok.preds, pred)
+		switch p.peek() {
+		case '|':
+			p.pos++
+		case ']':
+			p.pos++
+			return tok, nil
+		default:
+			return nil, p.errorf("expected '|' or ']'")
+		}
+	}
+}
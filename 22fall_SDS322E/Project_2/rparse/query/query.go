@@ -0,0 +1,178 @@
+package query
+
+import (
+	"Project2/rparse"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Prefix is prepended to query names to form their matcher names.
+const Prefix = "query."
+
+// maxTextLen caps the source text kept for matches and captures.
+const maxTextLen = 256
+
+type Query struct {
+	Name    string
+	Pattern string
+	root    node
+}
+
+type Match struct {
+	Text     string
+	Captures map[string]string
+}
+
+type State struct {
+	Matches []Match
+	// Errors are the start positions the query gave up matching at
+	Errors []string `json:",omitempty"`
+}
+
+// Compile parses a pattern into a query.
+func Compile(name string, pattern string) (*Query, error) {
+	p := &parser{src: pattern}
+	root, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 0 {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	return &Query{Name: name, Pattern: pattern, root: root}, nil
+}
+
+func MustCompile(name string, pattern string) *Query {
+	q, err := Compile(name, pattern)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// MatcherName is the name the query's matcher state is stored under.
+func (q *Query) MatcherName() string {
+	return Prefix + q.Name
+}
+
+func text(tokens rparse.RTokenList, start int, end int) string {
+	var sb strings.Builder
+	for i := start; i < end && sb.Len() < maxTextLen; i++ {
+		sb.WriteString(tokens[i].Text)
+	}
+	if sb.Len() > maxTextLen {
+		return sb.String()[:maxTextLen]
+	}
+	return sb.String()
+}
+
+// MatchAt tries to match the query starting at tokens[i], returning the index
+// after the match. It fails with an error if the attempt backtracks too much.
+func (q *Query) MatchAt(tokens rparse.RTokenList, i int) (match Match, end int, ok bool, err error) {
+	m := &machine{tokens: tokens, captures: make(map[string][2]int)}
+	ok = q.root.match(m, i, func(j int) bool {
+		end = j
+		return true
+	})
+	if m.steps > maxSteps {
+		return match, i, false, fmt.Errorf("query %s: gave up matching at token %d after %d steps", q.Name, i, maxSteps)
+	}
+	if !ok {
+		return match, i, false, nil
+	}
+	match.Text = text(tokens, i, end)
+	if len(m.captures) > 0 {
+		match.Captures = make(map[string]string, len(m.captures))
+		for name, span := range m.captures {
+			match.Captures[name] = text(tokens, span[0], span[1])
+		}
+	}
+	return match, end, true, nil
+}
+
+// Update is a token matcher recording non-overlapping matches of the query.
+// Giving up at a start position is recorded in the state's errors, and the
+// matching goes on at the next token.
+func (q *Query) Update(state State, i int, tokens rparse.RTokenList) (next State, delta int, err error) {
+	match, end, ok, err := q.MatchAt(tokens, i)
+	if err != nil {
+		state.Errors = append(state.Errors, err.Error())
+		return state, 1, nil
+	} else if !ok || end == i {
+		return state, 1, nil
+	}
+	state.Matches = append(state.Matches, match)
+	return state, end - i, nil
+}
+
+var queryLine = regexp.MustCompile(`^([\w\.]+)\s*=\s*(.*)$`)
+
+// Load reads queries, one "name = pattern" per line. Lines starting with
+// whitespace continue the previous pattern, and lines starting with # are comments.
+func Load(r io.Reader) ([]*Query, error) {
+	var queries []*Query
+	var name, pattern string
+	lineNo, startLine := 0, 0
+	flush := func() error {
+		if name == "" {
+			return nil
+		}
+		q, err := Compile(name, pattern)
+		if err != nil {
+			return fmt.Errorf("line %d: %s: %v", startLine, name, err)
+		}
+		queries = append(queries, q)
+		name = ""
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if name == "" {
+				return nil, fmt.Errorf("line %d: continuation without a query", lineNo)
+			}
+			pattern += " " + trimmed
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		subMatch := queryLine.FindStringSubmatch(trimmed)
+		if subMatch == nil {
+			return nil, fmt.Errorf("line %d: expected name = pattern", lineNo)
+		}
+		for _, q := range queries {
+			if q.Name == subMatch[1] {
+				return nil, fmt.Errorf("line %d: duplicate query %s", lineNo, q.Name)
+			}
+		}
+		name, pattern, startLine = subMatch[1], subMatch[2], lineNo
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// LoadFile reads queries from a file, see Load.
+func LoadFile(path string) ([]*Query, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
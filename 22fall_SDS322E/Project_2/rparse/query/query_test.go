@@ -0,0 +1,90 @@
+package query
+
+import (
+	"Project2/rparse"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTokens(pairs ...string) rparse.RTokenList {
+	tokens := make(rparse.RTokenList, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		tokens = append(tokens, rparse.RToken{Filename: "test.R", Token: pairs[i], Text: pairs[i+1]})
+	}
+	return tokens
+}
+
+func TestQueryMatch(t *testing.T) {
+	// library(dplyr); x <- require("stats", quietly = f(TRUE))
+	tokens := makeTokens(
+		"SYMBOL_FUNCTION_CALL", "library", "'('", "(", "SYMBOL", "dplyr", "')'", ")", "';'", ";",
+		"SYMBOL", "x", "LEFT_ASSIGN", "<-",
+		"SYMBOL_FUNCTION_CALL", "require", "'('", "(", "STR_CONST", `"stats"`, "','", ",",
+		"SYMBOL_SUB", "quietly", "EQ_SUB", "=",
+		"SYMBOL_FUNCTION_CALL", "f", "'('", "(", "NUM_CONST", "TRUE", "')'", ")", "')'", ")",
+	)
+
+	q, err := Compile("load", `fn:SYMBOL_FUNCTION_CALL[="library"|="require"] '(' pkg:(SYMBOL | STR_CONST) ... ')'`)
+	assert.NoError(t, err)
+	state, err := rparse.RunTokenMatcher(tokens, q.Update)
+	assert.NoError(t, err)
+	assert.Equal(t, []Match{
+		{Text: "library(dplyr)", Captures: map[string]string{"fn": "library", "pkg": "dplyr"}},
+		{Text: `require("stats",quietly=f(TRUE))`, Captures: map[string]string{"fn": "require", "pkg": `"stats"`}},
+	}, state.Matches)
+}
+
+func TestQueryRepeatAndSpans(t *testing.T) {
+	tokens := makeTokens(
+		"SYMBOL", "a", "'$'", "$", "SYMBOL", "b", "'$'", "$", "SYMBOL", "c",
+		"LBB", "[[", "NUM_CONST", "1", "']'", "]", "']'", "]",
+	)
+	q := MustCompile("chain", `root:SYMBOL ('$' SYMBOL)+ idx:@bracket?`)
+	match, end, ok, err := q.MatchAt(tokens, 0)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, len(tokens), end)
+	assert.Equal(t, map[string]string{"root": "a", "idx": "[[1]]"}, match.Captures)
+
+	_, _, ok, _ = MustCompile("neg", `SYMBOL[!="a"]`).MatchAt(tokens, 0)
+	assert.False(t, ok)
+}
+
+func TestQueryStepLimit(t *testing.T) {
+	var pairs []string
+	for i := 0; i < 40; i++ {
+		pairs = append(pairs, "SYMBOL", "x")
+	}
+	tokens := makeTokens(pairs...)
+	// nested repeats try every partition of the symbols before failing
+	q := MustCompile("nested", `(SYMBOL+)+ NUM_CONST`)
+	_, _, ok, err := q.MatchAt(tokens, 0)
+	assert.False(t, ok)
+	assert.ErrorContains(t, err, "gave up matching")
+
+	// the matches found before and after giving up are kept
+	pairs = append([]string{"SYMBOL", "y", "NUM_CONST", "1"}, pairs[:50]...)
+	pairs = append(pairs, "';'", ";", "SYMBOL", "z", "NUM_CONST", "2")
+	state, err := rparse.RunTokenMatcher(makeTokens(pairs...), q.Update)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, state.Errors)
+	assert.Equal(t, []Match{{Text: "y1"}, {Text: "z2"}}, state.Matches)
+}
+
+func TestLoad(t *testing.T) {
+	queries, err := Load(strings.NewReader(`
+# calls to lm with a formula
+lm_formula = SYMBOL_FUNCTION_CALL[="lm"]
+    '(' SYMBOL '~' ... ')'
+sapply_call = SYMBOL_FUNCTION_CALL[~"^[sv]apply$"] @paren
+`))
+	assert.NoError(t, err)
+	assert.Len(t, queries, 2)
+	assert.Equal(t, "lm_formula", queries[0].Name)
+	assert.Equal(t, "query.sapply_call", queries[1].MatcherName())
+
+	_, err = Load(strings.NewReader("bad = SYMBOL[=\"x\""))
+	assert.Error(t, err)
+}
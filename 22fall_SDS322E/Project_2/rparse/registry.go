@@ -0,0 +1,149 @@
+package rparse
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// MatcherSpec describes a token matcher and the matchers whose per-token states it reads.
+type MatcherSpec struct {
+	Name  string
+	Deps  []string
+	State reflect.Type
+
+	run func(tokens RTokenList) (any, error)
+}
+
+// NewMatcherSpec describes a matcher that runs update with RunTokenMatcher.
+func NewMatcherSpec[S any](
+	name string,
+	deps []string,
+	update func(lastState S, i int, tokens RTokenList) (next S, delta int, err error)) MatcherSpec {
+	return MatcherSpec{
+		Name:  name,
+		Deps:  deps,
+		State: reflect.TypeOf((*S)(nil)).Elem(),
+		run: func(tokens RTokenList) (any, error) {
+			state, err := RunTokenMatcher(tokens, update)
+			if err != nil {
+				return nil, err
+			}
+			return state, nil
+		},
+	}
+}
+
+type Registry struct {
+	specs []MatcherSpec
+	index map[string]int
+}
+
+func (r *Registry) Register(spec MatcherSpec) error {
+	if r.index == nil {
+		r.index = make(map[string]int)
+	}
+	if _, ok := r.index[spec.Name]; ok {
+		return fmt.Errorf("matcher %s already registered", spec.Name)
+	}
+	r.index[spec.Name] = len(r.specs)
+	r.specs = append(r.specs, spec)
+	return nil
+}
+
+func (r *Registry) MustRegister(spec MatcherSpec) {
+	if err := r.Register(spec); err != nil {
+		panic(err)
+	}
+}
+
+// Clone returns a copy of the registry that can be extended without affecting r.
+func (r *Registry) Clone() *Registry {
+	clone := new(Registry)
+	for _, spec := range r.specs {
+		clone.MustRegister(spec)
+	}
+	return clone
+}
+
+// Names returns the names of all registered matchers in registration order.
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.specs))
+	for i, spec := range r.specs {
+		names[i] = spec.Name
+	}
+	return names
+}
+
+// Plan returns the named matchers and their dependencies, ordered so that every
+// matcher comes after its dependencies. All matchers are planned if names is empty.
+func (r *Registry) Plan(names ...string) ([]MatcherSpec, error) {
+	if len(names) == 0 {
+		names = r.Names()
+	}
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	marks := make(map[string]int)
+	var plan []MatcherSpec
+	var visit func(name string, from string) error
+	visit = func(name string, from string) error {
+		idx, ok := r.index[name]
+		if !ok {
+			if from != "" {
+				return fmt.Errorf("matcher %s depends on unknown matcher %s", from, name)
+			}
+			return fmt.Errorf("unknown matcher %s", name)
+		}
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle through matcher %s", name)
+		case done:
+			return nil
+		}
+		marks[name] = visiting
+		for _, dep := range r.specs[idx].Deps {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		marks[name] = done
+		plan = append(plan, r.specs[idx])
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// RunMatchers runs a plan over tokens, returning the final state of each matcher
+// that succeeded and the error of each that failed. Matchers depending on a failed
+// matcher are not run and fail as well.
+func RunMatchers(plan []MatcherSpec, tokens RTokenList) (results map[string]any, errs map[string]error) {
+	results = make(map[string]any, len(plan))
+	errs = make(map[string]error)
+	for _, spec := range plan {
+		skip := false
+		for _, dep := range spec.Deps {
+			if _, ok := results[dep]; !ok {
+				errs[spec.Name] = fmt.Errorf("dependency %s failed", dep)
+				skip = true
+				break
+			}
+		}
+		if skip {
+			continue
+		}
+		state, err := spec.run(tokens)
+		if err != nil {
+			errs[spec.Name] = err
+			continue
+		}
+		results[spec.Name] = state
+	}
+	return results, errs
+}
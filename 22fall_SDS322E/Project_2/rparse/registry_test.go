@@ -0,0 +1,49 @@
+package rparse
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func countTokens(state int, i int, tokens RTokenList) (int, int, error) {
+	return state + 1, 1, nil
+}
+
+func failTokens(state int, i int, tokens RTokenList) (int, int, error) {
+	return state, 0, errors.New("failed")
+}
+
+func TestRegistryPlan(t *testing.T) {
+	r := new(Registry)
+	assert.NoError(t, r.Register(NewMatcherSpec("c", []string{"b", "a"}, countTokens)))
+	assert.NoError(t, r.Register(NewMatcherSpec("b", []string{"a"}, failTokens)))
+	assert.NoError(t, r.Register(NewMatcherSpec("a", nil, countTokens)))
+	assert.NoError(t, r.Register(NewMatcherSpec("d", nil, countTokens)))
+	assert.Error(t, r.Register(NewMatcherSpec("d", nil, countTokens)))
+
+	plan, err := r.Plan("c")
+	assert.NoError(t, err)
+	var names []string
+	for _, spec := range plan {
+		names = append(names, spec.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	_, err = r.Plan("missing")
+	assert.Error(t, err)
+
+	cyclic := r.Clone()
+	assert.NoError(t, cyclic.Register(NewMatcherSpec("e", []string{"f"}, countTokens)))
+	assert.NoError(t, cyclic.Register(NewMatcherSpec("f", []string{"e"}, countTokens)))
+	_, err = cyclic.Plan("e")
+	assert.Error(t, err)
+
+	plan, err = r.Plan()
+	assert.NoError(t, err)
+	results, errs := RunMatchers(plan, RTokenList{{Token: "SYMBOL"}, {Token: "SYMBOL"}})
+	assert.Equal(t, map[string]any{"a": 2, "d": 2}, results)
+	assert.Len(t, errs, 2)
+	assert.EqualError(t, errs["c"], "dependency b failed")
+}
@@ -6,31 +6,37 @@ import (
 
 type RTokenList []RToken
 
-func (l RTokenList) FinalMatcherState(name string) any {
-	return l[len(l)-1].MatcherState[name]
+// Annotate records a value on the token for the matchers that run after the matcher name.
+func (t *RToken) Annotate(name string, value any) {
+	if t.annotations == nil {
+		t.annotations = make(map[string]any, 1)
+	}
+	t.annotations[name] = value
+}
+
+// Annotation returns the value recorded on the token by the matcher name, or nil.
+func (t *RToken) Annotation(name string) any {
+	return t.annotations[name]
 }
 
+// RunTokenMatcher runs matcher over the token list and returns its final state.
+// Per-token results needed by other matchers are recorded by the matcher itself
+// as token annotations rather than by keeping a copy of every intermediate state.
 func RunTokenMatcher[S any](
-	name string,
 	tokenList RTokenList,
-	matcher func(lastState S, i int, tokens RTokenList) (next S, delta int, err error)) error {
+	matcher func(lastState S, i int, tokens RTokenList) (next S, delta int, err error)) (final S, err error) {
 	var state S
 	i := 0
 	for {
 		if i < 0 {
-			return errors.New("negative index")
+			return state, errors.New("negative index")
 		} else if i >= len(tokenList) {
-			return nil
-		}
-		if tokenList[i].MatcherState == nil {
-			tokenList[i].MatcherState = make(map[string]any)
+			return state, nil
 		}
 		//log.Printf("token %d: %s, state=%v", i, tokenList[i].Token, state)
-		tokenList[i].MatcherState[name] = state
-
 		next, delta, err := matcher(state, i, tokenList)
 		if err != nil {
-			return err
+			return state, err
 		}
 		i += delta
 		state = next
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"Project2/model"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONSink appends packages to an indented JSON stream. Every package is synced
+// to disk before Write returns. A package replaces the fetch-failure record of
+// its version, so the stream holds one record per package version.
+type JSONSink struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	enc  *json.Encoder
+	// failed are the versions stored as fetch-failure records
+	failed map[model.PackageVersion]bool
+}
+
+func OpenJSON(path string) (*JSONSink, error) {
+	s := &JSONSink{path: path, failed: make(map[model.PackageVersion]bool)}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	err := s.each(func(p *model.P) error {
+		if p.FetchError != "" {
+			s.failed[p.PackageVersion()] = true
+		}
+		return nil
+	})
+	if err != nil {
+		s.f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	s.f = f
+	s.enc = json.NewEncoder(f)
+	s.enc.SetIndent("", "  ")
+	return nil
+}
+
+func (s *JSONSink) Done() (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	done := make(map[string]bool)
+	err := s.each(func(p *model.P) error {
+		if p.FetchError == "" {
+			done[p.URL] = true
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (s *JSONSink) Versions() (map[model.PackageVersion]Seen, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := make(map[model.PackageVersion]Seen)
+	err := s.each(func(p *model.P) error {
+		if p.FetchError == "" {
+			versions[p.PackageVersion()] = Seen{FirstSeen: p.FirstSeen, LastSeen: p.LastSeen, Status: p.Status}
+		}
+		return nil
+	})
+	return versions, err
+}
+
+// SetSeen rewrites the output with the new crawl statuses and atomically replaces it.
+func (s *JSONSink) SetSeen(seen map[model.PackageVersion]Seen) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rewrite(func(p *model.P) bool {
+		if next, ok := seen[p.PackageVersion()]; ok && p.FetchError == "" {
+			p.FirstSeen, p.LastSeen, p.Status = next.FirstSeen, next.LastSeen, next.Status
+		}
+		return true
+	})
+}
+
+// rewrite atomically replaces the output with the packages fn keeps, after fn
+// has updated them. The caller holds s.mu.
+func (s *JSONSink) rewrite(fn func(p *model.P) bool) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "  ")
+	err = s.each(func(p *model.P) error {
+		if !fn(p) {
+			return nil
+		}
+		return enc.Encode(p)
+	})
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not rewrite output file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.f.Close()
+	return s.open()
+}
+
+// each decodes every package in the output file. The caller holds s.mu.
+func (s *JSONSink) each(fn func(p *model.P) error) error {
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek to start of output file: %w", err)
+	}
+	dec := model.NewDecoder(s.f)
+	for {
+		var p model.P
+		if err := dec.Decode(&p); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				// a crash while writing left a torn record at the end
+				offset := dec.InputOffset()
+				log.Printf("Truncating torn record at offset %d of output file", offset)
+				if err := s.f.Truncate(offset); err != nil {
+					return fmt.Errorf("could not truncate torn record: %w", err)
+				}
+				return nil
+			}
+			return fmt.Errorf("could not decode output file: %w", err)
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *JSONSink) Write(p *model.P) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := p.PackageVersion()
+	if s.failed[v] {
+		err := s.rewrite(func(stored *model.P) bool {
+			return stored.FetchError == "" || stored.PackageVersion() != v
+		})
+		if err != nil {
+			return err
+		}
+		delete(s.failed, v)
+	}
+	if err := s.enc.Encode(p); err != nil {
+		return err
+	}
+	if p.FetchError != "" {
+		s.failed[v] = true
+	}
+	return s.f.Sync()
+}
+
+func (s *JSONSink) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Classes of fetch failures.
+const (
+	FailureNetwork = "network"
+	FailureHTTP    = "http"
+	FailureArchive = "archive"
+	FailureOther   = "other"
+)
+
+// Failure is an entry of the failure ledger.
+type Failure struct {
+	URL   string
+	Name  string
+	Class string
+	Error string
+	Time  time.Time
+	// Attempt is the number of failed attempts for URL including this one
+	Attempt int
+}
+
+// Ledger is an append-only JSON lines file of fetch failures, kept apart from
+// the output so that failed packages can be retried. It is safe for concurrent use.
+type Ledger struct {
+	mu       sync.Mutex
+	f        *os.File
+	enc      *json.Encoder
+	attempts map[string]int
+}
+
+// OpenLedger opens or creates the ledger at path and reads the failures recorded so far.
+func OpenLedger(path string) (*Ledger, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	l := &Ledger{f: f, enc: json.NewEncoder(f), attempts: make(map[string]int)}
+	dec := json.NewDecoder(f)
+	for {
+		var failure Failure
+		if err := dec.Decode(&failure); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err == io.ErrUnexpectedEOF {
+				offset := dec.InputOffset()
+				log.Printf("Truncating torn entry at offset %d of failure ledger", offset)
+				if err = f.Truncate(offset); err == nil {
+					break
+				}
+			}
+			f.Close()
+			return nil, fmt.Errorf("could not read failure ledger: %w", err)
+		}
+		l.attempts[failure.URL]++
+	}
+	return l, nil
+}
+
+// Attempts returns the number of failed attempts recorded for url.
+func (l *Ledger) Attempts(url string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.attempts[url]
+}
+
+// Record appends a failure, filling in its Attempt and, if unset, its Time.
+func (l *Ledger) Record(failure Failure) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.attempts[failure.URL]++
+	failure.Attempt = l.attempts[failure.URL]
+	if failure.Time.IsZero() {
+		failure.Time = time.Now().UTC()
+	}
+	if err := l.enc.Encode(failure); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+func (l *Ledger) Close() error {
+	return l.f.Close()
+}
@@ -0,0 +1,348 @@
+package store
+
+import (
+	"Project2/model"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS packages (
+	id INTEGER PRIMARY KEY,
+	url TEXT NOT NULL,
+	schema INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	title TEXT NOT NULL,
+	version TEXT NOT NULL,
+	license TEXT NOT NULL,
+	description TEXT NOT NULL,
+	fetch_error TEXT NOT NULL,
+	first_seen TEXT NOT NULL,
+	last_seen TEXT NOT NULL,
+	status TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS packages_url ON packages (url);
+CREATE INDEX IF NOT EXISTS packages_name ON packages (name);
+CREATE TABLE IF NOT EXISTS dependencies (
+	package_id INTEGER NOT NULL REFERENCES packages (id),
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS dependencies_name ON dependencies (name);
+CREATE TABLE IF NOT EXISTS file_extensions (
+	package_id INTEGER NOT NULL REFERENCES packages (id),
+	extension TEXT NOT NULL,
+	count INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS files (
+	package_id INTEGER NOT NULL REFERENCES packages (id),
+	name TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS r_files (
+	id INTEGER PRIMARY KEY,
+	package_id INTEGER NOT NULL REFERENCES packages (id),
+	name TEXT NOT NULL,
+	n_tokens INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS function_defs (
+	r_file_id INTEGER NOT NULL REFERENCES r_files (id),
+	idx INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	n_args INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS function_def_args (
+	r_file_id INTEGER NOT NULL REFERENCES r_files (id),
+	def_idx INTEGER NOT NULL,
+	pos INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	default_value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS function_calls (
+	r_file_id INTEGER NOT NULL REFERENCES r_files (id),
+	idx INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	package TEXT NOT NULL,
+	parent INTEGER NOT NULL,
+	arg_pos INTEGER NOT NULL,
+	n_args INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS function_calls_name ON function_calls (name);
+CREATE TABLE IF NOT EXISTS function_call_args (
+	r_file_id INTEGER NOT NULL REFERENCES r_files (id),
+	call_idx INTEGER NOT NULL,
+	pos INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	value TEXT NOT NULL,
+	call INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS variables (
+	r_file_id INTEGER NOT NULL REFERENCES r_files (id),
+	name TEXT NOT NULL,
+	assign_type TEXT NOT NULL,
+	operator TEXT NOT NULL,
+	super INTEGER NOT NULL,
+	target_kind TEXT NOT NULL,
+	replacement TEXT NOT NULL,
+	function TEXT NOT NULL,
+	rhs_type TEXT NOT NULL,
+	rhs_name TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS namespace_directives (
+	package_id INTEGER NOT NULL REFERENCES packages (id),
+	directive TEXT NOT NULL,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS parse_errors (
+	package_id INTEGER NOT NULL REFERENCES packages (id),
+	stage TEXT NOT NULL,
+	file TEXT NOT NULL,
+	message TEXT NOT NULL,
+	stack TEXT NOT NULL,
+	violation TEXT NOT NULL
+);
+`
+
+// SQLiteSink stores packages in normalized tables of a SQLite database. Each
+// package is written in a single transaction, and replaces the fetch-failure
+// record of its version.
+type SQLiteSink struct {
+	mu sync.Mutex
+	db *sql.DB
+}
+
+func OpenSQLite(path string) (*SQLiteSink, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create tables: %w", err)
+	}
+	return &SQLiteSink{db: db}, nil
+}
+
+// DB returns the underlying database for queries.
+func (s *SQLiteSink) DB() *sql.DB {
+	return s.db
+}
+
+func (s *SQLiteSink) Done() (map[string]bool, error) {
+	rows, err := s.db.Query("SELECT url FROM packages WHERE fetch_error = ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := make(map[string]bool)
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		done[url] = true
+	}
+	return done, rows.Err()
+}
+
+func (s *SQLiteSink) Versions() (map[model.PackageVersion]Seen, error) {
+	rows, err := s.db.Query("SELECT name, version, first_seen, last_seen, status FROM packages WHERE fetch_error = ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make(map[model.PackageVersion]Seen)
+	for rows.Next() {
+		var v model.PackageVersion
+		var firstSeen, lastSeen string
+		var seen Seen
+		if err := rows.Scan(&v.Name, &v.Version, &firstSeen, &lastSeen, &seen.Status); err != nil {
+			return nil, err
+		}
+		if seen.FirstSeen, err = parseSQLiteTime(firstSeen); err != nil {
+			return nil, err
+		}
+		if seen.LastSeen, err = parseSQLiteTime(lastSeen); err != nil {
+			return nil, err
+		}
+		versions[v] = seen
+	}
+	return versions, rows.Err()
+}
+
+func (s *SQLiteSink) SetSeen(seen map[model.PackageVersion]Seen) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for v, next := range seen {
+		if _, err := tx.Exec("UPDATE packages SET first_seen = ?, last_seen = ?, status = ? WHERE name = ? AND version = ? AND fetch_error = ''",
+			formatSQLiteTime(next.FirstSeen), formatSQLiteTime(next.LastSeen), next.Status, v.Name, v.Version); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// formatSQLiteTime stores times as RFC 3339 text, and the zero time as an empty string.
+func formatSQLiteTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseSQLiteTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func (s *SQLiteSink) Write(p *model.P) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := writePackage(tx, p); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("package %s: %w", p.URL, err)
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
+
+func writePackage(tx *sql.Tx, p *model.P) error {
+	desc := &p.Description
+	v := p.PackageVersion()
+	// a package replaces the fetch-failure record of its version, which has
+	// no rows in the other tables
+	if _, err := tx.Exec("DELETE FROM packages WHERE name = ? AND version = ? AND fetch_error != ''", v.Name, v.Version); err != nil {
+		return err
+	}
+	res, err := tx.Exec("INSERT INTO packages (url, schema, name, title, version, license, description, fetch_error, first_seen, last_seen, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		p.URL, p.Schema, v.Name, desc.Title, v.Version, desc.License, desc.Description, p.FetchError,
+		formatSQLiteTime(p.FirstSeen), formatSQLiteTime(p.LastSeen), p.Status)
+	if err != nil {
+		return err
+	}
+	pkgID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, dep := range []struct {
+		kind  string
+		names []string
+	}{{"Depends", desc.Depends}, {"Imports", desc.Imports}, {"Suggests", desc.Suggests}} {
+		for _, name := range dep.names {
+			if _, err := tx.Exec("INSERT INTO dependencies VALUES (?, ?, ?)", pkgID, dep.kind, name); err != nil {
+				return err
+			}
+		}
+	}
+	exts := make([]string, 0, len(p.FileExtensions))
+	for ext := range p.FileExtensions {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		if _, err := tx.Exec("INSERT INTO file_extensions VALUES (?, ?, ?)", pkgID, ext, p.FileExtensions[ext]); err != nil {
+			return err
+		}
+	}
+	// Files are not in the JSON output, so packages converted from it have none
+	for _, name := range p.Files {
+		if _, err := tx.Exec("INSERT INTO files VALUES (?, ?)", pkgID, name); err != nil {
+			return err
+		}
+	}
+	ns := &p.Namespace
+	for _, dir := range []struct {
+		directive string
+		values    []string
+	}{
+		{"export", ns.Exports},
+		{"import", ns.Imports},
+		{"exportClasses", ns.ExportClasses},
+		{"exportMethods", ns.ExportMethods},
+		{"S3method", ns.S3Methods},
+	} {
+		for _, value := range dir.values {
+			if _, err := tx.Exec("INSERT INTO namespace_directives VALUES (?, ?, ?)", pkgID, dir.directive, value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range p.ParseError {
+		if _, err := tx.Exec("INSERT INTO parse_errors VALUES (?, ?, ?, ?, ?, ?)", pkgID, e.Stage, e.File, e.Message, e.Stack, e.Violation); err != nil {
+			return err
+		}
+	}
+	for i := range p.RFiles {
+		if err := writeRFile(tx, pkgID, &p.RFiles[i]); err != nil {
+			return fmt.Errorf("%s: %w", p.RFiles[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func writeRFile(tx *sql.Tx, pkgID int64, file *model.RFile) error {
+	res, err := tx.Exec("INSERT INTO r_files (package_id, name, n_tokens) VALUES (?, ?, ?)", pkgID, file.Name, file.NTokens)
+	if err != nil {
+		return err
+	}
+	fileID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if state := file.Stats.FunctionDef; state != nil {
+		for i, def := range state.StatFunctionDefs {
+			if _, err := tx.Exec("INSERT INTO function_defs VALUES (?, ?, ?, ?)", fileID, i, def.AssignedName, len(def.Args)); err != nil {
+				return err
+			}
+			for pos, arg := range def.Args {
+				if _, err := tx.Exec("INSERT INTO function_def_args VALUES (?, ?, ?, ?, ?)", fileID, i, pos, arg.Name, arg.Default); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if state := file.Stats.FunctionCall; state != nil {
+		for i, call := range state.StatsFunctionCalls {
+			if _, err := tx.Exec("INSERT INTO function_calls VALUES (?, ?, ?, ?, ?, ?, ?)",
+				fileID, i, call.Name, call.Package, call.Parent, call.ArgPos, len(call.Args)); err != nil {
+				return err
+			}
+			for pos, arg := range call.Args {
+				if _, err := tx.Exec("INSERT INTO function_call_args VALUES (?, ?, ?, ?, ?, ?, ?)",
+					fileID, i, pos, arg.Name, arg.Type, arg.Value, arg.Call); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if state := file.Stats.Assignment; state != nil {
+		for _, v := range state.StatsVariables {
+			if _, err := tx.Exec("INSERT INTO variables VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+				fileID, v.Name, v.AssignType, v.Operator, v.Super, v.TargetKind, v.Replacement, v.Function, v.RHSType, v.RHSName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
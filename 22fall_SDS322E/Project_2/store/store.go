@@ -0,0 +1,56 @@
+package store
+
+import (
+	"Project2/model"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Sink is a persistent output for parsed packages. Sinks are safe for concurrent use.
+type Sink interface {
+	// Done returns the URLs of the packages already stored without a fetch
+	// error, so a run can be resumed. Fetch failures are retried according
+	// to the failure ledger.
+	Done() (map[string]bool, error)
+	Write(p *model.P) error
+	Close() error
+}
+
+// Open opens or creates the sink at path. Files ending in .db, .sqlite or .sqlite3
+// are SQLite databases, anything else is a JSON stream.
+func Open(path string) (Sink, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return OpenSQLite(path)
+	}
+	return OpenJSON(path)
+}
+
+// Copy writes the packages of a JSON stream to sink, skipping those it already
+// stores or the stream repeats, and returns the number of packages written.
+func Copy(sink Sink, r io.Reader) (n int, err error) {
+	done, err := sink.Done()
+	if err != nil {
+		return 0, err
+	}
+	dec := model.NewDecoder(r)
+	for {
+		var p model.P
+		if err := dec.Decode(&p); err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, fmt.Errorf("could not decode package %d: %w", n+1, err)
+		}
+		if done[p.URL] {
+			continue
+		}
+		if err := sink.Write(&p); err != nil {
+			return n, err
+		}
+		done[p.URL] = true
+		n++
+	}
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"Project2/model"
+	"Project2/rparse/matcher"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPackage(url string) *model.P {
+	p := model.NewP()
+	p.URL = url
+	p.Description.Package = "foo"
+	p.Description.Imports = []string{"stats", "utils"}
+	p.Namespace.Exports = []string{"foo"}
+	p.FileExtensions[".r"] = 1
+	p.Files = []string{"foo/DESCRIPTION", "foo/R/foo.R"}
+	p.RFiles = []model.RFile{{Name: "/R/foo.R", NTokens: 10, Stats: model.NewFileStats(map[string]any{
+		matcher.MatchFunctionCall: matcher.MatchFunctionCallState{StatsFunctionCalls: []matcher.FunctionCall{
+			{Name: "lm", Parent: -1, ArgPos: -1, Args: []matcher.FunctionCallArg{{Type: "SYMBOL", Value: "x", Call: -1}}},
+		}},
+		matcher.MatchAssignment: matcher.MatchAssignmentState{StatsVariables: []matcher.Variable{
+			{Name: "foo", AssignType: "LEFT_ASSIGN", Operator: "<-", TargetKind: matcher.TargetSymbol, RHSType: matcher.ExprFunction},
+		}},
+	})}}
+	return p
+}
+
+func TestSQLiteSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.db")
+	sink, err := Open(path)
+	assert.NoError(t, err)
+	assert.IsType(t, &SQLiteSink{}, sink)
+	assert.NoError(t, sink.Write(testPackage("a")))
+	assert.NoError(t, sink.Close())
+
+	sink, err = Open(path)
+	assert.NoError(t, err)
+	defer sink.Close()
+	var stream bytes.Buffer
+	enc := json.NewEncoder(&stream)
+	assert.NoError(t, enc.Encode(testPackage("a")))
+	assert.NoError(t, enc.Encode(testPackage("b")))
+	assert.NoError(t, enc.Encode(testPackage("b")))
+	n, err := Copy(sink, &stream)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	done, err := sink.Done()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, done)
+
+	db := sink.(*SQLiteSink).DB()
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT count(*) FROM function_calls c
+		JOIN r_files f ON f.id = c.r_file_id
+		JOIN packages p ON p.id = f.package_id
+		WHERE c.name = 'lm' AND p.name = 'foo'`).Scan(&count))
+	assert.Equal(t, 2, count)
+	assert.NoError(t, db.QueryRow("SELECT count(*) FROM dependencies WHERE kind = 'Imports'").Scan(&count))
+	assert.Equal(t, 4, count)
+	// only the package written directly has files, the JSON stream has none
+	assert.NoError(t, db.QueryRow(`SELECT count(*) FROM files f
+		JOIN packages p ON p.id = f.package_id
+		WHERE p.url = 'a'`).Scan(&count))
+	assert.Equal(t, 2, count)
+	assert.NoError(t, db.QueryRow("SELECT count(*) FROM files").Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+func TestJSONSinkResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	sink, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Write(testPackage("a")))
+	assert.NoError(t, sink.Close())
+
+	sink, err = Open(path)
+	assert.NoError(t, err)
+	defer sink.Close()
+	done, err := sink.Done()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a": true}, done)
+	assert.NoError(t, sink.Write(testPackage("b")))
+	done, err = sink.Done()
+	assert.NoError(t, err)
+	assert.Len(t, done, 2)
+}
+
+func TestJSONSinkTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	sink, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Write(testPackage("a")))
+	assert.NoError(t, sink.Close())
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"Schema": 2, "URL": "b", "Descr`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	sink, err = Open(path)
+	assert.NoError(t, err)
+	done, err := sink.Done()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a": true}, done)
+	assert.NoError(t, sink.Write(testPackage("b")))
+	done, err = sink.Done()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, done)
+	assert.NoError(t, sink.Close())
+}
+
+func TestLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json.failures")
+	ledger, err := OpenLedger(path)
+	assert.NoError(t, err)
+	assert.NoError(t, ledger.Record(Failure{URL: "a", Name: "foo", Class: FailureHTTP, Error: "unexpected status code: 404"}))
+	assert.NoError(t, ledger.Record(Failure{URL: "a", Name: "foo", Class: FailureNetwork, Error: "timeout"}))
+	assert.NoError(t, ledger.Close())
+
+	ledger, err = OpenLedger(path)
+	assert.NoError(t, err)
+	defer ledger.Close()
+	assert.Equal(t, 2, ledger.Attempts("a"))
+	assert.Equal(t, 0, ledger.Attempts("b"))
+}
+
+func TestRefresh(t *testing.T) {
+	for _, ext := range []string{".json", ".db"} {
+		sink, err := Open(filepath.Join(t.TempDir(), "out"+ext))
+		assert.NoError(t, err)
+		week1 := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+		for _, v := range []model.PackageVersion{{Name: "foo", Version: "1.0"}, {Name: "bar", Version: "0.1"}, {Name: "baz", Version: "2.0"}} {
+			p := testPackage(v.Name)
+			p.Name, p.Version = v.Name, v.Version
+			p.FirstSeen, p.LastSeen, p.Status = week1, week1, model.StatusCurrent
+			assert.NoError(t, sink.Write(p))
+		}
+
+		week2 := week1.AddDate(0, 0, 7)
+		missing, err := Refresh(sink.(Updater), []model.PackageVersion{{Name: "foo", Version: "1.1"}, {Name: "bar", Version: "0.1"}, {Name: "qux", Version: "1.0"}}, week2)
+		assert.NoError(t, err, ext)
+		assert.Equal(t, []model.PackageVersion{{Name: "foo", Version: "1.1"}, {Name: "qux", Version: "1.0"}}, missing, ext)
+
+		versions, err := sink.(Updater).Versions()
+		assert.NoError(t, err)
+		assert.Equal(t, map[model.PackageVersion]Seen{
+			{Name: "foo", Version: "1.0"}: {week1, week1, model.StatusArchived},
+			{Name: "bar", Version: "0.1"}: {week1, week2, model.StatusCurrent},
+			{Name: "baz", Version: "2.0"}: {week1, week1, model.StatusRemoved},
+		}, versions, ext)
+		assert.NoError(t, sink.Write(testPackage("d")), ext)
+		// fetch failures are retried according to the ledger, and replaced
+		// once the version is fetched
+		for _, fetchError := range []string{"unexpected status code: 404", "timeout", ""} {
+			p := testPackage("e")
+			p.Name, p.Version, p.FetchError = "qux", "1.0", fetchError
+			assert.NoError(t, sink.Write(p), ext)
+			if fetchError == "" {
+				break
+			}
+			done, err := sink.Done()
+			assert.NoError(t, err)
+			assert.Len(t, done, 4, ext)
+			assert.False(t, done["e"], ext)
+			versions, err := sink.(Updater).Versions()
+			assert.NoError(t, err)
+			assert.NotContains(t, versions, model.PackageVersion{Name: "qux", Version: "1.0"}, ext)
+		}
+		n := 0
+		switch s := sink.(type) {
+		case *SQLiteSink:
+			assert.NoError(t, s.DB().QueryRow("SELECT COUNT(*) FROM packages WHERE name = 'qux'").Scan(&n))
+		case *JSONSink:
+			assert.NoError(t, s.each(func(p *model.P) error {
+				if p.Name == "qux" {
+					n++
+				}
+				return nil
+			}))
+		}
+		assert.Equal(t, 1, n, ext)
+		assert.NoError(t, sink.Close())
+	}
+}
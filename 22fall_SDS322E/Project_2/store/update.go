@@ -0,0 +1,67 @@
+package store
+
+import (
+	"Project2/model"
+	"time"
+)
+
+// Seen is the crawl status of a stored package version.
+type Seen struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Status    string
+}
+
+// Updater is a Sink whose packages can be refreshed against a new package index.
+type Updater interface {
+	Sink
+	// Versions returns the crawl status of every stored package version.
+	Versions() (map[model.PackageVersion]Seen, error)
+	// SetSeen replaces the crawl status of stored package versions.
+	SetSeen(seen map[model.PackageVersion]Seen) error
+}
+
+// Refresh compares the package index listing the given versions at time now with
+// the stored versions. Stored versions that are listed are marked current and
+// seen now, the others archived if another version of the package is listed and
+// removed otherwise. It returns the listed versions that are not stored yet.
+func Refresh(sink Updater, index []model.PackageVersion, now time.Time) (missing []model.PackageVersion, err error) {
+	stored, err := sink.Versions()
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[model.PackageVersion]bool, len(index))
+	listedNames := make(map[string]bool, len(index))
+	for _, v := range index {
+		listed[v] = true
+		listedNames[v.Name] = true
+		if _, ok := stored[v]; !ok {
+			missing = append(missing, v)
+		}
+	}
+	updates := make(map[model.PackageVersion]Seen)
+	for v, seen := range stored {
+		next := seen
+		switch {
+		case listed[v]:
+			next.LastSeen = now
+			next.Status = model.StatusCurrent
+		case listedNames[v.Name]:
+			next.Status = model.StatusArchived
+		default:
+			next.Status = model.StatusRemoved
+		}
+		if next.FirstSeen.IsZero() {
+			next.FirstSeen = next.LastSeen
+		}
+		if next != seen {
+			updates[v] = next
+		}
+	}
+	if len(updates) > 0 {
+		if err := sink.SetSeen(updates); err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"Project2/model"
+	"sort"
+	"time"
+)
+
+// packageTables are the details of packages as tidy tables, each keyed by
+// package and version. Rows of R files are also keyed by file; indices of
+// function calls start at 1 and the parent of top-level calls is NA, so
+// calls join on parent = idx in R.
+type packageTables struct {
+	Packages     []packageRow    `r:"packages"`
+	Dependencies []dependencyRow `r:"dependencies"`
+	Exports      []exportRow     `r:"exports"`
+	Imports      []importRow     `r:"imports"`
+	// FileExtensions are file counts by extension, as the output has no file names
+	FileExtensions []fileExtensionRow `r:"file_extensions"`
+	RFiles         []rFileRow         `r:"r_files"`
+	FunctionDefs   []functionDefRow   `r:"function_defs"`
+	FunctionCalls  []functionCallRow  `r:"function_calls"`
+	Variables      []variableRow      `r:"variables"`
+	ParseErrors    []parseErrorRow    `r:"parse_errors"`
+}
+
+type packageKey struct {
+	Package string `r:"package"`
+	Version string `r:"version"`
+}
+
+type packageRow struct {
+	packageKey
+	URL         string    `r:"url"`
+	Title       string    `r:"title"`
+	License     string    `r:"license"`
+	Description string    `r:"description"`
+	Status      string    `r:"status"`
+	FirstSeen   time.Time `r:"first_seen"`
+	LastSeen    time.Time `r:"last_seen"`
+	Commit      string    `r:"commit"`
+	FetchError  string    `r:"fetch_error"`
+}
+
+type dependencyRow struct {
+	packageKey
+	Kind string `r:"kind,factor"`
+	Name string `r:"name"`
+}
+
+type exportRow struct {
+	packageKey
+	// Directive is export, exportClasses, exportMethods or S3method
+	Directive string `r:"directive,factor"`
+	Name      string `r:"name"`
+}
+
+type importRow struct {
+	packageKey
+	Name string `r:"name"`
+}
+
+type fileExtensionRow struct {
+	packageKey
+	Extension string `r:"extension"`
+	Count     int    `r:"count"`
+}
+
+type rFileRow struct {
+	packageKey
+	File    string `r:"file"`
+	NTokens int    `r:"n_tokens"`
+}
+
+type functionDefRow struct {
+	packageKey
+	File  string `r:"file"`
+	Name  string `r:"name"`
+	NArgs int    `r:"n_args"`
+	// Args are the argument names, comma-separated
+	Args string `r:"args"`
+}
+
+type functionCallRow struct {
+	packageKey
+	File      string `r:"file"`
+	Idx       int    `r:"idx"`
+	Name      string `r:"name"`
+	Namespace string `r:"namespace"`
+	Parent    *int   `r:"parent"`
+	ArgPos    *int   `r:"arg_pos"`
+	NArgs     int    `r:"n_args"`
+}
+
+type variableRow struct {
+	packageKey
+	File        string `r:"file"`
+	Name        string `r:"name"`
+	Operator    string `r:"operator"`
+	Super       bool   `r:"super"`
+	TargetKind  string `r:"target_kind,factor"`
+	Replacement string `r:"replacement"`
+	Function    string `r:"function"`
+	RHSType     string `r:"rhs_type,factor"`
+	RHSName     string `r:"rhs_name"`
+}
+
+type parseErrorRow struct {
+	packageKey
+	Stage     string `r:"stage,factor"`
+	Violation string `r:"violation"`
+	File      string `r:"file"`
+	Message   string `r:"message"`
+}
+
+// newPackageTables returns empty tables, which become data.frames without
+// rows rather than NULL.
+func newPackageTables() *packageTables {
+	return &packageTables{
+		Packages:       []packageRow{},
+		Dependencies:   []dependencyRow{},
+		Exports:        []exportRow{},
+		Imports:        []importRow{},
+		FileExtensions: []fileExtensionRow{},
+		RFiles:         []rFileRow{},
+		FunctionDefs:   []functionDefRow{},
+		FunctionCalls:  []functionCallRow{},
+		Variables:      []variableRow{},
+		ParseErrors:    []parseErrorRow{},
+	}
+}
+
+// add appends the rows of a package to the tables.
+func (t *packageTables) add(p *model.P) {
+	v := p.PackageVersion()
+	key := packageKey{Package: v.Name, Version: v.Version}
+	desc := &p.Description
+	row := packageRow{
+		packageKey:  key,
+		URL:         p.URL,
+		Title:       desc.Title,
+		License:     desc.License,
+		Description: desc.Description,
+		Status:      p.Status,
+		FirstSeen:   p.FirstSeen,
+		LastSeen:    p.LastSeen,
+		FetchError:  p.FetchError,
+	}
+	if p.Commit != nil {
+		row.Commit = p.Commit.Hash
+	}
+	t.Packages = append(t.Packages, row)
+
+	for _, dep := range []struct {
+		kind  string
+		names []string
+	}{{"Depends", desc.Depends}, {"Imports", desc.Imports}, {"Suggests", desc.Suggests}} {
+		for _, name := range dep.names {
+			t.Dependencies = append(t.Dependencies, dependencyRow{key, dep.kind, name})
+		}
+	}
+	ns := &p.Namespace
+	// Exports also holds the names of the other directives, which get a row
+	// of their own
+	other := make(map[string]int)
+	for _, names := range [][]string{ns.ExportClasses, ns.ExportMethods, ns.S3Methods} {
+		for _, name := range names {
+			other[name]++
+		}
+	}
+	for _, name := range ns.Exports {
+		if other[name] > 0 {
+			other[name]--
+			continue
+		}
+		t.Exports = append(t.Exports, exportRow{key, "export", name})
+	}
+	for _, dir := range []struct {
+		directive string
+		names     []string
+	}{
+		{"exportClasses", ns.ExportClasses},
+		{"exportMethods", ns.ExportMethods},
+		{"S3method", ns.S3Methods},
+	} {
+		for _, name := range dir.names {
+			t.Exports = append(t.Exports, exportRow{key, dir.directive, name})
+		}
+	}
+	for _, name := range ns.Imports {
+		t.Imports = append(t.Imports, importRow{key, name})
+	}
+	exts := make([]string, 0, len(p.FileExtensions))
+	for ext := range p.FileExtensions {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		t.FileExtensions = append(t.FileExtensions, fileExtensionRow{key, ext, int(p.FileExtensions[ext])})
+	}
+	for _, e := range p.ParseError {
+		t.ParseErrors = append(t.ParseErrors, parseErrorRow{key, e.Stage, e.Violation, e.File, e.Message})
+	}
+	for i := range p.RFiles {
+		t.addRFile(key, &p.RFiles[i])
+	}
+}
+
+func (t *packageTables) addRFile(key packageKey, file *model.RFile) {
+	t.RFiles = append(t.RFiles, rFileRow{key, file.Name, file.NTokens})
+	if state := file.Stats.FunctionDef; state != nil {
+		for _, def := range state.StatFunctionDefs {
+			args := ""
+			for i, arg := range def.Args {
+				if i > 0 {
+					args += ","
+				}
+				args += arg.Name
+			}
+			t.FunctionDefs = append(t.FunctionDefs, functionDefRow{key, file.Name, def.AssignedName, len(def.Args), args})
+		}
+	}
+	if state := file.Stats.FunctionCall; state != nil {
+		for i, call := range state.StatsFunctionCalls {
+			row := functionCallRow{
+				packageKey: key,
+				File:       file.Name,
+				Idx:        i + 1,
+				Name:       call.Name,
+				Namespace:  call.Package,
+				NArgs:      len(call.Args),
+			}
+			if call.Parent >= 0 {
+				parent, argPos := call.Parent+1, call.ArgPos+1
+				row.Parent, row.ArgPos = &parent, &argPos
+			}
+			t.FunctionCalls = append(t.FunctionCalls, row)
+		}
+	}
+	if state := file.Stats.Assignment; state != nil {
+		for _, v := range state.StatsVariables {
+			t.Variables = append(t.Variables, variableRow{
+				packageKey:  key,
+				File:        file.Name,
+				Name:        v.Name,
+				Operator:    v.Operator,
+				Super:       v.Super,
+				TargetKind:  v.TargetKind,
+				Replacement: v.Replacement,
+				Function:    v.Function,
+				RHSType:     v.RHSType,
+				RHSName:     v.RHSName,
+			})
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"Project2/analyzer"
+	"Project2/model"
+	"Project2/rparse/matcher"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// namespaceRscript stands in for Rscript. It prints the parse data of the
+// NAMESPACE of TestPackageTables, and reads the R parser agent's commands
+// until it is stopped.
+const namespaceRscript = `#!/bin/sh
+cat > /dev/null
+if [ "$2" = "-e" ]; then
+	cat <<'END'
+"token","text"
+"SYMBOL_FUNCTION_CALL","export"
+"'('","("
+"SYMBOL","f"
+"')'",")"
+"SYMBOL_FUNCTION_CALL","exportClasses"
+"'('","("
+"STR_CONST","""A"""
+"')'",")"
+"SYMBOL_FUNCTION_CALL","S3method"
+"'('","("
+"SYMBOL","print"
+"','",","
+"SYMBOL","foo"
+"')'",")"
+END
+fi
+`
+
+func TestPackageTables(t *testing.T) {
+	dir := t.TempDir()
+	rscript := filepath.Join(dir, "Rscript")
+	assert.NoError(t, os.WriteFile(rscript, []byte(namespaceRscript), 0755))
+	pkgDir := filepath.Join(dir, "foo")
+	assert.NoError(t, os.Mkdir(pkgDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(pkgDir, "DESCRIPTION"), []byte("Package: foo\nVersion: 1.0\nImports: bar\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(pkgDir, "NAMESPACE"), nil, 0644))
+	parser, err := analyzer.NewParser(analyzer.Options{Rscript: rscript})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer parser.Close()
+	assert.NoError(t, parser.ParseProjectDir(context.Background(), pkgDir))
+	p := parser.GetParseResult()
+	assert.Empty(t, p.ParseError)
+	p.Name, p.Version = "foo", "1.0"
+	p.FileExtensions["R"] = 2
+	p.ParseError = []model.ParseError{{Stage: model.StageLimit, Violation: model.ViolationLink}}
+	p.RFiles = []model.RFile{{Name: "R/f.R", NTokens: 10, Stats: model.FileStats{
+		FunctionCall: &matcher.MatchFunctionCallState{StatsFunctionCalls: []matcher.FunctionCall{
+			{Name: "f", Parent: -1, ArgPos: -1, Args: []matcher.FunctionCallArg{{Call: 1}}},
+			{Name: "g", Package: "bar", Parent: 0, ArgPos: 0},
+		}},
+	}}}
+
+	tables := newPackageTables()
+	tables.add(p)
+	key := packageKey{Package: "foo", Version: "1.0"}
+	assert.Equal(t, []dependencyRow{{key, "Imports", "bar"}}, tables.Dependencies)
+	// the parser also lists the names of exportClasses and S3method in Exports
+	assert.Equal(t, []exportRow{{key, "export", "f"}, {key, "exportClasses", "A"}, {key, "S3method", "print.foo"}}, tables.Exports)
+	assert.Equal(t, []fileExtensionRow{{key, "R", 2}}, tables.FileExtensions)
+	assert.Equal(t, []rFileRow{{key, "R/f.R", 10}}, tables.RFiles)
+	assert.Equal(t, model.StageLimit, tables.ParseErrors[0].Stage)
+	if assert.Len(t, tables.FunctionCalls, 2) {
+		assert.Nil(t, tables.FunctionCalls[0].Parent)
+		assert.Equal(t, 1, *tables.FunctionCalls[1].Parent)
+		assert.Equal(t, 1, *tables.FunctionCalls[1].ArgPos)
+		assert.Equal(t, "bar", tables.FunctionCalls[1].Namespace)
+	}
+	assert.Empty(t, tables.Variables)
+	assert.NotNil(t, tables.Variables)
+}